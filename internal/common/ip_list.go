@@ -0,0 +1,141 @@
+package common
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// IpList 是可以在运行时修改的 IP 地址和网段的列表。修改在锁内复制并重建集合后原子地替换，所以查询不加锁，也不会看到修改到一半的列表
+// IpList is a list of IP addresses and networks that can be changed at runtime. A change copies and rebuilds the set within a lock and then replaces it atomically, so lookups take no lock and never see a half-changed list
+type IpList struct {
+	// mu 是保证修改互斥的锁
+	// mu is the lock that makes changes mutually exclusive
+	mu sync.Mutex
+
+	// prefixes 是列表中的网段，只在锁内访问
+	// prefixes is the networks in the list, it is only accessed within the lock
+	prefixes map[netip.Prefix]struct{}
+
+	// set 是由列表中的网段构建的集合，构建之后不能被修改
+	// set is the set built from the networks in the list, it must not be modified once built
+	set atomic.Pointer[IpSet]
+}
+
+// NewIpList 是一个函数，返回一个包含指定 IP 地址和 CIDR 网段的列表，无法解析的项被忽略
+// NewIpList is a function that returns a list containing the specified IP addresses and CIDR networks, items that cannot be parsed are ignored
+func NewIpList(entries ...string) *IpList {
+	l := &IpList{prefixes: make(map[netip.Prefix]struct{}, len(entries))}
+	l.Add(entries...)
+	return l
+}
+
+// Add 方法向列表添加 IP 地址和 CIDR 网段，无法解析的项被忽略
+// The Add method adds IP addresses and CIDR networks to the list, items that cannot be parsed are ignored
+func (l *IpList) Add(entries ...string) {
+	l.update(func() {
+		for _, entry := range entries {
+			if prefix, ok := parsePrefix(entry); ok {
+				l.prefixes[prefix] = Empty
+			}
+		}
+	})
+}
+
+// Remove 方法从列表删除之前添加的 IP 地址和 CIDR 网段。只删除相同的项，例如删除 "10.0.0.1" 不会改变包含它的 "10.0.0.0/8"
+// The Remove method removes IP addresses and CIDR networks added before from the list. Only equal items are removed, e.g. removing "10.0.0.1" does not change "10.0.0.0/8" containing it
+func (l *IpList) Remove(entries ...string) {
+	l.update(func() {
+		for _, entry := range entries {
+			if prefix, ok := parsePrefix(entry); ok {
+				delete(l.prefixes, prefix)
+			}
+		}
+	})
+}
+
+// Replace 方法使用指定的 IP 地址和 CIDR 网段替换列表中的所有项
+// The Replace method replaces all items in the list with the specified IP addresses and CIDR networks
+func (l *IpList) Replace(entries []string) {
+	l.update(func() {
+		l.prefixes = make(map[netip.Prefix]struct{}, len(entries))
+		for _, entry := range entries {
+			if prefix, ok := parsePrefix(entry); ok {
+				l.prefixes[prefix] = Empty
+			}
+		}
+	})
+}
+
+// Entries 方法返回列表中排好序的项，单个地址不带前缀长度
+// The Entries method returns the sorted items in the list, single addresses have no prefix length
+func (l *IpList) Entries() []string {
+	l.mu.Lock()
+	prefixes := make([]netip.Prefix, 0, len(l.prefixes))
+	for prefix := range l.prefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	l.mu.Unlock()
+
+	// 按地址和前缀长度排序
+	// Sort by address and prefix length
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+
+	entries := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if prefix.IsSingleIP() {
+			entries = append(entries, prefix.Addr().String())
+		} else {
+			entries = append(entries, prefix.String())
+		}
+	}
+	return entries
+}
+
+// Contains 方法判断地址是否在列表中，不加锁也不分配内存
+// The Contains method reports whether the address is in the list, without taking a lock or allocating memory
+func (l *IpList) Contains(addr netip.Addr) bool {
+	if s := l.set.Load(); s != nil {
+		return s.Contains(addr)
+	}
+	return false
+}
+
+// ContainsString 方法判断字符串形式的地址是否在列表中，无法解析的地址不在列表中
+// The ContainsString method reports whether the address in string form is in the list, addresses that cannot be parsed are not in the list
+func (l *IpList) ContainsString(ip string) bool {
+	if s := l.set.Load(); s != nil {
+		return s.ContainsString(ip)
+	}
+	return false
+}
+
+// Clone 方法返回一个包含相同的项的新的列表，两个列表之后的修改互不影响
+// The Clone method returns a new list containing the same items, later changes to either list do not affect the other
+func (l *IpList) Clone() *IpList {
+	return NewIpList(l.Entries()...)
+}
+
+// update 方法在锁内调用 modify 修改列表中的网段，然后重建集合并原子地替换
+// The update method calls modify within the lock to change the networks in the list, then rebuilds the set and replaces it atomically
+func (l *IpList) update(modify func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.prefixes == nil {
+		l.prefixes = map[netip.Prefix]struct{}{}
+	}
+	modify()
+
+	s := &IpSet{}
+	for prefix := range l.prefixes {
+		s.AddPrefix(prefix)
+	}
+	l.set.Store(s)
+}
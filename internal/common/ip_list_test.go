@@ -0,0 +1,97 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestIpList_AddRemoveReplace(t *testing.T) {
+	l := NewIpList("10.0.0.0/8", "192.168.1.1", "invalid")
+	if !l.ContainsString("10.1.2.3") || !l.ContainsString("192.168.1.1") || l.ContainsString("192.168.1.2") {
+		t.Fatal("unexpected lookup result")
+	}
+
+	// Only equal items are removed, an address inside a network stays covered
+	l.Remove("10.1.2.3")
+	if !l.ContainsString("10.1.2.3") {
+		t.Fatal("removing an address should not change the network containing it")
+	}
+	l.Remove("10.0.0.0/8", "::ffff:192.168.1.1")
+	if l.ContainsString("10.1.2.3") || l.ContainsString("192.168.1.1") {
+		t.Fatal("removed items should not be in the list")
+	}
+
+	// Adding and replacing
+	l.Add("2001:db8::/32", "172.16.0.1")
+	if got, want := l.Entries(), []string{"172.16.0.1", "2001:db8::/32"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Entries() = %v, want %v", got, want)
+	}
+	l.Replace([]string{"10.30.0.0/16"})
+	if got, want := l.Entries(), []string{"10.30.0.0/16"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Entries() = %v, want %v", got, want)
+	}
+	if l.ContainsString("172.16.0.1") || !l.ContainsString("10.30.5.5") {
+		t.Fatal("unexpected lookup result")
+	}
+
+	// The zero value is an empty list
+	var zero IpList
+	if zero.ContainsString("10.30.5.5") {
+		t.Fatal("the zero value should be empty")
+	}
+	zero.Add("10.30.5.5")
+	if !zero.ContainsString("10.30.5.5") {
+		t.Fatal("the zero value should be usable")
+	}
+}
+
+func TestIpList_Clone(t *testing.T) {
+	l := NewIpList("10.0.0.1")
+	c := l.Clone()
+	l.Add("10.0.0.2")
+	c.Remove("10.0.0.1")
+
+	if !l.ContainsString("10.0.0.1") || !l.ContainsString("10.0.0.2") {
+		t.Fatal("changing the clone should not affect the original")
+	}
+	if c.ContainsString("10.0.0.1") || c.ContainsString("10.0.0.2") {
+		t.Fatal("changing the original should not affect the clone")
+	}
+}
+
+func TestIpList_Concurrent(t *testing.T) {
+	// Change the list while looking it up, run with -race to check the data races
+	l := NewIpList()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ip := fmt.Sprintf("10.%d.0.%d", i, j)
+				l.Add(ip)
+				l.Remove(ip)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.ContainsString(fmt.Sprintf("10.%d.0.%d", i, j))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(l.Entries()) != 0 {
+		t.Fatal("the list should be empty")
+	}
+}
+
+func TestIpList_ContainsStringAllocs(t *testing.T) {
+	l := NewIpList("10.0.0.0/8")
+	if allocs := testing.AllocsPerRun(100, func() { l.ContainsString("10.1.2.3") }); allocs != 0 {
+		t.Fatalf("ContainsString allocates %v times", allocs)
+	}
+}
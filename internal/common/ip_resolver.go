@@ -0,0 +1,202 @@
+package common
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// HeaderForwarded 是 RFC 7239 定义的 Forwarded 请求头
+	// HeaderForwarded is the Forwarded request header defined by RFC 7239
+	HeaderForwarded = "Forwarded"
+
+	// HeaderXForwardedFor 是 X-Forwarded-For 请求头
+	// HeaderXForwardedFor is the X-Forwarded-For request header
+	HeaderXForwardedFor = "X-Forwarded-For"
+
+	// HeaderXRealIP 是 X-Real-IP 请求头
+	// HeaderXRealIP is the X-Real-IP request header
+	HeaderXRealIP = "X-Real-IP"
+)
+
+// DefaultIpHeaders 是默认读取客户端 IP 地址的请求头，只有受信任的代理追加的 X-Forwarded-For。代理不会改写的请求头由客户端控制，所以默认不读取
+// DefaultIpHeaders is the default request headers from which the client IP address is read, only X-Forwarded-For appended by the trusted proxy. Headers the proxy does not rewrite are controlled by the client, so they are not read by default
+var DefaultIpHeaders = []string{HeaderXForwardedFor}
+
+// IpResolver 是客户端 IP 地址的解析器。只有直接连接的对端是受信任的代理时才读取请求头，
+// 请求头中的地址从右向左检查，返回第一个不受信任的地址，所以客户端伪造的请求头不能改变解析的结果
+// IpResolver is the resolver of the client IP address. The request headers are only read when the directly connected peer is a trusted proxy,
+// the addresses in a header are checked from right to left and the first untrusted one is returned, so headers forged by the client cannot change the result
+type IpResolver struct {
+	// trustedProxies 是受信任的代理的网段
+	// trustedProxies is the networks of the trusted proxies
+	trustedProxies *IpSet
+
+	// headers 是按顺序读取的请求头
+	// headers is the request headers read in order
+	headers []string
+}
+
+// NewIpResolver 是一个函数，返回一个没有受信任的代理的解析器，它总是返回直接连接的对端的地址
+// NewIpResolver is a function that returns a resolver without trusted proxies, it always returns the address of the directly connected peer
+func NewIpResolver() *IpResolver {
+	return &IpResolver{trustedProxies: NewIpSet(), headers: DefaultIpHeaders}
+}
+
+// WithTrustedProxies 方法设置受信任的代理，每一项是一个 CIDR 网段或者一个 IP 地址，无法解析的项被忽略，并返回解析器
+// The WithTrustedProxies method sets the trusted proxies, each item is a CIDR network or an IP address, items that cannot be parsed are ignored, and returns the resolver
+func (r *IpResolver) WithTrustedProxies(proxies []string) *IpResolver {
+	r.trustedProxies = NewIpSet(proxies...)
+	return r
+}
+
+// WithHeaders 方法设置按顺序读取的请求头，并返回解析器。Forwarded 按 RFC 7239 解析，X-Real-IP 只包含一个地址，其他请求头按 X-Forwarded-For 的格式解析。
+// 设置多个请求头时使用第一个可以解析的请求头，所以只能设置受信任的代理会改写或者删除的请求头，否则客户端可以发送排在前面的请求头伪造地址
+// The WithHeaders method sets the request headers read in order, and returns the resolver. Forwarded is parsed as defined by RFC 7239, X-Real-IP contains a single address, and other headers are parsed in the format of X-Forwarded-For.
+// With multiple headers the first one that can be parsed is used, so only set headers the trusted proxy rewrites or removes, otherwise the client can forge the address by sending a header that comes earlier
+func (r *IpResolver) WithHeaders(headers []string) *IpResolver {
+	r.headers = append([]string(nil), headers...)
+	return r
+}
+
+// ClientIP 方法返回请求的客户端 IP 地址，无法解析时返回空字符串
+// The ClientIP method returns the client IP address of the request, an empty string is returned when it cannot be resolved
+func (r *IpResolver) ClientIP(req *http.Request) string {
+	// 解析直接连接的对端的地址，对端不是受信任的代理时不读取请求头
+	// Parse the address of the directly connected peer, the request headers are not read when the peer is not a trusted proxy
+	remote := remoteIP(req.RemoteAddr)
+	addr, err := netip.ParseAddr(remote)
+	if err != nil {
+		return ""
+	}
+	if !r.isTrusted(addr) {
+		return remote
+	}
+
+	// 按顺序读取请求头，使用第一个可以解析的请求头
+	// Read the request headers in order, and use the first one that can be parsed
+	for _, header := range r.headers {
+		values := req.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+
+		var ip string
+		var ok bool
+		switch http.CanonicalHeaderKey(header) {
+		case HeaderForwarded:
+			ip, ok = r.rightmostUntrusted(forwardedFor(values))
+		case http.CanonicalHeaderKey(HeaderXRealIP):
+			ip, ok = r.rightmostUntrusted([]string{strings.TrimSpace(values[0])})
+		default:
+			ip, ok = r.rightmostUntrusted(splitValues(values))
+		}
+		if ok {
+			return ip
+		}
+	}
+
+	return remote
+}
+
+// rightmostUntrusted 方法从右向左检查地址链，返回第一个不受信任的地址。所有的地址都受信任时返回最左边的地址，
+// 遇到无法解析的地址时返回 false，因为它左边的地址都可能是伪造的
+// The rightmostUntrusted method checks the address chain from right to left, and returns the first untrusted address. The leftmost address is returned when all addresses are trusted,
+// false is returned when an address cannot be parsed, because all addresses to its left may be forged
+func (r *IpResolver) rightmostUntrusted(chain []string) (string, bool) {
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(chain[i])
+		if err != nil {
+			return "", false
+		}
+		if i == 0 || !r.isTrusted(addr) {
+			return chain[i], true
+		}
+	}
+	return "", false
+}
+
+// isTrusted 方法判断地址是否属于受信任的代理
+// The isTrusted method reports whether the address belongs to a trusted proxy
+func (r *IpResolver) isTrusted(addr netip.Addr) bool {
+	return r.trustedProxies.Contains(addr)
+}
+
+// remoteIP 是一个函数，返回 "host:port" 形式的远程地址中的主机部分，没有端口时返回去掉空白的地址
+// remoteIP is a function that returns the host part of a remote address of the form "host:port", the address without surrounding spaces is returned when there is no port
+func remoteIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(strings.TrimSpace(remoteAddr)); err == nil {
+		return host
+	}
+	return strings.TrimSpace(remoteAddr)
+}
+
+// splitValues 是一个函数，将多个以逗号分隔的请求头的值按顺序拆分为地址链
+// splitValues is a function that splits multiple comma separated header values into an address chain in order
+func splitValues(values []string) []string {
+	chain := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			chain = append(chain, strings.TrimSpace(part))
+		}
+	}
+	return chain
+}
+
+// forwardedFor 是一个函数，按顺序返回 Forwarded 请求头中每个元素的 for 参数中的地址，去掉引号、方括号和端口。
+// 没有 for 参数的元素返回空字符串，使地址链在这里中断
+// forwardedFor is a function that returns the addresses in the for parameter of each element of the Forwarded header in order, without quotes, brackets and ports.
+// An empty string is returned for an element without the for parameter, so that the address chain breaks there
+func forwardedFor(values []string) []string {
+	chain := []string{}
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			addr := ""
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(strings.TrimSpace(key), "for") {
+					addr = forwardedAddr(strings.TrimSpace(val))
+				}
+			}
+			chain = append(chain, addr)
+		}
+	}
+	return chain
+}
+
+// forwardedAddr 是一个函数，去掉 Forwarded 请求头中节点标识的引号、方括号和端口，例如 "[2001:db8::1]:4711" 返回 2001:db8::1
+// forwardedAddr is a function that removes the quotes, brackets and port of a node identifier in the Forwarded header, e.g. "[2001:db8::1]:4711" returns 2001:db8::1
+func forwardedAddr(node string) string {
+	node = strings.Trim(node, `"`)
+	if strings.HasPrefix(node, "[") {
+		if end := strings.IndexByte(node, ']'); end > 0 {
+			return node[1:end]
+		}
+		return ""
+	}
+	if host, _, found := strings.Cut(node, ":"); found {
+		return host
+	}
+	return node
+}
+
+// splitQuoted 是一个函数，按分隔符拆分字符串，忽略引号内的分隔符
+// splitQuoted is a function that splits the string by the separator, ignoring separators within quotes
+func splitQuoted(s string, sep byte) []string {
+	parts := []string{}
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
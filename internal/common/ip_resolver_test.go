@@ -0,0 +1,117 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testIpRequest(remoteAddr string, headers map[string][]string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, TestUrlPath, nil)
+	req.RemoteAddr = remoteAddr
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return req
+}
+
+func TestIpResolver_ClientIP(t *testing.T) {
+	resolver := NewIpResolver().WithTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32", "invalid"})
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.1:80", map[string][]string{HeaderXForwardedFor: {"1.1.1.1"}}, "203.0.113.1"},
+		{"trusted peer without headers", "10.0.0.1:80", nil, "10.0.0.1"},
+		{"single address", "10.0.0.1:80", map[string][]string{HeaderXForwardedFor: {"1.1.1.1"}}, "1.1.1.1"},
+		{"spoofed leftmost address", "10.0.0.1:80", map[string][]string{HeaderXForwardedFor: {"6.6.6.6, 1.1.1.1, 10.0.0.2"}}, "1.1.1.1"},
+		{"multiple header lines", "10.0.0.1:80", map[string][]string{HeaderXForwardedFor: {"6.6.6.6", "1.1.1.1, 192.168.1.1"}}, "1.1.1.1"},
+		{"all trusted", "10.0.0.1:80", map[string][]string{HeaderXForwardedFor: {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"invalid address", "10.0.0.1:80", map[string][]string{HeaderXForwardedFor: {"1.1.1.1, unknown"}}, "10.0.0.1"},
+		{"forged forwarded is ignored", "10.0.0.1:80", map[string][]string{HeaderForwarded: {"for=9.9.9.9"}, HeaderXForwardedFor: {"1.1.1.1"}}, "1.1.1.1"},
+		{"forged real ip is ignored", "10.0.0.1:80", map[string][]string{HeaderXRealIP: {"9.9.9.9"}}, "10.0.0.1"},
+		{"ipv6 trusted peer", "[2001:db8::1]:80", map[string][]string{HeaderXForwardedFor: {"1.1.1.1"}}, "1.1.1.1"},
+		{"ipv4-mapped trusted peer", "[::ffff:10.0.0.1]:80", map[string][]string{HeaderXForwardedFor: {"1.1.1.1"}}, "1.1.1.1"},
+		{"remote without port", "203.0.113.1", nil, "203.0.113.1"},
+		{"invalid remote", "invalid", map[string][]string{HeaderXForwardedFor: {"1.1.1.1"}}, ""},
+	}
+
+	for _, c := range cases {
+		if got := resolver.ClientIP(testIpRequest(c.remoteAddr, c.headers)); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestIpResolver_MultipleHeaders(t *testing.T) {
+	// Reading several headers is an explicit opt-in for proxies that rewrite all of them
+	resolver := NewIpResolver().WithTrustedProxies([]string{"10.0.0.0/8"}).WithHeaders([]string{HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP})
+
+	cases := []struct {
+		name    string
+		headers map[string][]string
+		want    string
+	}{
+		{"invalid address falls through", map[string][]string{HeaderXForwardedFor: {"1.1.1.1, unknown"}, HeaderXRealIP: {"2.2.2.2"}}, "2.2.2.2"},
+		{"real ip", map[string][]string{HeaderXRealIP: {" 2.2.2.2 "}}, "2.2.2.2"},
+		{"forwarded", map[string][]string{HeaderForwarded: {`for=6.6.6.6, for="[2001:db9::1]:4711";proto=https, For=10.0.0.2:80;by=10.0.0.1`}}, "2001:db9::1"},
+		{"forwarded before x-forwarded-for", map[string][]string{HeaderForwarded: {"for=3.3.3.3"}, HeaderXForwardedFor: {"1.1.1.1"}}, "3.3.3.3"},
+		{"forwarded obfuscated", map[string][]string{HeaderForwarded: {"for=_hidden"}, HeaderXForwardedFor: {"1.1.1.1"}}, "1.1.1.1"},
+		{"forwarded without for", map[string][]string{HeaderForwarded: {"for=6.6.6.6, proto=http"}}, "10.0.0.1"},
+	}
+
+	for _, c := range cases {
+		if got := resolver.ClientIP(testIpRequest("10.0.0.1:80", c.headers)); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestIpResolver_WithHeaders(t *testing.T) {
+	resolver := NewIpResolver().WithTrustedProxies([]string{"10.0.0.0/8"}).WithHeaders([]string{"CF-Connecting-IP"})
+
+	// Only the configured headers are read
+	req := testIpRequest("10.0.0.1:80", map[string][]string{HeaderXForwardedFor: {"1.1.1.1"}})
+	if got := resolver.ClientIP(req); got != "10.0.0.1" {
+		t.Errorf("got %q, want %q", got, "10.0.0.1")
+	}
+	req = testIpRequest("10.0.0.1:80", map[string][]string{"Cf-Connecting-Ip": {"4.4.4.4"}})
+	if got := resolver.ClientIP(req); got != "4.4.4.4" {
+		t.Errorf("got %q, want %q", got, "4.4.4.4")
+	}
+
+	// A resolver without trusted proxies always uses the peer
+	req = testIpRequest("10.0.0.1:80", map[string][]string{HeaderXForwardedFor: {"1.1.1.1"}})
+	if got := NewIpResolver().ClientIP(req); got != "10.0.0.1" {
+		t.Errorf("got %q, want %q", got, "10.0.0.1")
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	cases := map[string]string{
+		"10.1.2.3/8":          "10.0.0.0/8",
+		"::ffff:10.0.0.0/104": "10.0.0.0/8",
+		"192.168.1.1":         "192.168.1.1/32",
+		"::ffff:192.168.1.1":  "192.168.1.1/32",
+		"2001:db8::1":         "2001:db8::1/128",
+		" 2001:db8::/32 ":     "2001:db8::/32",
+		"::ffff:10.0.0.0/64":  "::/64",
+	}
+	for s, want := range cases {
+		prefix, ok := parsePrefix(s)
+		if !ok || prefix.String() != want {
+			t.Errorf("parsePrefix(%q) = %v, %v, want %s", s, prefix, ok, want)
+		}
+	}
+
+	for _, s := range []string{"", "invalid", "10.0.0.0/33"} {
+		if _, ok := parsePrefix(s); ok {
+			t.Errorf("parsePrefix(%q) should fail", s)
+		}
+	}
+}
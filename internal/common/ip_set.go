@@ -0,0 +1,180 @@
+package common
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// ipSetNode 是二叉前缀树的节点，第 i 层的节点对应地址的前 i 位
+// ipSetNode is a node of the binary prefix trie, a node at depth i corresponds to the first i bits of an address
+type ipSetNode struct {
+	// children 是下一位为 0 和 1 的子节点
+	// children is the child nodes whose next bit is 0 and 1
+	children [2]*ipSetNode
+
+	// terminal 表示从根节点到这个节点的前缀在集合中，它下面的所有地址都在集合中
+	// terminal indicates that the prefix from the root to this node is in the set, and all addresses below it are in the set
+	terminal bool
+}
+
+// IpSet 是 IP 地址和网段的集合，零值是一个空的集合，使用 IPv4 和 IPv6 各一棵二叉前缀树存储。IPv4 映射的 IPv6 地址被当作 IPv4 地址，查询不分配内存。
+// 集合在添加完成之后可以被并发地查询，添加和查询不能并发
+// IpSet is a set of IP addresses and networks, its zero value is an empty set, stored in one binary prefix trie for IPv4 and one for IPv6. IPv4-mapped IPv6 addresses are treated as IPv4 addresses, and lookups do not allocate memory.
+// The set can be queried concurrently once it is filled, adding and querying must not happen concurrently
+type IpSet struct {
+	// v4 是 IPv4 前缀树的根节点
+	// v4 is the root of the IPv4 trie
+	v4 ipSetNode
+
+	// v6 是 IPv6 前缀树的根节点
+	// v6 is the root of the IPv6 trie
+	v6 ipSetNode
+
+	// used 表示集合中是否添加过网段，没有时查询不需要解析地址
+	// used indicates whether a network has been added to the set, lookups do not need to parse the address when none has
+	used bool
+}
+
+// NewIpSet 是一个函数，返回一个包含指定 IP 地址和 CIDR 网段的集合，无法解析的项被忽略
+// NewIpSet is a function that returns a set containing the specified IP addresses and CIDR networks, items that cannot be parsed are ignored
+func NewIpSet(entries ...string) *IpSet {
+	s := &IpSet{}
+	for _, entry := range entries {
+		s.Add(entry)
+	}
+	return s
+}
+
+// Add 方法向集合添加一个 IP 地址或者 CIDR 网段，例如 "10.0.0.1"、"10.0.0.0/8" 或者 "2001:db8::/48"，返回是否可以解析
+// The Add method adds an IP address or a CIDR network to the set, e.g. "10.0.0.1", "10.0.0.0/8" or "2001:db8::/48", and returns whether it can be parsed
+func (s *IpSet) Add(entry string) bool {
+	prefix, ok := parsePrefix(entry)
+	if ok {
+		s.AddPrefix(prefix)
+	}
+	return ok
+}
+
+// AddPrefix 方法向集合添加一个网段，已经被集合中的网段包含的网段不会改变集合
+// The AddPrefix method adds a network to the set, a network already covered by a network in the set does not change the set
+func (s *IpSet) AddPrefix(prefix netip.Prefix) {
+	if !prefix.IsValid() {
+		return
+	}
+
+	// 统一 IPv4 映射的网段，并去掉区域
+	// Normalize IPv4-mapped networks, and drop the zone
+	addr, bits := prefix.Addr(), prefix.Bits()
+	if addr.Is4In6() && bits >= 96 {
+		addr, bits = addr.Unmap(), bits-96
+	}
+	addr = addr.WithZone("")
+	s.used = true
+
+	// 沿着网段的每一位向下创建节点，途中遇到集合中的网段时说明已经被包含
+	// Create nodes down along each bit of the network, meeting a network of the set on the way means it is already covered
+	node := s.root(addr)
+	for i := 0; i < bits; i++ {
+		if node.terminal {
+			return
+		}
+		bit := bitAt(addr, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &ipSetNode{}
+		}
+		node = node.children[bit]
+	}
+
+	// 标记网段，它下面更长的网段都被包含，不再需要
+	// Mark the network, the longer networks below it are all covered and no longer needed
+	node.terminal = true
+	node.children = [2]*ipSetNode{}
+}
+
+// Contains 方法判断地址是否在集合中，不分配内存
+// The Contains method reports whether the address is in the set, without allocating memory
+func (s *IpSet) Contains(addr netip.Addr) bool {
+	if !s.used || !addr.IsValid() {
+		return false
+	}
+
+	// 沿着地址的每一位向下查找，遇到集合中的网段时地址在集合中
+	// Look down along each bit of the address, the address is in the set when a network of the set is met
+	addr = addr.Unmap()
+	node := s.root(addr)
+	for i, n := 0, addr.BitLen(); ; i++ {
+		if node.terminal {
+			return true
+		}
+		if i == n {
+			return false
+		}
+		if node = node.children[bitAt(addr, i)]; node == nil {
+			return false
+		}
+	}
+}
+
+// ContainsString 方法判断字符串形式的地址是否在集合中，无法解析的地址不在集合中。IPv4 地址和不带区域的 IPv6 地址的查询不分配内存
+// The ContainsString method reports whether the address in string form is in the set, addresses that cannot be parsed are not in the set. Lookups of IPv4 addresses and IPv6 addresses without a zone do not allocate memory
+func (s *IpSet) ContainsString(ip string) bool {
+	if !s.used {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && s.Contains(addr)
+}
+
+// IsEmpty 方法判断集合是否为空
+// The IsEmpty method reports whether the set is empty
+func (s *IpSet) IsEmpty() bool {
+	return !s.used
+}
+
+// parsePrefix 是一个函数，将 CIDR 网段或者 IP 地址解析为网段，IP 地址被解析为只包含它自己的网段
+// parsePrefix is a function that parses a CIDR network or an IP address as a network, an IP address is parsed as a network containing only itself
+func parsePrefix(s string) (netip.Prefix, bool) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		// IPv4 映射的网段只有在长度至少为 96 时才对应一个 IPv4 网段，更短的网段保持为 IPv6 网段
+		// An IPv4-mapped network only corresponds to an IPv4 network when its length is at least 96, shorter networks are kept as IPv6 networks
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		if !prefix.IsValid() {
+			return netip.Prefix{}, false
+		}
+		return prefix.Masked(), true
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+// root 方法返回地址所在的前缀树的根节点
+// The root method returns the root of the trie the address belongs to
+func (s *IpSet) root(addr netip.Addr) *ipSetNode {
+	if addr.Is4() {
+		return &s.v4
+	}
+	return &s.v6
+}
+
+// bitAt 是一个函数，返回地址从高位开始的第 i 位
+// bitAt is a function that returns the i-th bit of the address counted from the most significant bit
+func bitAt(addr netip.Addr, i int) int {
+	if addr.Is4() {
+		b := addr.As4()
+		return int(b[i/8]>>(7-i%8)) & 1
+	}
+	b := addr.As16()
+	return int(b[i/8]>>(7-i%8)) & 1
+}
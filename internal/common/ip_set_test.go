@@ -0,0 +1,90 @@
+package common
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIpSet_Contains(t *testing.T) {
+	s := NewIpSet("10.0.0.0/8", "192.168.1.1", "::ffff:172.16.0.0/108", "2001:db8:1::/48", "fe80::1", "invalid")
+
+	cases := map[string]bool{
+		"10.0.0.1":           true,
+		"10.255.255.255":     true,
+		"11.0.0.1":           false,
+		"192.168.1.1":        true,
+		"192.168.1.2":        false,
+		"::ffff:192.168.1.1": true,
+		"::ffff:10.1.2.3":    true,
+		"172.16.5.5":         true,
+		"172.32.0.1":         false,
+		"2001:db8:1:ffff::1": true,
+		"2001:db8:2::1":      false,
+		"fe80::1":            true,
+		"fe80::1%eth0":       true,
+		"fe80::2":            false,
+		"":                   false,
+		"invalid":            false,
+	}
+	for ip, want := range cases {
+		if got := s.ContainsString(ip); got != want {
+			t.Errorf("ContainsString(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestIpSet_Add(t *testing.T) {
+	// The zero value is an empty set
+	var s IpSet
+	if !s.IsEmpty() || s.ContainsString("10.0.0.1") || s.Contains(netip.Addr{}) {
+		t.Fatal("the zero value should be empty")
+	}
+	if s.Add("invalid") || !s.IsEmpty() {
+		t.Fatal("an invalid entry should not be added")
+	}
+
+	// A network covering existing addresses replaces them, and covered networks change nothing
+	s.Add("10.1.2.3")
+	s.Add("10.1.0.0/16")
+	s.Add("10.1.2.0/24")
+	if s.IsEmpty() || !s.ContainsString("10.1.2.3") || !s.ContainsString("10.1.200.1") || s.ContainsString("10.2.0.1") {
+		t.Fatal("unexpected lookup result")
+	}
+
+	// An IPv4-mapped network shorter than 96 bits is kept as an IPv6 network, instead of being dropped
+	var mapped IpSet
+	if !mapped.Add("::ffff:0:0/80") || !mapped.ContainsString("::1") || mapped.ContainsString("10.0.0.1") {
+		t.Fatal("unexpected lookup result")
+	}
+	mapped.Add("::ffff:0:0/96")
+	if !mapped.ContainsString("10.0.0.1") {
+		t.Fatal("unexpected lookup result")
+	}
+
+	// A network of length 0 covers the whole family
+	s.AddPrefix(netip.MustParsePrefix("::/0"))
+	if !s.ContainsString("2001:db8::1") || s.ContainsString("11.0.0.1") {
+		t.Fatal("unexpected lookup result")
+	}
+}
+
+func TestIpSet_ContainsAllocs(t *testing.T) {
+	s := NewIpSet("10.0.0.0/8", "2001:db8::/32")
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = s.ContainsString("10.1.2.3")
+		_ = s.ContainsString("2001:db8::1")
+		_ = s.ContainsString("192.168.0.1")
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs, want 0", allocs)
+	}
+}
+
+func BenchmarkIpSet_ContainsString(b *testing.B) {
+	s := NewIpSet("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "2001:db8::/32")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = s.ContainsString("192.168.100.1")
+	}
+}
@@ -0,0 +1,224 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProxyHeaderTimeout 是默认读取 PROXY 协议头的超时时间
+// DefaultProxyHeaderTimeout is the default timeout for reading the PROXY protocol header
+var DefaultProxyHeaderTimeout = 5 * time.Second
+
+// ErrInvalidProxyHeader 是 PROXY 协议头无法解析时返回的错误
+// ErrInvalidProxyHeader is the error returned when the PROXY protocol header cannot be parsed
+var ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// proxyV2Signature 是 PROXY 协议第 2 版的协议头签名
+// proxyV2Signature is the header signature of version 2 of the PROXY protocol
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyV1MaxLength 是 PROXY 协议第 1 版的协议头的最大长度，包括结尾的 CRLF
+// proxyV1MaxLength is the maximum length of a version 1 PROXY protocol header, including the trailing CRLF
+const proxyV1MaxLength = 107
+
+// WrapListener 方法返回一个接受 PROXY 协议 (第 1 版和第 2 版) 的监听器。来自受信任的代理的连接如果以 PROXY 协议头开始，
+// 连接的 RemoteAddr 返回协议头中的源地址，所以 http.Request 的 RemoteAddr 是代理之前的客户端地址。其他连接不会被读取协议头，保持原来的地址
+// The WrapListener method returns a listener that accepts the PROXY protocol (versions 1 and 2). When a connection from a trusted proxy starts with a PROXY protocol header,
+// the RemoteAddr of the connection returns the source address in the header, so the RemoteAddr of http.Request is the client address before the proxy. Headers are not read from other connections, which keep their addresses
+func (r *IpResolver) WrapListener(l net.Listener) net.Listener {
+	return &proxyListener{Listener: l, resolver: r}
+}
+
+// proxyListener 是接受 PROXY 协议的监听器
+// proxyListener is the listener that accepts the PROXY protocol
+type proxyListener struct {
+	net.Listener
+
+	// resolver 是判断代理是否受信任的解析器
+	// resolver is the resolver that decides whether a proxy is trusted
+	resolver *IpResolver
+}
+
+// Accept 方法接受一个连接。协议头在第一次读取或者获取远程地址时才读取，所以不会阻塞接受连接的协程
+// The Accept method accepts a connection. The header is read on the first read or the first call for the remote address, so the goroutine accepting connections is not blocked
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	// 只读取受信任的代理发送的协议头
+	// Only read headers sent by trusted proxies
+	addr, err := netip.ParseAddr(remoteIP(conn.RemoteAddr().String()))
+	if err != nil || !l.resolver.isTrusted(addr) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn 是可能以 PROXY 协议头开始的连接
+// proxyConn is a connection that may start with a PROXY protocol header
+type proxyConn struct {
+	net.Conn
+
+	// reader 是读取连接的缓冲读取器，协议头之后的数据从这里读取
+	// reader is the buffered reader of the connection, the data after the header is read from it
+	reader *bufio.Reader
+
+	// once 确保协议头只被读取一次
+	// once ensures that the header is read only once
+	once sync.Once
+
+	// remote 是协议头中的源地址，没有协议头时为 nil
+	// remote is the source address in the header, it is nil when there is no header
+	remote net.Addr
+
+	// err 是读取协议头的错误
+	// err is the error of reading the header
+	err error
+}
+
+// readHeader 方法在超时时间内读取协议头
+// The readHeader method reads the header within the timeout
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(DefaultProxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.reader)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+// Read 方法读取协议头之后的数据，协议头无法解析时返回错误
+// The Read method reads the data after the header, an error is returned when the header cannot be parsed
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr 方法返回协议头中的源地址，没有协议头时返回连接的对端地址
+// The RemoteAddr method returns the source address in the header, the peer address of the connection is returned when there is no header
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader 是一个函数，读取 PROXY 协议头并返回其中的源地址。连接没有以协议头开始时不读取任何数据并返回 nil，
+// 协议头是 LOCAL 命令或者地址族不是 TCP 时返回 nil
+// readProxyHeader is a function that reads the PROXY protocol header and returns the source address in it. Nothing is read and nil is returned when the connection does not start with a header,
+// nil is returned when the header has the LOCAL command or the address family is not TCP
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	// 根据开头的字节判断协议的版本，连接在发送任何数据之前关闭时不是错误
+	// Tell the version of the protocol by the leading bytes, it is not an error when the connection is closed before sending any data
+	prefix, err := r.Peek(len(proxyV2Signature))
+	if bytes.Equal(prefix, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(prefix, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	if err != nil && !errors.Is(err, io.EOF) && len(prefix) == 0 {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// readProxyV1 是一个函数，读取第 1 版的文本协议头，例如 "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+// readProxyV1 is a function that reads a version 1 text header, e.g. "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	// 读取到行尾，协议头不能超过最大长度
+	// Read up to the end of the line, the header cannot exceed the maximum length
+	line := make([]byte, 0, proxyV1MaxLength)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == proxyV1MaxLength {
+			return nil, ErrInvalidProxyHeader
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidProxyHeader
+		}
+		line = append(line, b)
+	}
+
+	// 解析协议、源地址和源端口，UNKNOWN 协议使用连接的对端地址
+	// Parse the protocol, the source address and the source port, the connection peer address is used for the UNKNOWN protocol
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidProxyHeader
+	}
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil || addr.Is4() != (fields[1] == "TCP4") {
+		return nil, ErrInvalidProxyHeader
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(port))), nil
+}
+
+// readProxyV2 是一个函数，读取第 2 版的二进制协议头，协议头之后的 TLV 被忽略
+// readProxyV2 is a function that reads a version 2 binary header, the TLVs after the addresses are ignored
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	// 读取固定长度的部分：签名、版本和命令、地址族和协议、地址的长度
+	// Read the fixed length part: the signature, the version and command, the address family and protocol, and the length of the addresses
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+	verCmd, family := header[12], header[13]
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// 只支持第 2 版，LOCAL 命令表示连接来自代理自身，使用连接的对端地址
+	// Only version 2 is supported, the LOCAL command means the connection comes from the proxy itself, and the connection peer address is used
+	if verCmd>>4 != 2 {
+		return nil, ErrInvalidProxyHeader
+	}
+	switch verCmd & 0x0f {
+	case 0x0:
+		return nil, nil
+	case 0x1:
+	default:
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// 解析 TCP over IPv4 和 TCP over IPv6 的源地址和源端口，其他地址族使用连接的对端地址
+	// Parse the source address and port of TCP over IPv4 and TCP over IPv6, the connection peer address is used for other families
+	switch family {
+	case 0x11:
+		if len(body) < 12 {
+			return nil, ErrInvalidProxyHeader
+		}
+		addr := netip.AddrFrom4([4]byte{body[0], body[1], body[2], body[3]})
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, binary.BigEndian.Uint16(body[8:10]))), nil
+	case 0x21:
+		if len(body) < 36 {
+			return nil, ErrInvalidProxyHeader
+		}
+		var ip [16]byte
+		copy(ip[:], body[:16])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(netip.AddrFrom16(ip), binary.BigEndian.Uint16(body[32:34]))), nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,133 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// testProxyConn sends data over a connection accepted by the wrapped listener, and returns the remote address and the data seen by the server
+func testProxyConn(t *testing.T, resolver *IpResolver, data []byte) (string, string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = resolver.WrapListener(l)
+	defer l.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write(data)
+	}()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	remote := conn.RemoteAddr().String()
+	body, err := io.ReadAll(conn)
+	return remote, string(body), err
+}
+
+func testProxyV2Header(cmd, family byte, addrs []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+func TestProxyListener_V1(t *testing.T) {
+	resolver := NewIpResolver().WithTrustedProxies([]string{"127.0.0.1"})
+
+	remote, body, err := testProxyConn(t, resolver, []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n"))
+	if err != nil || remote != "192.0.2.1:56324" || body != "GET / HTTP/1.1\r\n" {
+		t.Errorf("got %q, %q, %v", remote, body, err)
+	}
+
+	remote, _, err = testProxyConn(t, resolver, []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"))
+	if err != nil || remote != "[2001:db8::1]:56324" {
+		t.Errorf("got %q, %v", remote, err)
+	}
+
+	// The UNKNOWN protocol keeps the peer address
+	remote, body, err = testProxyConn(t, resolver, []byte("PROXY UNKNOWN\r\nping"))
+	if err != nil || !strings.HasPrefix(remote, "127.0.0.1:") || body != "ping" {
+		t.Errorf("got %q, %q, %v", remote, body, err)
+	}
+
+	// An invalid header fails the connection
+	for _, header := range []string{"PROXY TCP4 2001:db8::1 192.0.2.2 1 2\r\n", "PROXY TCP4 192.0.2.1\r\n", "PROXY " + strings.Repeat("x", 120)} {
+		if _, _, err = testProxyConn(t, resolver, []byte(header)); !errors.Is(err, ErrInvalidProxyHeader) {
+			t.Errorf("%q: got %v", header, err)
+		}
+	}
+}
+
+func TestProxyListener_V2(t *testing.T) {
+	resolver := NewIpResolver().WithTrustedProxies([]string{"127.0.0.0/8"})
+
+	// TCP over IPv4 with a TLV after the addresses
+	addrs := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb, 0x04, 0x00, 0x01, 0x00}
+	remote, body, err := testProxyConn(t, resolver, append(testProxyV2Header(0x1, 0x11, addrs), "ping"...))
+	if err != nil || remote != "192.0.2.1:56324" || body != "ping" {
+		t.Errorf("got %q, %q, %v", remote, body, err)
+	}
+
+	// TCP over IPv6
+	addrs = make([]byte, 36)
+	copy(addrs, net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(addrs[32:], 56324)
+	remote, _, err = testProxyConn(t, resolver, testProxyV2Header(0x1, 0x21, addrs))
+	if err != nil || remote != "[2001:db8::1]:56324" {
+		t.Errorf("got %q, %v", remote, err)
+	}
+
+	// The LOCAL command keeps the peer address
+	remote, body, err = testProxyConn(t, resolver, append(testProxyV2Header(0x0, 0x00, nil), "ping"...))
+	if err != nil || !strings.HasPrefix(remote, "127.0.0.1:") || body != "ping" {
+		t.Errorf("got %q, %q, %v", remote, body, err)
+	}
+
+	// Truncated addresses fail the connection
+	if _, _, err = testProxyConn(t, resolver, testProxyV2Header(0x1, 0x11, []byte{192, 0, 2, 1})); !errors.Is(err, ErrInvalidProxyHeader) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestProxyListener_Untrusted(t *testing.T) {
+	// Connections without a header keep their address and data
+	remote, body, err := testProxyConn(t, NewIpResolver().WithTrustedProxies([]string{"127.0.0.1"}), []byte("GET / HTTP/1.1\r\n"))
+	if err != nil || !strings.HasPrefix(remote, "127.0.0.1:") || body != "GET / HTTP/1.1\r\n" {
+		t.Errorf("got %q, %q, %v", remote, body, err)
+	}
+
+	// Headers from untrusted peers are not parsed
+	header := "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+	remote, body, err = testProxyConn(t, NewIpResolver(), []byte(header))
+	if err != nil || !strings.HasPrefix(remote, "127.0.0.1:") || body != header {
+		t.Errorf("got %q, %q, %v", remote, body, err)
+	}
+}
+
+func TestReadProxyHeader_Short(t *testing.T) {
+	// A connection closed after a few bytes is not an error
+	r := bufio.NewReader(bytes.NewReader([]byte("GET")))
+	addr, err := readProxyHeader(r)
+	if addr != nil || err != nil {
+		t.Errorf("got %v, %v", addr, err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "GET" {
+		t.Errorf("got %q", rest)
+	}
+}
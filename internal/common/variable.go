@@ -19,9 +19,9 @@ var (
 	// Default local IPv6 address
 	DefaultLocalIpv6Address = "::1"
 
-	// 默认IP白名单
-	// Default IP whitelist
-	DefaultIpWhitelist = map[string]struct{}{}
+	// 默认IP白名单中的项，每个配置复制一份自己的白名单，所以修改一个配置的白名单不会影响其他配置
+	// Default items of the IP whitelist, each configuration copies its own whitelist, so changing the whitelist of one configuration does not affect others
+	DefaultIpWhitelist = []string{}
 
 	// 默认匹配函数
 	// Default match function
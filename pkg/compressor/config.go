@@ -39,6 +39,16 @@ var DefaultWriterCreateFunc = func(config *Config, rw gin.ResponseWriter) any {
 	return NewGZipWriter(config, rw)
 }
 
+// IpResolver 是客户端 IP 地址的解析器，支持受信任的代理、X-Forwarded-For 请求头 (可以设置为 X-Real-IP、Forwarded 等请求头) 和 PROXY 协议
+// IpResolver is the resolver of the client IP address, supporting trusted proxies, the X-Forwarded-For header (X-Real-IP, Forwarded and other headers can be configured) and the PROXY protocol
+type IpResolver = com.IpResolver
+
+// NewIpResolver 创建一个没有受信任的代理的解析器，使用 WithTrustedProxies 方法设置受信任的代理
+// NewIpResolver creates a resolver without trusted proxies, use the WithTrustedProxies method to set the trusted proxies
+func NewIpResolver() *IpResolver {
+	return com.NewIpResolver()
+}
+
 // Config 是一个配置结构体，包含压缩等级、IP白名单、匹配函数和创建压缩写入器的函数
 // Config is a struct of config, including compression level, IP whitelist, match function and function to create a compression writer
 type Config struct {
@@ -48,7 +58,11 @@ type Config struct {
 
 	// Ip 白名单
 	// Ip whitelist
-	ipWhitelist map[string]struct{}
+	ipWhitelist *com.IpList
+
+	// 客户端 IP 地址的解析器，为 nil 时使用 gin.Context 的 ClientIP 方法
+	// Resolver of the client IP address, the ClientIP method of gin.Context is used when it is nil
+	ipResolver *IpResolver
 
 	// 匹配函数，用于匹配 HTTP 请求头
 	// Match function, used to match HTTP request headers
@@ -71,7 +85,7 @@ func NewConfig() *Config {
 
 		// 设置默认的 IP 白名单
 		// Sets the default IP whitelist
-		ipWhitelist: com.DefaultIpWhitelist,
+		ipWhitelist: com.NewIpList(com.DefaultIpWhitelist...),
 
 		// 设置默认的匹配函数
 		// Sets the default match function
@@ -110,15 +124,29 @@ func (c *Config) WithMatchFunc(fn com.HttpRequestHeaderMatchFunc) *Config {
 	return c
 }
 
-// WithIpWhitelist 设置 IP 白名单，并返回配置实例
-// WithIpWhitelist sets the IP whitelist and returns the config instance
+// WithIpWhitelist 设置 IP 白名单，并返回配置实例。每一项是一个 IP 地址或者 CIDR 网段，无法解析的项被忽略
+// WithIpWhitelist sets the IP whitelist and returns the config instance. Each item is an IP address or a CIDR network, items that cannot be parsed are ignored
 func (c *Config) WithIpWhitelist(whitelist []string) *Config {
-	for _, ip := range whitelist {
-		c.ipWhitelist[ip] = com.Empty
-	}
+	c.ipWhitelist.Add(whitelist...)
+	return c
+}
+
+// WithIpResolver 设置 IP 白名单使用的客户端 IP 地址的解析器，并返回配置实例。为 nil 时使用 gin.Context 的 ClientIP 方法，它的结果取决于 gin 引擎的设置
+// WithIpResolver sets the resolver of the client IP address used by the IP whitelist and returns the config instance. The ClientIP method of gin.Context is used when it is nil, whose result depends on the settings of the gin engine
+func (c *Config) WithIpResolver(resolver *IpResolver) *Config {
+	c.ipResolver = resolver
 	return c
 }
 
+// clientIP 返回请求的客户端 IP 地址
+// clientIP returns the client IP address of the request
+func (c *Config) clientIP(ctx *gin.Context) string {
+	if c.ipResolver == nil {
+		return ctx.ClientIP()
+	}
+	return c.ipResolver.ClientIP(ctx.Request)
+}
+
 // isConfigValid 检查配置是否有效
 // isConfigValid checks whether the config is valid
 func isConfigValid(config *Config) *Config {
@@ -154,7 +182,7 @@ func isConfigValid(config *Config) *Config {
 		if config.ipWhitelist == nil {
 			// 设置 IP 白名单为默认的白名单
 			// Sets the IP whitelist to the default whitelist
-			config.ipWhitelist = com.DefaultIpWhitelist
+			config.ipWhitelist = com.NewIpList(com.DefaultIpWhitelist...)
 		}
 	} else {
 		// 如果配置为空，设置配置为默认的配置
@@ -48,6 +48,24 @@ func NewCompressor(config *Config) *Compressor {
 	}
 }
 
+// AddIp 向 IP 白名单添加 IP 地址和 CIDR 网段，无法解析的项被忽略，之后的请求立即生效
+// AddIp adds IP addresses and CIDR networks to the IP whitelist, items that cannot be parsed are ignored, and it takes effect immediately for later requests
+func (c *Compressor) AddIp(ips ...string) {
+	c.config.ipWhitelist.Add(ips...)
+}
+
+// RemoveIp 从 IP 白名单删除之前添加的 IP 地址和 CIDR 网段
+// RemoveIp removes IP addresses and CIDR networks added before from the IP whitelist
+func (c *Compressor) RemoveIp(ips ...string) {
+	c.config.ipWhitelist.Remove(ips...)
+}
+
+// ReplaceIpList 使用指定的 IP 地址和 CIDR 网段替换 IP 白名单
+// ReplaceIpList replaces the IP whitelist with the specified IP addresses and CIDR networks
+func (c *Compressor) ReplaceIpList(ips []string) {
+	c.config.ipWhitelist.Replace(ips)
+}
+
 // HandlerFunc 返回一个 gin.HandlerFunc，用于处理请求
 // HandlerFunc returns a gin.HandlerFunc for processing requests
 func (c *Compressor) HandlerFunc() gin.HandlerFunc {
@@ -62,11 +80,11 @@ func (c *Compressor) HandlerFunc() gin.HandlerFunc {
 
 			// 获取客户端 IP 地址
 			// Get the client IP address
-			clientIP := ctx.ClientIP()
+			clientIP := c.config.clientIP(ctx)
 
 			// 如果客户端 IP 地址不在配置的 IP 白名单中，则进行下一步处理
 			// If the client IP address is not in the IP whitelist in the configuration, then proceed to the next step
-			if _, ok := c.config.ipWhitelist[clientIP]; !ok {
+			if !c.config.ipWhitelist.ContainsString(clientIP) {
 
 				// 从同步池中获取一个压缩写入器
 				// Get a compression writer from the sync pool
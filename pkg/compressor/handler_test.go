@@ -209,3 +209,80 @@ func TestCompressorHandlerFunc_Deflate(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, string(plaintext), com.TestResponseText)
 }
+
+func TestCompressorHandlerFunc_IpResolver(t *testing.T) {
+	// Create a new Config, the whitelist is checked against the address resolved behind the trusted proxy
+	resolver := NewIpResolver().WithTrustedProxies([]string{"10.20.0.0/16"})
+	conf := NewConfig().WithIpWhitelist([]string{"203.0.113.9"}).WithIpResolver(resolver)
+
+	// Create a new Compressor
+	compr := NewCompressor(conf)
+	defer compr.Stop()
+
+	// Create a new Gin router
+	router := gin.New()
+	router.Use(compr.HandlerFunc())
+	router.GET(com.TestUrlPath, func(c *gin.Context) {
+		c.String(http.StatusOK, com.TestResponseText)
+	})
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The whitelisted client behind the trusted proxy is not compressed
+	w := request("10.20.0.1:80")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, com.TestResponseText, w.Body.String())
+
+	// A client forging the header is compressed
+	w = request("203.0.113.10:80")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+}
+
+func TestCompressorHandlerFunc_AddRemoveIp(t *testing.T) {
+	// Create two Compressors, whitelisting an address in one configuration does not affect the other
+	compr := NewCompressor(NewConfig().WithIpWhitelist([]string{"10.32.6.1"}))
+	defer compr.Stop()
+	other := NewCompressor(NewConfig())
+	defer other.Stop()
+
+	newRouter := func(handler gin.HandlerFunc) *gin.Engine {
+		router := gin.New()
+		router.Use(handler)
+		router.GET(com.TestUrlPath, func(c *gin.Context) {
+			c.String(http.StatusOK, com.TestResponseText)
+		})
+		return router
+	}
+	router, otherRouter := newRouter(compr.HandlerFunc()), newRouter(other.HandlerFunc())
+
+	encoding := func(router *gin.Engine, remoteAddr string) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w.Header().Get("Content-Encoding")
+	}
+
+	assert.Empty(t, encoding(router, "10.32.6.1:80"))
+	assert.Equal(t, "gzip", encoding(otherRouter, "10.32.6.1:80"))
+
+	// Added networks are not compressed until they are removed
+	compr.AddIp("10.32.7.0/24")
+	assert.Empty(t, encoding(router, "10.32.7.1:80"))
+	compr.RemoveIp("10.32.7.0/24")
+	assert.Equal(t, "gzip", encoding(router, "10.32.7.1:80"))
+
+	// Replacing the list drops the old items
+	compr.ReplaceIpList([]string{"10.32.7.1"})
+	assert.Equal(t, "gzip", encoding(router, "10.32.6.1:80"))
+	assert.Empty(t, encoding(router, "10.32.7.1:80"))
+}
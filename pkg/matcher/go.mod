@@ -0,0 +1,16 @@
+module github.com/shengyanli1982/orbit-contrib/pkg/matcher
+
+go 1.19
+
+replace github.com/shengyanli1982/orbit-contrib => ../../
+
+require (
+	github.com/shengyanli1982/orbit-contrib v0.0.0
+	github.com/stretchr/testify v1.8.4
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,188 @@
+package matcher
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+)
+
+// MatchFunc 是匹配函数，与各个中间件的 WithMatchFunc 方法接收的类型相同，所以这里的匹配函数可以直接传给它们
+// MatchFunc is the match function, it is the same type the WithMatchFunc method of each middleware takes, so the match functions here can be passed to them directly
+type MatchFunc = com.HttpRequestHeaderMatchFunc
+
+// Any 是匹配所有请求的匹配函数
+// Any is the match function that matches all requests
+var Any MatchFunc = com.DefaultLimitMatchFunc
+
+// orAny 是一个函数，返回匹配函数，为 nil 时返回匹配所有请求的匹配函数
+// orAny is a function that returns the match function, the match function matching all requests is returned when it is nil
+func orAny(fn MatchFunc) MatchFunc {
+	if fn == nil {
+		return Any
+	}
+	return fn
+}
+
+// And 是一个函数，返回一个在所有匹配函数都匹配时才匹配的匹配函数，按顺序检查，遇到不匹配时停止。没有匹配函数时匹配所有请求，nil 匹配所有请求
+// And is a function that returns a match function that matches when all match functions match, they are checked in order and the check stops at the first mismatch. All requests match when there is no match function, and nil matches all requests
+func And(fns ...MatchFunc) MatchFunc {
+	fns = append([]MatchFunc(nil), fns...)
+	return func(req *http.Request) bool {
+		for _, fn := range fns {
+			if !orAny(fn)(req) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or 是一个函数，返回一个在任意一个匹配函数匹配时就匹配的匹配函数，按顺序检查，遇到匹配时停止。没有匹配函数时不匹配任何请求，nil 匹配所有请求
+// Or is a function that returns a match function that matches when any match function matches, they are checked in order and the check stops at the first match. No request matches when there is no match function, and nil matches all requests
+func Or(fns ...MatchFunc) MatchFunc {
+	fns = append([]MatchFunc(nil), fns...)
+	return func(req *http.Request) bool {
+		for _, fn := range fns {
+			if orAny(fn)(req) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not 是一个函数，返回一个与匹配函数结果相反的匹配函数，nil 匹配所有请求，所以 Not(nil) 不匹配任何请求
+// Not is a function that returns a match function with the opposite result of the match function, nil matches all requests, so Not(nil) matches no request
+func Not(fn MatchFunc) MatchFunc {
+	fn = orAny(fn)
+	return func(req *http.Request) bool {
+		return !fn(req)
+	}
+}
+
+// Method 是一个函数，返回一个匹配指定请求方法的匹配函数，方法不区分大小写
+// Method is a function that returns a match function that matches the specified request methods, methods are case-insensitive
+func Method(methods ...string) MatchFunc {
+	set := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		set[strings.ToUpper(strings.TrimSpace(method))] = com.Empty
+	}
+	return func(req *http.Request) bool {
+		method := strings.ToUpper(req.Method)
+		if len(method) == 0 {
+			method = http.MethodGet
+		}
+		_, ok := set[method]
+		return ok
+	}
+}
+
+// Host 是一个函数，返回一个匹配指定主机名的匹配函数，忽略端口和大小写。"*.example.com" 匹配 example.com 的所有子域名，但不匹配 example.com 自身
+// Host is a function that returns a match function that matches the specified host names, ports and case are ignored. "*.example.com" matches all subdomains of example.com, but not example.com itself
+func Host(hosts ...string) MatchFunc {
+	exact := make([]string, 0, len(hosts))
+	suffixes := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if strings.HasPrefix(host, "*.") {
+			suffixes = append(suffixes, host[1:])
+		} else {
+			exact = append(exact, host)
+		}
+	}
+
+	return func(req *http.Request) bool {
+		// 去掉端口，IPv6 地址去掉方括号
+		// Remove the port, and the brackets of IPv6 addresses
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+		for _, h := range exact {
+			if strings.EqualFold(host, h) {
+				return true
+			}
+		}
+		for _, suffix := range suffixes {
+			if len(host) > len(suffix) && strings.EqualFold(host[len(host)-len(suffix):], suffix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Header 是一个函数，返回一个匹配请求头的匹配函数。值为空时只要请求头存在就匹配，否则请求头的任意一个值与它相同时匹配
+// Header is a function that returns a match function that matches a request header. When the value is empty, it matches as long as the header is present, otherwise it matches when any value of the header equals it
+func Header(name, value string) MatchFunc {
+	name = http.CanonicalHeaderKey(name)
+	return func(req *http.Request) bool {
+		values := req.Header[name]
+		if len(value) == 0 {
+			return len(values) > 0
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Query 是一个函数，返回一个匹配查询参数的匹配函数。值为空时只要查询参数存在就匹配，否则查询参数的任意一个值与它相同时匹配
+// Query is a function that returns a match function that matches a query parameter. When the value is empty, it matches as long as the parameter is present, otherwise it matches when any value of the parameter equals it
+func Query(name, value string) MatchFunc {
+	return func(req *http.Request) bool {
+		if req.URL == nil || len(req.URL.RawQuery) == 0 {
+			return false
+		}
+		values, ok := req.URL.Query()[name]
+		if len(value) == 0 {
+			return ok
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ContentType 是一个函数，返回一个匹配请求的媒体类型的匹配函数，忽略参数和大小写，例如 "application/json" 匹配 "application/json; charset=utf-8"。
+// "text/*" 匹配所有的文本类型
+// ContentType is a function that returns a match function that matches the media type of the request, parameters and case are ignored, e.g. "application/json" matches "application/json; charset=utf-8".
+// "text/*" matches all text types
+func ContentType(types ...string) MatchFunc {
+	types = append([]string(nil), types...)
+	for i := range types {
+		types[i] = strings.TrimSpace(types[i])
+	}
+
+	return func(req *http.Request) bool {
+		// 去掉参数，得到媒体类型
+		// Remove the parameters to get the media type
+		mediaType, _, _ := strings.Cut(req.Header.Get("Content-Type"), ";")
+		mediaType = strings.TrimSpace(mediaType)
+		if len(mediaType) == 0 {
+			return false
+		}
+
+		for _, t := range types {
+			if strings.HasSuffix(t, "/*") {
+				prefix := t[:len(t)-2]
+				if len(mediaType) > len(prefix) && mediaType[len(prefix)] == '/' && strings.EqualFold(mediaType[:len(prefix)], prefix) {
+					return true
+				}
+			} else if strings.EqualFold(mediaType, t) {
+				return true
+			}
+		}
+		return false
+	}
+}
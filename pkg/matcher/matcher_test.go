@@ -0,0 +1,91 @@
+package matcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRequest(method, target string, header map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	return req
+}
+
+func TestMethod(t *testing.T) {
+	fn := Method("get", http.MethodPost)
+	assert.True(t, fn(testRequest(http.MethodGet, "/", nil)))
+	assert.True(t, fn(testRequest(http.MethodPost, "/", nil)))
+	assert.False(t, fn(testRequest(http.MethodDelete, "/", nil)))
+
+	// The method of the request is case-insensitive too
+	req := testRequest(http.MethodPost, "/", nil)
+	req.Method = "post"
+	assert.True(t, fn(req))
+	req.Method = ""
+	assert.True(t, fn(req))
+}
+
+func TestHost(t *testing.T) {
+	fn := Host("api.example.com", "*.internal.example.com", "::1")
+	assert.True(t, fn(testRequest(http.MethodGet, "http://api.example.com/", nil)))
+	assert.True(t, fn(testRequest(http.MethodGet, "http://API.Example.com:8080/", nil)))
+	assert.True(t, fn(testRequest(http.MethodGet, "http://a.b.internal.example.com/", nil)))
+	assert.True(t, fn(testRequest(http.MethodGet, "http://[::1]:8080/", nil)))
+	assert.False(t, fn(testRequest(http.MethodGet, "http://internal.example.com/", nil)))
+	assert.False(t, fn(testRequest(http.MethodGet, "http://www.example.com/", nil)))
+}
+
+func TestHeader(t *testing.T) {
+	present := Header("x-api-key", "")
+	exact := Header("X-Env", "staging")
+	assert.True(t, present(testRequest(http.MethodGet, "/", map[string]string{"X-Api-Key": "abc"})))
+	assert.False(t, present(testRequest(http.MethodGet, "/", nil)))
+	assert.True(t, exact(testRequest(http.MethodGet, "/", map[string]string{"X-Env": "staging"})))
+	assert.False(t, exact(testRequest(http.MethodGet, "/", map[string]string{"X-Env": "production"})))
+}
+
+func TestQuery(t *testing.T) {
+	present := Query("debug", "")
+	exact := Query("format", "json")
+	assert.True(t, present(testRequest(http.MethodGet, "/?debug", nil)))
+	assert.False(t, present(testRequest(http.MethodGet, "/", nil)))
+	assert.True(t, exact(testRequest(http.MethodGet, "/?format=xml&format=json", nil)))
+	assert.False(t, exact(testRequest(http.MethodGet, "/?format=xml", nil)))
+}
+
+func TestContentType(t *testing.T) {
+	fn := ContentType("application/json", "text/*")
+	assert.True(t, fn(testRequest(http.MethodPost, "/", map[string]string{"Content-Type": "application/json; charset=utf-8"})))
+	assert.True(t, fn(testRequest(http.MethodPost, "/", map[string]string{"Content-Type": "Text/Plain"})))
+	assert.False(t, fn(testRequest(http.MethodPost, "/", map[string]string{"Content-Type": "application/xml"})))
+	assert.False(t, fn(testRequest(http.MethodPost, "/", map[string]string{"Content-Type": "textual/plain"})))
+	assert.False(t, fn(testRequest(http.MethodPost, "/", nil)))
+}
+
+func TestCombinators(t *testing.T) {
+	// POST requests under /api that are not health checks
+	fn := And(Method(http.MethodPost), PathPrefix("/api"), Not(PathPrefix("/api/health")))
+	assert.True(t, fn(testRequest(http.MethodPost, "/api/users", nil)))
+	assert.False(t, fn(testRequest(http.MethodGet, "/api/users", nil)))
+	assert.False(t, fn(testRequest(http.MethodPost, "/api/health", nil)))
+	assert.False(t, fn(testRequest(http.MethodPost, "/static/app.js", nil)))
+
+	fn = Or(Header("X-Api-Key", ""), Query("api_key", ""))
+	assert.True(t, fn(testRequest(http.MethodGet, "/?api_key=abc", nil)))
+	assert.True(t, fn(testRequest(http.MethodGet, "/", map[string]string{"X-Api-Key": "abc"})))
+	assert.False(t, fn(testRequest(http.MethodGet, "/", nil)))
+
+	// Empty combinators and nil match functions
+	req := testRequest(http.MethodGet, "/", nil)
+	assert.True(t, And()(req))
+	assert.False(t, Or()(req))
+	assert.True(t, And(nil)(req))
+	assert.True(t, Or(nil)(req))
+	assert.False(t, Not(nil)(req))
+	assert.True(t, Any(req))
+}
@@ -0,0 +1,200 @@
+package matcher
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// PathTrie 是按路径段组织的前缀树，匹配的时间只与路径的长度有关，与前缀的数量无关，适合大量的前缀。
+// 前缀按整个路径段匹配，"/api" 匹配 "/api" 和 "/api/users"，但不匹配 "/apis"。前缀树在添加完成之后可以被并发地匹配，添加和匹配不能并发
+// PathTrie is a prefix trie organized by path segments, the time of matching only depends on the length of the path, not the number of prefixes, which suits large sets of prefixes.
+// Prefixes match whole path segments, "/api" matches "/api" and "/api/users", but not "/apis". The trie can be matched concurrently once it is filled, adding and matching must not happen concurrently
+type PathTrie struct {
+	// root 是根节点，对应路径 "/"
+	// root is the root node, corresponding to the path "/"
+	root pathNode
+}
+
+// pathNode 是前缀树的节点，第 i 层的节点对应路径的前 i 段
+// pathNode is a node of the trie, a node at depth i corresponds to the first i segments of a path
+type pathNode struct {
+	// children 是下一段路径对应的子节点
+	// children is the child nodes of the next path segment
+	children map[string]*pathNode
+
+	// terminal 表示从根节点到这个节点的前缀在前缀树中
+	// terminal indicates that the prefix from the root to this node is in the trie
+	terminal bool
+}
+
+// NewPathTrie 是一个函数，返回一个包含指定前缀的前缀树
+// NewPathTrie is a function that returns a trie containing the specified prefixes
+func NewPathTrie(prefixes ...string) *PathTrie {
+	t := &PathTrie{}
+	for _, prefix := range prefixes {
+		t.Add(prefix)
+	}
+	return t
+}
+
+// Add 方法向前缀树添加一个前缀，结尾的 "/" 被忽略，"/" 和空字符串匹配所有的路径
+// The Add method adds a prefix to the trie, the trailing "/" is ignored, "/" and the empty string match all paths
+func (t *PathTrie) Add(prefix string) {
+	node := &t.root
+	for path := strings.Trim(prefix, "/"); len(path) > 0 && !node.terminal; {
+		var segment string
+		segment, path, _ = strings.Cut(path, "/")
+		if node.children == nil {
+			node.children = map[string]*pathNode{}
+		}
+		child, ok := node.children[segment]
+		if !ok {
+			child = &pathNode{}
+			node.children[segment] = child
+		}
+		node = child
+	}
+
+	// 标记前缀，它下面更长的前缀都被包含，不再需要
+	// Mark the prefix, the longer prefixes below it are all covered and no longer needed
+	node.terminal = true
+	node.children = nil
+}
+
+// Match 方法判断路径是否以前缀树中的某个前缀开始，不分配内存
+// The Match method reports whether the path starts with a prefix in the trie, without allocating memory
+func (t *PathTrie) Match(path string) bool {
+	node := &t.root
+	for path = strings.TrimPrefix(path, "/"); ; {
+		if node.terminal {
+			return true
+		}
+		if len(path) == 0 {
+			return false
+		}
+		var segment string
+		segment, path, _ = strings.Cut(path, "/")
+		if node = node.children[segment]; node == nil {
+			return false
+		}
+	}
+}
+
+// MatchFunc 方法返回一个匹配请求路径的匹配函数
+// The MatchFunc method returns a match function that matches the request path
+func (t *PathTrie) MatchFunc() MatchFunc {
+	return func(req *http.Request) bool {
+		return t.Match(requestPath(req))
+	}
+}
+
+// PathPrefix 是一个函数，返回一个匹配路径前缀的匹配函数，前缀按整个路径段匹配，使用 PathTrie 实现，所以前缀的数量不影响匹配的时间
+// PathPrefix is a function that returns a match function that matches path prefixes, prefixes match whole path segments, it is implemented with PathTrie, so the number of prefixes does not affect the time of matching
+func PathPrefix(prefixes ...string) MatchFunc {
+	return NewPathTrie(prefixes...).MatchFunc()
+}
+
+// PathGlob 是一个函数，返回一个匹配路径通配符的匹配函数。"*" 匹配一个路径段中的任意字符，"?" 匹配一个路径段中的一个字符，"[a-z]" 匹配字符集合中的一个字符，
+// "**" 匹配任意多个路径段，例如 "/api/*/users" 匹配 "/api/v1/users"，"/static/**" 匹配 "/static/" 下的所有路径，"/api/**/users" 也匹配 "/api/users"。
+// 通配符在创建时被编译为正则表达式，无效的通配符会引起 panic
+// PathGlob is a function that returns a match function that matches path globs. "*" matches any characters within a path segment, "?" matches one character within a path segment, "[a-z]" matches one character of the set,
+// "**" matches any number of path segments, e.g. "/api/*/users" matches "/api/v1/users", "/static/**" matches all paths under "/static/", and "/api/**/users" also matches "/api/users".
+// Globs are compiled to regular expressions on creation, and invalid globs cause a panic
+func PathGlob(patterns ...string) MatchFunc {
+	exprs := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		exprs = append(exprs, globToRegex(pattern))
+	}
+	return pathRegexFunc(exprs)
+}
+
+// PathRegex 是一个函数，返回一个匹配路径正则表达式的匹配函数。正则表达式不会被自动锚定，需要时使用 "^" 和 "$"。
+// 正则表达式在创建时编译，无效的正则表达式会像 regexp.MustCompile 一样引起 panic
+// PathRegex is a function that returns a match function that matches path regular expressions. The expressions are not anchored automatically, use "^" and "$" when needed.
+// The expressions are compiled on creation, and invalid expressions cause a panic like regexp.MustCompile
+func PathRegex(exprs ...string) MatchFunc {
+	return pathRegexFunc(exprs)
+}
+
+// pathRegexFunc 是一个函数，将多个正则表达式合并为一个，返回匹配请求路径的匹配函数
+// pathRegexFunc is a function that combines multiple regular expressions into one, and returns a match function that matches the request path
+func pathRegexFunc(exprs []string) MatchFunc {
+	if len(exprs) == 0 {
+		return func(*http.Request) bool { return false }
+	}
+
+	// 先单独编译，使 panic 的信息指出无效的表达式
+	// Compile each one first, so that the panic message points out the invalid expression
+	groups := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		regexp.MustCompile(expr)
+		groups = append(groups, "(?:"+expr+")")
+	}
+	re := regexp.MustCompile(strings.Join(groups, "|"))
+
+	return func(req *http.Request) bool {
+		return re.MatchString(requestPath(req))
+	}
+}
+
+// globToRegex 是一个函数，将路径通配符转换为锚定的正则表达式
+// globToRegex is a function that converts a path glob to an anchored regular expression
+func globToRegex(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			// "**/" 匹配零个或者多个完整的路径段，单独的 "**" 匹配剩下的所有字符
+			// "**/" matches zero or more whole path segments, a lone "**" matches all remaining characters
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			// 字符集合原样保留，"!" 表示取反。没有结尾的 "]" 时按普通字符处理
+			// Character sets are kept as they are, "!" means negation. It is treated as a normal character when there is no closing "]"
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			set := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(set, "!") {
+				set = "^" + set[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(set, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			// 转义到下一个特殊字符之前的普通字符
+			// Escape the normal characters up to the next special character
+			end := strings.IndexAny(pattern[i:], "*?[")
+			if end < 0 {
+				end = len(pattern) - i
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+end]))
+			i += end - 1
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// requestPath 是一个函数，返回请求的路径，为空时返回 "/"
+// requestPath is a function that returns the path of the request, "/" is returned when it is empty
+func requestPath(req *http.Request) string {
+	if req.URL == nil || len(req.URL.Path) == 0 {
+		return "/"
+	}
+	return req.URL.Path
+}
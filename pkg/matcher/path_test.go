@@ -0,0 +1,113 @@
+package matcher
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathTrie_Match(t *testing.T) {
+	trie := NewPathTrie("/api/v1", "/static/", "/admin/users/")
+
+	cases := map[string]bool{
+		"/api/v1":           true,
+		"/api/v1/":          true,
+		"/api/v1/users/1":   true,
+		"/api/v2/users":     false,
+		"/api/v10":          false,
+		"/api":              false,
+		"/static":           true,
+		"/static/js/app.js": true,
+		"/statics":          false,
+		"/admin/users":      true,
+		"/admin/user":       false,
+		"/":                 false,
+		"":                  false,
+	}
+	for path, want := range cases {
+		assert.Equal(t, want, trie.Match(path), path)
+	}
+
+	// A shorter prefix covers the longer ones, and "/" matches all paths
+	trie.Add("/api")
+	assert.True(t, trie.Match("/api/v2/users"))
+	trie.Add("/api/v3/users")
+	assert.True(t, trie.Match("/api/v3"))
+	trie.Add("/")
+	assert.True(t, trie.Match("/anything"))
+	assert.True(t, trie.Match(""))
+}
+
+func TestPathTrie_MatchAllocs(t *testing.T) {
+	trie := NewPathTrie("/api/v1", "/static")
+	assert.Zero(t, testing.AllocsPerRun(100, func() { trie.Match("/api/v1/users/1") }))
+}
+
+func TestPathPrefix(t *testing.T) {
+	fn := PathPrefix("/api", "/health")
+	assert.True(t, fn(testRequest(http.MethodGet, "/api/users?page=2", nil)))
+	assert.True(t, fn(testRequest(http.MethodGet, "/health", nil)))
+	assert.False(t, fn(testRequest(http.MethodGet, "/healthz", nil)))
+	assert.False(t, PathPrefix()(testRequest(http.MethodGet, "/api", nil)))
+}
+
+func TestPathGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/api/*/users", "/api/v1/users", true},
+		{"/api/*/users", "/api/v1/v2/users", false},
+		{"/api/**/users", "/api/users", true},
+		{"/api/**/users", "/api/v1/v2/users", true},
+		{"/static/**", "/static/js/app.js", true},
+		{"/static/**", "/static", false},
+		{"/files/*.json", "/files/a.json", true},
+		{"/files/*.json", "/files/ajson", false},
+		{"/v?/ping", "/v1/ping", true},
+		{"/v?/ping", "/v10/ping", false},
+		{"/v[0-9]/ping", "/v3/ping", true},
+		{"/v[!0-9]/ping", "/v3/ping", false},
+		{"/a.b/(c)", "/a.b/(c)", true},
+		{"/a.b/(c)", "/axb/(c)", false},
+		{"/über/*", "/über/x", true},
+		{"/broken[", "/broken[", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, PathGlob(c.pattern)(testRequest(http.MethodGet, c.path, nil)), c.pattern+" "+c.path)
+	}
+
+	// Several globs match when any of them matches
+	fn := PathGlob("/a/*", "/b/*")
+	assert.True(t, fn(testRequest(http.MethodGet, "/b/1", nil)))
+	assert.False(t, fn(testRequest(http.MethodGet, "/c/1", nil)))
+}
+
+func TestPathRegex(t *testing.T) {
+	fn := PathRegex(`^/users/[0-9]+$`, `^/orders/`)
+	assert.True(t, fn(testRequest(http.MethodGet, "/users/42", nil)))
+	assert.True(t, fn(testRequest(http.MethodGet, "/orders/42/items", nil)))
+	assert.False(t, fn(testRequest(http.MethodGet, "/users/me", nil)))
+	assert.False(t, PathRegex()(testRequest(http.MethodGet, "/users/42", nil)))
+
+	// Invalid expressions panic on creation
+	assert.Panics(t, func() { PathRegex(`(`) })
+}
+
+func BenchmarkPathTrie_Match(b *testing.B) {
+	// A large set of prefixes does not slow down matching
+	prefixes := make([]string, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		prefixes = append(prefixes, "/tenants/"+strconv.Itoa(i)+"/api")
+	}
+	trie := NewPathTrie(prefixes...)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Match("/tenants/9999/api/users/1")
+	}
+}
@@ -0,0 +1,368 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAdminListLimit 是管理接口列出键时默认返回的最多数量
+// DefaultAdminListLimit is the default maximum number of keys returned when the admin handlers list keys
+var DefaultAdminListLimit = 1000
+
+// adminResetSuffix 是重置键的管理接口的路径后缀
+// adminResetSuffix is the path suffix of the admin handler that resets a key
+const adminResetSuffix = "/reset"
+
+// KeyState 是一个键的限流器在某一时刻的状态
+// KeyState is the state of the limiter of a key at some moment
+type KeyState struct {
+	// Key 是限流的键
+	// Key is the rate limiting key
+	Key string `json:"key"`
+
+	// Rate 是每秒限制速率
+	// Rate is the limit rate per second
+	Rate float64 `json:"rate"`
+
+	// Burst 是限制突发
+	// Burst is the limit burst
+	Burst int `json:"burst"`
+
+	// Tokens 是剩余的令牌数量
+	// Tokens is the number of tokens remaining
+	Tokens float64 `json:"tokens"`
+
+	// Limited 表示剩余的令牌不足一个，下一个请求会被限流
+	// Limited indicates that less than one token remains, so the next request is limited
+	Limited bool `json:"limited"`
+
+	// BannedUntil 是键的封禁结束的时间，没有被封禁时为 nil
+	// BannedUntil is the time the ban of the key ends, it is nil when the key is not banned
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+}
+
+// Stats 是限流器的汇总统计
+// Stats is the aggregate statistics of the limiter
+type Stats struct {
+	// Keys 是跟踪的键的数量
+	// Keys is the number of tracked keys
+	Keys int `json:"keys"`
+
+	// Capacity 是最多跟踪的键的数量，为 0 时不限制
+	// Capacity is the maximum number of tracked keys, there is no limit when it is 0
+	Capacity int `json:"capacity"`
+
+	// Limited 是剩余的令牌不足一个的键的数量
+	// Limited is the number of keys with less than one token remaining
+	Limited int `json:"limited"`
+
+	// Banned 是被封禁的键的数量
+	// Banned is the number of banned keys
+	Banned int `json:"banned"`
+}
+
+// Inspector 是一个可以查看和重置键的状态的限流器，RateLimiter 和 IpRateLimiter 都实现了这个接口
+// Inspector is a limiter whose keys can be inspected and reset, both RateLimiter and IpRateLimiter implement it
+type Inspector interface {
+	// ListKeys 返回所有跟踪的键的状态
+	// ListKeys returns the state of all tracked keys
+	ListKeys() []KeyState
+
+	// GetKeyState 返回键的状态，键没有被跟踪时返回 false
+	// GetKeyState returns the state of the key, it returns false when the key is not tracked
+	GetKeyState(key string) (KeyState, bool)
+
+	// ResetKey 将键的令牌重置为满，返回键是否被跟踪
+	// ResetKey resets the tokens of the key to full, and returns whether the key is tracked
+	ResetKey(key string) bool
+
+	// DeleteKey 停止跟踪键，返回键是否被跟踪
+	// DeleteKey stops tracking the key, and returns whether the key was tracked
+	DeleteKey(key string) bool
+
+	// Stats 返回汇总统计
+	// Stats returns the aggregate statistics
+	Stats() Stats
+}
+
+// keyStateOf 是一个函数，返回限流器在时间 now 的状态
+// keyStateOf is a function that returns the state of the limiter at time now
+func keyStateOf(key string, limiter Limiter, now time.Time) KeyState {
+	tokens := limiter.TokensAt(now)
+	return KeyState{
+		Key:     key,
+		Rate:    float64(limiter.Limit()),
+		Burst:   limiter.Burst(),
+		Tokens:  tokens,
+		Limited: tokens < 1,
+	}
+}
+
+// ListKeys 方法返回限流器的状态，配置了存储时状态不在进程内，返回空的列表
+// The ListKeys method returns the state of the limiter, when a store is configured the state is not in the process and an empty list is returned
+func (rl *RateLimiter) ListKeys() []KeyState {
+	if state, ok := rl.GetKeyState(DefaultStoreGlobalKey); ok {
+		return []KeyState{state}
+	}
+	return []KeyState{}
+}
+
+// GetKeyState 方法返回限流器的状态，限流器只有一个键 DefaultStoreGlobalKey
+// The GetKeyState method returns the state of the limiter, the limiter only has the key DefaultStoreGlobalKey
+func (rl *RateLimiter) GetKeyState(key string) (KeyState, bool) {
+	if key != DefaultStoreGlobalKey || rl.config.Load().store != nil {
+		return KeyState{}, false
+	}
+	return keyStateOf(key, rl.GetLimiter(), time.Now()), true
+}
+
+// ResetKey 方法使用当前的配置创建一个新的限流器，将令牌重置为满
+// The ResetKey method creates a new rate limiter with the current configuration, so the tokens are reset to full
+func (rl *RateLimiter) ResetKey(key string) bool {
+	if _, ok := rl.GetKeyState(key); !ok {
+		return false
+	}
+
+	// 在修改配置的锁内替换限流器，避免与并发的 SetRate 和 SetBurst 交错
+	// Replace the rate limiter within the lock for changing the configuration, so that it does not interleave with concurrent SetRate and SetBurst
+	rl.config.Update(func(config *Config) {}, rl.reset)
+	return true
+}
+
+// DeleteKey 方法与 ResetKey 相同，限流器只有一个键，不能停止跟踪
+// The DeleteKey method is the same as ResetKey, the limiter only has one key, which cannot stop being tracked
+func (rl *RateLimiter) DeleteKey(key string) bool {
+	return rl.ResetKey(key)
+}
+
+// Stats 方法返回限流器的汇总统计
+// The Stats method returns the aggregate statistics of the limiter
+func (rl *RateLimiter) Stats() Stats {
+	stats := Stats{}
+	for _, state := range rl.ListKeys() {
+		stats.Keys++
+		if state.Limited {
+			stats.Limited++
+		}
+	}
+	return stats
+}
+
+// ListKeys 方法返回所有跟踪的键的状态，按键排序。遍历依次在每个段的锁内进行，不会推迟键的过期
+// The ListKeys method returns the state of all tracked keys, sorted by key. The traversal happens within the lock of each segment in turn, and it does not delay the expiration of the keys
+func (rl *IpRateLimiter) ListKeys() []KeyState {
+	now := time.Now()
+	states := []KeyState{}
+	rl.cache.Range(func(key string, limiter Limiter) bool {
+		states = append(states, keyStateOf(key, limiter, now))
+		return true
+	})
+
+	// 在锁外补充封禁状态并排序
+	// Add the ban state and sort outside the locks
+	for i := range states {
+		rl.banStateOf(&states[i], now)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Key < states[j].Key })
+	return states
+}
+
+// GetKeyState 方法返回键的状态，查看不会推迟键的过期。IP 地址形式的键按配置归并为网段，返回的状态中是归并之后的键
+// The GetKeyState method returns the state of the key, looking at it does not delay the expiration of the key. IP address keys are aggregated to networks by the configuration, the state contains the aggregated key
+func (rl *IpRateLimiter) GetKeyState(key string) (KeyState, bool) {
+	key = rl.config.Load().normalizeKey(key)
+	limiter, ok := rl.cache.Peek(key)
+	if !ok {
+		return KeyState{}, false
+	}
+
+	now := time.Now()
+	state := keyStateOf(key, limiter, now)
+	rl.banStateOf(&state, now)
+	return state, true
+}
+
+// banStateOf 方法在时间 now 被封禁的键的状态中设置封禁结束的时间
+// The banStateOf method sets the end of the ban in the state of a key banned at time now
+func (rl *IpRateLimiter) banStateOf(state *KeyState, now time.Time) {
+	if remaining, banned := rl.bans.banned(state.Key, now); banned {
+		until := now.Add(remaining)
+		state.BannedUntil = &until
+	}
+}
+
+// ResetKey 方法使用当前的配置为键创建一个新的限流器，将令牌重置为满，键的封禁不受影响。
+// 键的限额在段锁之外解析，如果在替换期间配置发生了变化，则使用新的配置重新替换
+// The ResetKey method creates a new rate limiter for the key with the current configuration, so the tokens are reset to full, the ban of the key is not affected.
+// The limits of the key are resolved outside the segment lock, if the configuration changes during the replacement, it is replaced again with the new configuration
+func (rl *IpRateLimiter) ResetKey(key string) bool {
+	key = rl.config.Load().normalizeKey(key)
+	if _, ok := rl.cache.Peek(key); !ok {
+		return false
+	}
+
+	r := newResolveRequest()
+	for {
+		config := rl.config.Load()
+		limits := config.limitsOf(key, r)
+		ok := rl.cache.Replace(key, func() Limiter {
+			return rl.newConfigLimiter(config, limits)
+		})
+		if !ok || rl.config.Load() == config {
+			return ok
+		}
+	}
+}
+
+// DeleteKey 方法删除键的限流器和封禁，键的下一个请求从满的令牌开始
+// The DeleteKey method deletes the rate limiter and the ban of the key, the next request of the key starts from full tokens
+func (rl *IpRateLimiter) DeleteKey(key string) bool {
+	key = rl.config.Load().normalizeKey(key)
+	_, ok := rl.cache.Peek(key)
+	rl.cache.Delete(key)
+	if rl.Unban(key) {
+		ok = true
+	}
+	return ok
+}
+
+// Stats 方法返回限流器的汇总统计
+// The Stats method returns the aggregate statistics of the limiter
+func (rl *IpRateLimiter) Stats() Stats {
+	now := time.Now()
+	stats := Stats{Capacity: rl.cache.Capacity(), Banned: len(rl.bans.list(now))}
+	rl.cache.Range(func(key string, limiter Limiter) bool {
+		stats.Keys++
+		if limiter.TokensAt(now) < 1 {
+			stats.Limited++
+		}
+		return true
+	})
+	return stats
+}
+
+// AdminHandlers 是查看和重置限流器的管理接口的处理函数，需要注册在受保护的路由上
+// AdminHandlers is the handlers of the admin interface for inspecting and resetting limiters, they must be registered on protected routes
+type AdminHandlers struct {
+	// List 列出跟踪的键，按剩余的令牌从少到多排序。查询参数 limited=true 只列出被限流的键，limit 限制返回的数量
+	// List lists the tracked keys, sorted by the remaining tokens from least to most. The query parameter limited=true only lists limited keys, and limit limits the number returned
+	List gin.HandlerFunc
+
+	// Get 返回通配路径参数 key 指定的键的状态
+	// Get returns the state of the key specified by the catch-all path parameter key
+	Get gin.HandlerFunc
+
+	// Reset 将通配路径参数 key 指定的键的令牌重置为满，路径以 /reset 结尾
+	// Reset resets the tokens of the key specified by the catch-all path parameter key to full, the path ends with /reset
+	Reset gin.HandlerFunc
+
+	// Delete 停止跟踪通配路径参数 key 指定的键
+	// Delete stops tracking the key specified by the catch-all path parameter key
+	Delete gin.HandlerFunc
+
+	// Stats 返回汇总统计
+	// Stats returns the aggregate statistics
+	Stats gin.HandlerFunc
+}
+
+// adminError 是一个函数，写入管理接口的错误响应
+// adminError is a function that writes the error response of the admin interface
+func adminError(ctx *gin.Context, code int, message string) {
+	ctx.AbortWithStatusJSON(code, gin.H{"code": code, "message": message})
+}
+
+// adminKey 是一个函数，返回通配路径参数 key 中的键。归并之后的 IPv6 键包含 "/"，例如 "2001:db8::/64"，所以键使用通配参数
+// adminKey is a function that returns the key in the catch-all path parameter key. Aggregated IPv6 keys contain "/", e.g. "2001:db8::/64", so the key uses a catch-all parameter
+func adminKey(ctx *gin.Context) string {
+	return strings.TrimPrefix(ctx.Param("key"), "/")
+}
+
+// NewAdminHandlers 是一个函数，返回指定限流器的管理接口的处理函数
+// NewAdminHandlers is a function that returns the handlers of the admin interface of the specified limiter
+func NewAdminHandlers(inspector Inspector) *AdminHandlers {
+	return &AdminHandlers{
+		List: func(ctx *gin.Context) {
+			// 解析返回的最多数量
+			// Parse the maximum number returned
+			limit := DefaultAdminListLimit
+			if value := ctx.Query("limit"); len(value) > 0 {
+				n, err := strconv.Atoi(value)
+				if err != nil || n <= 0 {
+					adminError(ctx, http.StatusBadRequest, "invalid limit")
+					return
+				}
+				limit = n
+			}
+
+			// 按条件过滤，被限流最严重的键排在前面
+			// Filter by the condition, the most limited keys come first
+			limitedOnly := ctx.Query("limited") == "true"
+			states := inspector.ListKeys()
+			keys := states[:0]
+			for _, state := range states {
+				if !limitedOnly || state.Limited {
+					keys = append(keys, state)
+				}
+			}
+			sort.SliceStable(keys, func(i, j int) bool { return keys[i].Tokens < keys[j].Tokens })
+			if len(keys) > limit {
+				keys = keys[:limit]
+			}
+
+			ctx.JSON(http.StatusOK, gin.H{"total": len(states), "keys": keys})
+		},
+
+		Get: func(ctx *gin.Context) {
+			state, ok := inspector.GetKeyState(adminKey(ctx))
+			if !ok {
+				adminError(ctx, http.StatusNotFound, "key not found")
+				return
+			}
+			ctx.JSON(http.StatusOK, state)
+		},
+
+		Reset: func(ctx *gin.Context) {
+			// 键后面必须是 /reset，所以以 /reset 结尾的键也可以被重置
+			// The key must be followed by /reset, so keys ending with /reset can be reset as well
+			key := adminKey(ctx)
+			if !strings.HasSuffix(key, adminResetSuffix) {
+				adminError(ctx, http.StatusNotFound, "not found")
+				return
+			}
+			key = key[:len(key)-len(adminResetSuffix)]
+			if !inspector.ResetKey(key) {
+				adminError(ctx, http.StatusNotFound, "key not found")
+				return
+			}
+			state, _ := inspector.GetKeyState(key)
+			ctx.JSON(http.StatusOK, state)
+		},
+
+		Delete: func(ctx *gin.Context) {
+			if !inspector.DeleteKey(adminKey(ctx)) {
+				adminError(ctx, http.StatusNotFound, "key not found")
+				return
+			}
+			ctx.Status(http.StatusNoContent)
+		},
+
+		Stats: func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, inspector.Stats())
+		},
+	}
+}
+
+// Register 方法将处理函数注册到路由上：GET /keys、GET /keys/*key、POST /keys/*key/reset、DELETE /keys/*key 和 GET /stats
+// The Register method registers the handlers on the routes: GET /keys, GET /keys/*key, POST /keys/*key/reset, DELETE /keys/*key and GET /stats
+func (h *AdminHandlers) Register(routes gin.IRoutes) {
+	routes.GET("/keys", h.List)
+	routes.GET("/keys/*key", h.Get)
+	routes.POST("/keys/*key", h.Reset)
+	routes.DELETE("/keys/*key", h.Delete)
+	routes.GET("/stats", h.Stats)
+}
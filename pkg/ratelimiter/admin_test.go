@@ -0,0 +1,148 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAdminRouter(inspector Inspector) *gin.Engine {
+	router := gin.New()
+	NewAdminHandlers(inspector).Register(router.Group("/admin"))
+	return router
+}
+
+func testAdminRequest(router *gin.Engine, method, path string, body interface{}) int {
+	req := httptest.NewRequest(method, path, nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if body != nil {
+		_ = json.Unmarshal(resp.Body.Bytes(), body)
+	}
+	return resp.Code
+}
+
+func TestIpRateLimiter_Admin(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRate(0.001).WithBurst(3))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+	admin := testAdminRouter(limiter)
+
+	// Drain one key and use another once
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.8.0.1:80"))
+	}
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.8.0.2:80"))
+
+	// Keys are listed with the most limited first
+	list := struct {
+		Total int        `json:"total"`
+		Keys  []KeyState `json:"keys"`
+	}{}
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodGet, "/admin/keys", &list))
+	assert.Equal(t, 2, list.Total)
+	assert.Len(t, list.Keys, 2)
+	assert.Equal(t, "10.8.0.1", list.Keys[0].Key)
+	assert.True(t, list.Keys[0].Limited)
+	assert.InDelta(t, 2, list.Keys[1].Tokens, 0.1)
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodGet, "/admin/keys?limited=true", &list))
+	assert.Len(t, list.Keys, 1)
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodGet, "/admin/keys?limit=1", &list))
+	assert.Len(t, list.Keys, 1)
+	assert.Equal(t, http.StatusBadRequest, testAdminRequest(admin, http.MethodGet, "/admin/keys?limit=x", nil))
+
+	// A single key can be looked at
+	state := KeyState{}
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodGet, "/admin/keys/10.8.0.2", &state))
+	assert.Equal(t, 3, state.Burst)
+	assert.Equal(t, 0.001, state.Rate)
+	assert.Nil(t, state.BannedUntil)
+	assert.Equal(t, http.StatusNotFound, testAdminRequest(admin, http.MethodGet, "/admin/keys/10.8.0.3", nil))
+
+	// Resetting a key gives it full tokens again
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.8.0.1:80"))
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodPost, "/admin/keys/10.8.0.1/reset", &state))
+	assert.InDelta(t, 3, state.Tokens, 0.1)
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.8.0.1:80"))
+	assert.Equal(t, http.StatusNotFound, testAdminRequest(admin, http.MethodPost, "/admin/keys/10.8.0.3/reset", nil))
+
+	// Deleting a key stops tracking it
+	assert.Equal(t, http.StatusNoContent, testAdminRequest(admin, http.MethodDelete, "/admin/keys/10.8.0.2", nil))
+	assert.Equal(t, http.StatusNotFound, testAdminRequest(admin, http.MethodGet, "/admin/keys/10.8.0.2", nil))
+	assert.Equal(t, http.StatusNotFound, testAdminRequest(admin, http.MethodDelete, "/admin/keys/10.8.0.2", nil))
+}
+
+func TestIpRateLimiter_AdminIpv6(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRate(0.001).WithBurst(2))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+	admin := testAdminRouter(limiter)
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:35:2::1]:80"))
+
+	// Aggregated IPv6 keys contain "/", and the routes accept them as well as single addresses
+	state := KeyState{}
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodGet, "/admin/keys/2001:db8:35:2::/64", &state))
+	assert.Equal(t, "2001:db8:35:2::/64", state.Key)
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodGet, "/admin/keys/2001:db8:35:2::9", &state))
+	assert.Equal(t, "2001:db8:35:2::/64", state.Key)
+
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodPost, "/admin/keys/2001:db8:35:2::/64/reset", &state))
+	assert.InDelta(t, 2, state.Tokens, 0.1)
+	assert.Equal(t, http.StatusNotFound, testAdminRequest(admin, http.MethodPost, "/admin/keys/2001:db8:35:2::/64", nil))
+	assert.Equal(t, http.StatusNotFound, testAdminRequest(admin, http.MethodPost, "/admin/keys/2001:db8:35:3::/64/reset", nil))
+
+	assert.Equal(t, http.StatusNoContent, testAdminRequest(admin, http.MethodDelete, "/admin/keys/2001:db8:35:2::/64", nil))
+	assert.Equal(t, http.StatusNotFound, testAdminRequest(admin, http.MethodGet, "/admin/keys/2001:db8:35:2::/64", nil))
+}
+
+func TestIpRateLimiter_AdminStats(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRate(0.001).WithBurst(1).WithCacheCapacity(1024))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+	admin := testAdminRouter(limiter)
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.8.1.1:80"))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.8.1.2:80"))
+	assert.True(t, limiter.ResetKey("10.8.1.2"))
+	limiter.Ban("10.8.1.3", time.Minute)
+
+	stats := Stats{}
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodGet, "/admin/stats", &stats))
+	assert.Equal(t, Stats{Keys: 2, Capacity: 1024, Limited: 1, Banned: 1}, stats)
+
+	// The ban is shown with the key, and deleting the key lifts it
+	limiter.Ban("10.8.1.2", time.Minute)
+	state := KeyState{}
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodGet, "/admin/keys/10.8.1.2", &state))
+	assert.NotNil(t, state.BannedUntil)
+	assert.True(t, limiter.DeleteKey("10.8.1.2"))
+	assert.True(t, limiter.DeleteKey("10.8.1.3"))
+	assert.Empty(t, limiter.ListBans())
+}
+
+func TestRateLimiter_Admin(t *testing.T) {
+	limiter := NewRateLimiter(NewConfig().WithRate(0.001).WithBurst(2))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+	admin := testAdminRouter(limiter)
+
+	// The limiter has a single key
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.8.2.1:80"))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.8.2.2:80"))
+	state := KeyState{}
+	assert.Equal(t, http.StatusOK, testAdminRequest(admin, http.MethodGet, "/admin/keys/"+DefaultStoreGlobalKey, &state))
+	assert.True(t, state.Limited)
+	assert.Equal(t, http.StatusNotFound, testAdminRequest(admin, http.MethodGet, "/admin/keys/10.8.2.1", nil))
+
+	// Resetting gives the limiter full tokens again
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.8.2.1:80"))
+	assert.True(t, limiter.ResetKey(DefaultStoreGlobalKey))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.8.2.1:80"))
+	assert.Equal(t, Stats{Keys: 1}, limiter.Stats())
+}
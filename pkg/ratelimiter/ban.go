@@ -0,0 +1,228 @@
+package ratelimiter
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	itl "github.com/shengyanli1982/orbit-contrib/pkg/ratelimiter/internal"
+)
+
+// DefaultBanWindow 是默认统计被拒绝次数的时间窗口
+// DefaultBanWindow is the default time window for counting rejections
+var DefaultBanWindow = time.Minute
+
+// DefaultBanDuration 是默认的封禁时间
+// DefaultBanDuration is the default ban duration
+var DefaultBanDuration = 5 * time.Minute
+
+// Ban 是一个键的封禁
+// Ban is the ban of a key
+type Ban struct {
+	// Key 是被封禁的键
+	// Key is the banned key
+	Key string
+
+	// Until 是封禁结束的时间
+	// Until is the time the ban ends
+	Until time.Time
+
+	// Count 是键被封禁的次数，包括这一次
+	// Count is the number of times the key has been banned, including this one
+	Count int
+}
+
+// BanCallback 是一个可选的回调接口，配置的回调实现这个接口时，在键被封禁和解封时被调用
+// BanCallback is an optional callback interface, when the callback of the configuration implements it, it is called when a key is banned and unbanned
+type BanCallback interface {
+	// OnBanned 是一个方法，当键被封禁时被调用，包括自动封禁和通过 Ban 方法封禁，接收封禁作为参数
+	// OnBanned is a method that is called when a key is banned, both automatically and with the Ban method, it takes the ban as a parameter
+	OnBanned(ban *Ban)
+
+	// OnUnbanned 是一个方法，当被封禁的键通过 Unban 方法解封时被调用，封禁到期时不会被调用，接收键作为参数
+	// OnUnbanned is a method that is called when a banned key is unbanned with the Unban method, it is not called when a ban expires, it takes the key as a parameter
+	OnUnbanned(key string)
+}
+
+// banState 是一个键的被拒绝次数和封禁状态
+// banState is the rejections and the ban state of a key
+type banState struct {
+	// mu 是保护状态的互斥锁
+	// mu is the mutex protecting the state
+	mu sync.Mutex
+
+	// windowStart 是当前统计窗口开始的 Unix 毫秒数
+	// windowStart is the start of the current counting window in Unix milliseconds
+	windowStart int64
+
+	// rejections 是当前统计窗口内被拒绝的次数
+	// rejections is the number of rejections within the current counting window
+	rejections int
+
+	// until 是封禁结束的 Unix 毫秒数
+	// until is the end of the ban in Unix milliseconds
+	until int64
+
+	// count 是键被封禁的次数
+	// count is the number of times the key has been banned
+	count int
+}
+
+// GetUpdateAt 方法返回封禁结束的时间，使状态在封禁结束之前不会过期
+// The GetUpdateAt method returns the end of the ban, so that the state does not expire before the ban ends
+func (s *banState) GetUpdateAt() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.until
+}
+
+// ban 方法将键封禁 d 时间，调用时需要持有锁
+// The ban method bans the key for d, the lock must be held when calling it
+func (s *banState) ban(key string, now int64, d time.Duration) *Ban {
+	s.count++
+	s.rejections = 0
+	s.until = now + d.Milliseconds()
+	return &Ban{Key: key, Until: time.UnixMilli(s.until), Count: s.count}
+}
+
+// banList 是被拒绝的键的状态列表，键在时间窗口内被拒绝的次数达到阈值时被封禁
+// banList is the state list of rejected keys, a key is banned when its rejections within the time window reach the threshold
+type banList struct {
+	// cache 是一个指向 itl.Cache 的指针，用于存储每个键的状态，没有被访问并且没有被封禁的状态会过期，封禁的次数随之清零
+	// cache is a pointer to itl.Cache, used to store the state of each key, states neither accessed nor banned expire, and the ban count is reset with them
+	cache *itl.Cache[*banState]
+
+	// used 表示列表中是否有过状态，没有时请求不需要查询列表
+	// used indicates whether the list has ever had a state, requests do not need to look up the list when it has not
+	used atomic.Bool
+}
+
+// newBanList 是一个函数，返回一个使用配置的时间窗口和封禁时间的封禁列表
+// newBanList is a function that returns a ban list using the time window and the ban duration of the configuration
+func newBanList(config *Config) *banList {
+	return &banList{
+		cache: itl.NewCacheWithOptions[*banState](&itl.Options{
+			ExpireTime:   config.banWindow + config.banMaxDuration,
+			ScanInterval: config.cacheScanInterval,
+		}),
+	}
+}
+
+// banned 方法返回键在时间 now 是否被封禁，以及封禁剩余的时间
+// The banned method returns whether the key is banned at time now, and the remaining time of the ban
+func (b *banList) banned(key string, now time.Time) (time.Duration, bool) {
+	if !b.used.Load() {
+		return 0, false
+	}
+
+	s, ok := b.cache.Get(key)
+	if !ok {
+		return 0, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remaining := time.Duration(s.until-now.UnixMilli()) * time.Millisecond
+	return remaining, remaining > 0
+}
+
+// reject 方法记录键在时间 now 被拒绝一次，被拒绝的次数在时间窗口内达到阈值时封禁键并返回封禁，否则返回 nil
+// The reject method records a rejection of the key at time now, bans the key and returns the ban when the rejections within the time window reach the threshold, otherwise it returns nil
+func (b *banList) reject(key string, config *Config, now time.Time) *Ban {
+	b.used.Store(true)
+	s, _ := b.cache.GetOrCreate(key, func() *banState { return &banState{} })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 时间窗口从第一次被拒绝开始，超过时间窗口后重新计数
+	// The time window starts at the first rejection, and counting starts again after the time window
+	ms := now.UnixMilli()
+	if ms-s.windowStart >= config.banWindow.Milliseconds() {
+		s.windowStart, s.rejections = ms, 0
+	}
+	s.rejections++
+	if s.rejections < config.banThreshold {
+		return nil
+	}
+
+	return s.ban(key, ms, banDurationOf(config, s.count))
+}
+
+// ban 方法将键从时间 now 开始封禁 d 时间，d 小于等于 0 时使用配置的封禁时间，返回封禁
+// The ban method bans the key for d from time now, the ban duration of the configuration is used when d is less than or equal to 0, and returns the ban
+func (b *banList) ban(key string, config *Config, d time.Duration, now time.Time) *Ban {
+	b.used.Store(true)
+	s, _ := b.cache.GetOrCreate(key, func() *banState { return &banState{} })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d <= 0 {
+		d = banDurationOf(config, s.count)
+	}
+	return s.ban(key, now.UnixMilli(), d)
+}
+
+// unban 方法删除键的状态，返回键在时间 now 是否被封禁
+// The unban method deletes the state of the key, and returns whether the key was banned at time now
+func (b *banList) unban(key string, now time.Time) bool {
+	_, banned := b.banned(key, now)
+	b.cache.Delete(key)
+	return banned
+}
+
+// list 方法返回在时间 now 被封禁的所有键的封禁，按键排序
+// The list method returns the bans of all keys banned at time now, sorted by key
+func (b *banList) list(now time.Time) []Ban {
+	bans := []Ban{}
+	ms := now.UnixMilli()
+	b.cache.Range(func(key string, s *banState) bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.until > ms {
+			bans = append(bans, Ban{Key: key, Until: time.UnixMilli(s.until), Count: s.count})
+		}
+		return true
+	})
+
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Key < bans[j].Key })
+	return bans
+}
+
+// stop 方法用于停止封禁列表的缓存
+// The stop method is used to stop the cache of the ban list
+func (b *banList) stop() {
+	b.cache.Stop()
+}
+
+// banDurationOf 是一个函数，返回已经被封禁 count 次的键下一次的封禁时间。
+// 配置的最长封禁时间大于封禁时间时，每次封禁的时间加倍，直到最长封禁时间
+// banDurationOf is a function that returns the next ban duration of a key already banned count times.
+// When the maximum ban duration of the configuration is greater than the ban duration, each ban doubles the duration up to the maximum ban duration
+func banDurationOf(config *Config, count int) time.Duration {
+	d := config.banDuration
+	for i := 0; i < count && d < config.banMaxDuration; i++ {
+		d *= 2
+	}
+	if d > config.banMaxDuration {
+		d = config.banMaxDuration
+	}
+	return d
+}
+
+// notifyBanned 是一个函数，如果配置的回调实现了 BanCallback 接口，则通知键被封禁
+// notifyBanned is a function that notifies that the key is banned if the callback of the configuration implements the BanCallback interface
+func notifyBanned(config *Config, ban *Ban) {
+	if callback, ok := config.callback.(BanCallback); ok {
+		callback.OnBanned(ban)
+	}
+}
+
+// notifyUnbanned 是一个函数，如果配置的回调实现了 BanCallback 接口，则通知键被解封
+// notifyUnbanned is a function that notifies that the key is unbanned if the callback of the configuration implements the BanCallback interface
+func notifyUnbanned(config *Config, key string) {
+	if callback, ok := config.callback.(BanCallback); ok {
+		callback.OnUnbanned(key)
+	}
+}
@@ -0,0 +1,158 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type testBanCallback struct {
+	testDecisionCallback
+	bans     []Ban
+	unbanned []string
+}
+
+func (c *testBanCallback) OnBanned(ban *Ban) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bans = append(c.bans, *ban)
+}
+
+func (c *testBanCallback) OnUnbanned(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unbanned = append(c.unbanned, key)
+}
+
+func TestIpRateLimiter_AutoBan(t *testing.T) {
+	callback := &testBanCallback{}
+	conf := NewConfig().WithBurst(1).WithCallback(callback).WithBanThreshold(2)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// The second rejection bans the key
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.6.0.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.6.0.1:80"))
+	assert.Empty(t, limiter.ListBans())
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.6.0.1:80"))
+	assert.Len(t, callback.bans, 1)
+	assert.Equal(t, "10.6.0.1", callback.bans[0].Key)
+	assert.Equal(t, 1, callback.bans[0].Count)
+	assert.WithinDuration(t, time.Now().Add(DefaultBanDuration), callback.bans[0].Until, time.Second)
+
+	// Requests of the banned key are rejected without touching the bucket
+	tokens := limiter.GetLimiter("10.6.0.1").TokensAt(time.Now())
+	req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+	req.RemoteAddr = "10.6.0.1:80"
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "300", resp.Header().Get(HeaderRetryAfter))
+	assert.InDelta(t, tokens, limiter.GetLimiter("10.6.0.1").TokensAt(time.Now()), 0.1)
+	d := callback.limited[len(callback.limited)-1]
+	assert.True(t, d.Banned)
+	assert.Equal(t, "10.6.0.1", d.Key)
+
+	// The ban is listed, and other keys are not affected
+	bans := limiter.ListBans()
+	assert.Len(t, bans, 1)
+	assert.Equal(t, callback.bans[0], bans[0])
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.6.0.2:80"))
+}
+
+func TestIpRateLimiter_BanExpire(t *testing.T) {
+	conf := NewConfig().WithRate(100).WithBurst(1).WithBanThreshold(1).WithBanDuration(30 * time.Millisecond).WithBanWindow(20 * time.Millisecond)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.6.1.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.6.1.1:80"))
+	assert.Len(t, limiter.ListBans(), 1)
+
+	// The key is allowed again after the ban ends
+	time.Sleep(40 * time.Millisecond)
+	assert.Empty(t, limiter.ListBans())
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.6.1.1:80"))
+}
+
+func TestIpRateLimiter_BanWindow(t *testing.T) {
+	conf := NewConfig().WithRate(100).WithBurst(1).WithBanThreshold(2).WithBanWindow(20 * time.Millisecond)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// Rejections in different windows do not add up
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.6.2.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.6.2.1:80"))
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.6.2.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.6.2.1:80"))
+	assert.Empty(t, limiter.ListBans())
+}
+
+func TestIpRateLimiter_BanUnban(t *testing.T) {
+	callback := &testBanCallback{}
+	limiter := NewIpRateLimiter(NewConfig().WithBurst(10).WithCallback(callback))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// Keys can be banned manually even without automatic banning
+	ban := limiter.Ban("10.6.3.1", time.Minute)
+	assert.Equal(t, "10.6.3.1", ban.Key)
+	assert.Equal(t, 1, ban.Count)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), ban.Until, time.Second)
+	assert.Equal(t, []Ban{ban}, callback.bans)
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.6.3.1:80"))
+	assert.True(t, callback.limited[0].Banned)
+
+	// Unbanning allows the key again
+	assert.True(t, limiter.Unban("10.6.3.1"))
+	assert.Equal(t, []string{"10.6.3.1"}, callback.unbanned)
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.6.3.1:80"))
+	assert.False(t, limiter.Unban("10.6.3.1"))
+	assert.Len(t, callback.unbanned, 1)
+
+	// A ban without a duration uses the ban duration of the configuration
+	ban = limiter.Ban("10.6.3.2", 0)
+	assert.WithinDuration(t, time.Now().Add(DefaultBanDuration), ban.Until, time.Second)
+	assert.Equal(t, []Ban{ban}, limiter.ListBans())
+}
+
+func TestBanDurationOf(t *testing.T) {
+	// Without a maximum, the ban duration does not grow
+	conf := isConfigValid(NewConfig().WithBanDuration(time.Second))
+	assert.Equal(t, time.Second, banDurationOf(conf, 0))
+	assert.Equal(t, time.Second, banDurationOf(conf, 5))
+
+	// With a maximum, repeated bans double up to it
+	conf = isConfigValid(NewConfig().WithBanDuration(time.Second).WithBanMaxDuration(5 * time.Second))
+	assert.Equal(t, time.Second, banDurationOf(conf, 0))
+	assert.Equal(t, 2*time.Second, banDurationOf(conf, 1))
+	assert.Equal(t, 4*time.Second, banDurationOf(conf, 2))
+	assert.Equal(t, 5*time.Second, banDurationOf(conf, 3))
+	assert.Equal(t, 5*time.Second, banDurationOf(conf, 100))
+}
+
+func TestIpRateLimiter_BanBackoff(t *testing.T) {
+	conf := NewConfig().WithBanThreshold(1).WithBanDuration(time.Minute).WithBanMaxDuration(time.Hour)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.6.4.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.6.4.1:80"))
+
+	// The next ban of the same key lasts twice as long
+	bans := limiter.ListBans()
+	assert.Len(t, bans, 1)
+	assert.Equal(t, 1, bans[0].Count)
+	ban := limiter.Ban("10.6.4.1", 0)
+	assert.Equal(t, 2, ban.Count)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), ban.Until, time.Second)
+}
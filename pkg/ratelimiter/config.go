@@ -1,7 +1,14 @@
 package ratelimiter
 
 import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
 	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	itl "github.com/shengyanli1982/orbit-contrib/pkg/ratelimiter/internal"
 )
 
 // DefaultLimitRatePerSecond 是默认的每秒限制速率
@@ -12,8 +19,56 @@ var DefaultLimitRatePerSecond = float64(1)
 // DefaultLimitBurst is the default limit burst
 var DefaultLimitBurst = 1
 
-// Config 是配置结构体，包含速率、突发、IP白名单、匹配函数和回调
-// Config is the configuration structure, including rate, burst, IP whitelist, match function and callback
+// DefaultCacheTTL 是键的限流器在没有请求后默认保留的时间
+// DefaultCacheTTL is the default time the rate limiter of a key is kept after its last request
+var DefaultCacheTTL = itl.DefaultExpireTime
+
+// DefaultCacheScanInterval 是默认的清理过期的键的扫描间隔
+// DefaultCacheScanInterval is the default scan interval for removing expired keys
+var DefaultCacheScanInterval = itl.DefaultScanInterval
+
+// DefaultCacheCapacity 是默认最多跟踪的键的数量，为 0 时不限制
+// DefaultCacheCapacity is the default maximum number of tracked keys, there is no limit when it is 0
+var DefaultCacheCapacity = 0
+
+// DefaultIpv4Prefix 是 IPv4 地址形式的键默认归并到的前缀长度，默认为 32，即不归并
+// DefaultIpv4Prefix is the default prefix length IPv4 address keys are aggregated to, it is 32 by default, that is no aggregation
+var DefaultIpv4Prefix = 32
+
+// DefaultIpv6Prefix 是 IPv6 地址形式的键默认归并到的前缀长度，一个 /64 网段通常属于同一个客户端
+// DefaultIpv6Prefix is the default prefix length IPv6 address keys are aggregated to, a /64 network usually belongs to a single client
+var DefaultIpv6Prefix = 64
+
+const (
+	// minIpv4Prefix 是 IPv4 地址形式的键可以归并到的最短的前缀长度
+	// minIpv4Prefix is the shortest prefix length IPv4 address keys can be aggregated to
+	minIpv4Prefix = 16
+
+	// minIpv6Prefix 是 IPv6 地址形式的键可以归并到的最短的前缀长度
+	// minIpv6Prefix is the shortest prefix length IPv6 address keys can be aggregated to
+	minIpv6Prefix = 48
+)
+
+// KeyFunc 是一个键函数，用于从请求中提取限流的键，返回 false 时表示该请求不进行限流
+// KeyFunc is a key function used to extract the rate limiting key from the request, returning false means the request is not limited
+type KeyFunc func(ctx *gin.Context) (string, bool)
+
+// DefaultKeyFunc 是默认的键函数，使用客户端 IP 地址作为键
+// DefaultKeyFunc is the default key function, which uses the client IP address as the key
+var DefaultKeyFunc = KeyByClientIP()
+
+// IpResolver 是客户端 IP 地址的解析器，支持受信任的代理、X-Forwarded-For 请求头 (可以设置为 X-Real-IP、Forwarded 等请求头) 和 PROXY 协议
+// IpResolver is the resolver of the client IP address, supporting trusted proxies, the X-Forwarded-For header (X-Real-IP, Forwarded and other headers can be configured) and the PROXY protocol
+type IpResolver = com.IpResolver
+
+// NewIpResolver 是一个函数，返回一个没有受信任的代理的解析器，使用 WithTrustedProxies 方法设置受信任的代理
+// NewIpResolver is a function that returns a resolver without trusted proxies, use the WithTrustedProxies method to set the trusted proxies
+func NewIpResolver() *IpResolver {
+	return com.NewIpResolver()
+}
+
+// Config 是配置结构体，包含速率、突发、限流算法、IP白名单、匹配函数、键函数和回调
+// Config is the configuration structure, including rate, burst, algorithm, IP whitelist, match function, key function and callback
 type Config struct {
 	// rate 是每秒限制速率
 	// rate is the limit rate per second
@@ -23,14 +78,126 @@ type Config struct {
 	// burst is the limit burst
 	burst int
 
+	// algorithm 是限流算法
+	// algorithm is the rate limiting algorithm
+	algorithm Algorithm
+
 	// ipWhitelist 是IP白名单
 	// ipWhitelist is the IP whitelist
-	ipWhitelist map[string]struct{}
+	ipWhitelist *com.IpList
+
+	// ipResolver 是客户端 IP 地址的解析器，为 nil 时使用 gin.Context 的 ClientIP 方法
+	// ipResolver is the resolver of the client IP address, the ClientIP method of gin.Context is used when it is nil
+	ipResolver *IpResolver
 
 	// matchFunc 是匹配函数
 	// matchFunc is the match function
 	matchFunc com.HttpRequestHeaderMatchFunc
 
+	// keyFunc 是键函数
+	// keyFunc is the key function
+	keyFunc KeyFunc
+
+	// ipv4Prefix 是 IPv4 地址形式的键归并到的前缀长度
+	// ipv4Prefix is the prefix length IPv4 address keys are aggregated to
+	ipv4Prefix int
+
+	// ipv6Prefix 是 IPv6 地址形式的键归并到的前缀长度
+	// ipv6Prefix is the prefix length IPv6 address keys are aggregated to
+	ipv6Prefix int
+
+	// keyPrefix 是键在存储中的前缀，只有共享存储的规则的限流器使用的配置才不为空
+	// keyPrefix is the prefix of the keys in the store, it is only non-empty in configurations used by the limiters of rules sharing a store
+	keyPrefix string
+
+	// missingKey 是键函数没有找到键时的处理方式
+	// missingKey is how a request is handled when the key function finds no key
+	missingKey MissingKeyPolicy
+
+	// headerStyle 是限流响应头样式
+	// headerStyle is the style of the rate limiting response headers
+	headerStyle HeaderStyle
+
+	// rejectHandler 是拒绝处理函数
+	// rejectHandler is the reject handler
+	rejectHandler RejectHandler
+
+	// shadow 表示限流器是否处于影子模式，影子模式下照常做出决策，但不拒绝请求
+	// shadow indicates whether the limiter is in shadow mode, decisions are made as usual in shadow mode, but requests are never rejected
+	shadow bool
+
+	// store 是限流存储，为 nil 时使用进程内的限流器
+	// store is the rate limiting store, the in-process rate limiters are used when it is nil
+	store Store
+
+	// storeFailure 是存储返回错误时请求的处理方式
+	// storeFailure is how a request is handled when the store returns an error
+	storeFailure StoreFailurePolicy
+
+	// tiers 是每个键的限流层级，设置后代替速率和突发
+	// tiers is the rate limiting tiers of each key, they replace the rate and burst when set
+	tiers []Tier
+
+	// globalTiers 是所有键共享的全局限流层级
+	// globalTiers is the global rate limiting tiers shared by all keys
+	globalTiers []Tier
+
+	// costFunc 是代价函数
+	// costFunc is the cost function
+	costFunc CostFunc
+
+	// limitResolver 是每个键的限额解析函数，为 nil 时所有的键使用相同的速率和突发
+	// limitResolver is the limit resolver of each key, all keys use the same rate and burst when it is nil
+	limitResolver LimitResolver
+
+	// maxWait 是等待模式下请求最多等待的时间，为 0 时不等待，直接拒绝
+	// maxWait is the maximum time a request waits in wait mode, a request is rejected immediately when it is 0
+	maxWait time.Duration
+
+	// maxWaiters 是等待模式下每个键最多等待的请求数量
+	// maxWaiters is the maximum number of waiting requests per key in wait mode
+	maxWaiters int
+
+	// cacheTTL 是键的限流器在没有请求后保留的时间
+	// cacheTTL is the time the rate limiter of a key is kept after its last request
+	cacheTTL time.Duration
+
+	// cacheScanInterval 是清理过期的键的扫描间隔
+	// cacheScanInterval is the scan interval for removing expired keys
+	cacheScanInterval time.Duration
+
+	// cacheCapacity 是最多跟踪的键的数量，为 0 时不限制
+	// cacheCapacity is the maximum number of tracked keys, there is no limit when it is 0
+	cacheCapacity int
+
+	// banThreshold 是时间窗口内被拒绝多少次之后封禁键，为 0 时不自动封禁
+	// banThreshold is the number of rejections within the time window after which the key is banned, keys are not banned automatically when it is 0
+	banThreshold int
+
+	// banWindow 是统计被拒绝次数的时间窗口
+	// banWindow is the time window for counting rejections
+	banWindow time.Duration
+
+	// banDuration 是封禁时间
+	// banDuration is the ban duration
+	banDuration time.Duration
+
+	// banMaxDuration 是最长的封禁时间，大于封禁时间时，重复封禁的时间每次加倍
+	// banMaxDuration is the maximum ban duration, when it is greater than the ban duration, the duration of repeated bans doubles each time
+	banMaxDuration time.Duration
+
+	// snapshotFile 是定期保存快照的文件，为空时不保存快照
+	// snapshotFile is the file where snapshots are saved periodically, no snapshots are saved when it is empty
+	snapshotFile string
+
+	// snapshotInterval 是定期快照的间隔
+	// snapshotInterval is the interval of periodic snapshots
+	snapshotInterval time.Duration
+
+	// rule 是配置所属的规则的名称，只有规则的限流器使用的配置才不为空
+	// rule is the name of the rule the configuration belongs to, it is only non-empty in configurations used by the limiters of rules
+	rule string
+
 	// callback 是回调
 	// callback is the callback
 	callback Callback
@@ -48,13 +215,56 @@ func NewConfig() *Config {
 		// Sets the burst to the default limit burst
 		burst: DefaultLimitBurst,
 
+		// 设置限流算法为默认的限流算法
+		// Sets the algorithm to the default rate limiting algorithm
+		algorithm: DefaultAlgorithm,
+
 		// 设置匹配函数为默认的限制匹配函数
 		// Sets the match function to the default limit match function
 		matchFunc: com.DefaultLimitMatchFunc,
 
+		// 设置键函数为默认的键函数
+		// Sets the key function to the default key function
+		keyFunc: DefaultKeyFunc,
+
+		// 设置 IP 地址形式的键归并到的前缀长度为默认值
+		// Sets the prefix lengths IP address keys are aggregated to to the default values
+		ipv4Prefix: DefaultIpv4Prefix,
+		ipv6Prefix: DefaultIpv6Prefix,
+
+		// 设置限流响应头样式为默认的样式
+		// Sets the header style to the default style
+		headerStyle: DefaultHeaderStyle,
+
+		// 设置键函数没有找到键时的处理方式为默认值
+		// Sets how a request without a key is handled to the default value
+		missingKey: DefaultMissingKeyPolicy,
+
+		// 设置存储返回错误时请求的处理方式为默认值
+		// Sets how a request is handled when the store returns an error to the default value
+		storeFailure: DefaultStoreFailurePolicy,
+
+		// 设置拒绝处理函数为默认的拒绝处理函数
+		// Sets the reject handler to the default reject handler
+		rejectHandler: DefaultRejectHandler,
+
+		// 设置代价函数为默认的代价函数
+		// Sets the cost function to the default cost function
+		costFunc: DefaultCostFunc,
+
+		// 设置等待模式下每个键最多等待的请求数量为默认值
+		// Sets the maximum number of waiting requests per key in wait mode to the default value
+		maxWaiters: DefaultMaxWaiters,
+
+		// 设置键的缓存的过期时间、扫描间隔和容量为默认值
+		// Sets the expiration time, scan interval and capacity of the cache of keys to the default values
+		cacheTTL:          DefaultCacheTTL,
+		cacheScanInterval: DefaultCacheScanInterval,
+		cacheCapacity:     DefaultCacheCapacity,
+
 		// 设置IP白名单为默认的IP白名单
 		// Sets the IP whitelist to the default IP whitelist
-		ipWhitelist: com.DefaultIpWhitelist,
+		ipWhitelist: com.NewIpList(com.DefaultIpWhitelist...),
 
 		// 设置回调为空回调
 		// Sets the callback to the empty callback
@@ -89,6 +299,13 @@ func (c *Config) WithBurst(burst int) *Config {
 	return c
 }
 
+// WithAlgorithm 是一个方法，接收一个限流算法作为参数，设置配置的限流算法，并返回配置
+// WithAlgorithm is a method that takes a rate limiting algorithm as a parameter, sets the algorithm of the configuration, and returns the configuration
+func (c *Config) WithAlgorithm(algorithm Algorithm) *Config {
+	c.algorithm = algorithm
+	return c
+}
+
 // WithMatchFunc 是一个方法，接收一个匹配函数作为参数，设置配置的匹配函数，并返回配置
 // WithMatchFunc is a method that takes a match function as a parameter, sets the match function of the configuration, and returns the configuration
 func (c *Config) WithMatchFunc(fn com.HttpRequestHeaderMatchFunc) *Config {
@@ -96,15 +313,278 @@ func (c *Config) WithMatchFunc(fn com.HttpRequestHeaderMatchFunc) *Config {
 	return c
 }
 
-// WithIpWhitelist 是一个方法，接收一个字符串切片作为参数，设置配置的 IP 白名单，并返回配置
-// WithIpWhitelist is a method that takes a slice of strings as a parameter, sets the IP whitelist of the configuration, and returns the configuration
+// WithMissingKey 是一个方法，设置键函数没有找到键时的处理方式，并返回配置。默认使用客户端 IP 地址作为键
+// WithMissingKey is a method that sets how a request is handled when the key function finds no key, and returns the configuration. The client IP address is used as the key by default
+func (c *Config) WithMissingKey(policy MissingKeyPolicy) *Config {
+	c.missingKey = policy
+	return c
+}
+
+// WithKeyFunc 是一个方法，接收一个键函数作为参数，设置配置的键函数，并返回配置
+// WithKeyFunc is a method that takes a key function as a parameter, sets the key function of the configuration, and returns the configuration
+func (c *Config) WithKeyFunc(fn KeyFunc) *Config {
+	c.keyFunc = fn
+	return c
+}
+
+// WithHeaderStyle 是一个方法，接收一个响应头样式作为参数，设置配置的限流响应头样式，并返回配置
+// WithHeaderStyle is a method that takes a header style as a parameter, sets the rate limiting response header style of the configuration, and returns the configuration
+func (c *Config) WithHeaderStyle(style HeaderStyle) *Config {
+	c.headerStyle = style
+	return c
+}
+
+// WithRejectHandler 是一个方法，接收一个拒绝处理函数作为参数，设置配置的拒绝处理函数，并返回配置
+// WithRejectHandler is a method that takes a reject handler as a parameter, sets the reject handler of the configuration, and returns the configuration
+func (c *Config) WithRejectHandler(fn RejectHandler) *Config {
+	c.rejectHandler = fn
+	return c
+}
+
+// WithShadow 是一个方法，接收一个布尔值作为参数，设置限流器是否处于影子模式，并返回配置。
+// 影子模式下照常做出决策、写入限流响应头并调用回调，但是会被限流的请求不会被中止，而是继续处理，用于在启用新的限制之前观察哪些请求会被限流
+// WithShadow is a method that takes a boolean as a parameter, sets whether the limiter is in shadow mode, and returns the configuration.
+// In shadow mode decisions are made, the rate limiting response headers are written and the callback is called as usual, but requests that would be limited are not aborted and continue to be processed, which is used to see which requests would be limited before enabling a new limit
+func (c *Config) WithShadow(shadow bool) *Config {
+	c.shadow = shadow
+	return c
+}
+
+// WithStore 是一个方法，接收一个限流存储作为参数，设置配置的限流存储，并返回配置。
+// 设置后限流的状态保存在存储中，多个进程共享同一个存储时，限流在所有进程之间生效
+// WithStore is a method that takes a rate limiting store as a parameter, sets the rate limiting store of the configuration, and returns the configuration.
+// Once set, the rate limiting state is kept in the store, when multiple processes share the same store, the limit takes effect across all processes
+func (c *Config) WithStore(store Store) *Config {
+	c.store = store
+	return c
+}
+
+// WithStoreFailure 是一个方法，设置存储返回错误时请求的处理方式，并返回配置。默认放行请求 (StoreFailOpen)
+// WithStoreFailure is a method that sets how a request is handled when the store returns an error, and returns the configuration. The request is allowed by default (StoreFailOpen)
+func (c *Config) WithStoreFailure(policy StoreFailurePolicy) *Config {
+	c.storeFailure = policy
+	return c
+}
+
+// WithTiers 是一个方法，接收多个层级作为参数，设置每个键的限流层级，并返回配置。
+// 设置后每个键的限流器由所有层级组成，代替速率和突发，只有所有层级都允许时请求才会被允许并消耗令牌，
+// 例如 WithTiers(MustParseTiers("10/s;500/m")...)
+// WithTiers is a method that takes tiers as parameters, sets the rate limiting tiers of each key, and returns the configuration.
+// Once set, the limiter of each key is composed of all tiers instead of the rate and burst, and a request is only allowed and consumes tokens when all tiers allow,
+// e.g. WithTiers(MustParseTiers("10/s;500/m")...)
+func (c *Config) WithTiers(tiers ...Tier) *Config {
+	c.tiers = tiers
+	return c
+}
+
+// WithGlobalTiers 是一个方法，接收多个层级作为参数，设置所有键共享的全局限流层级，并返回配置。
+// 全局层级与每个键的层级一起检查，例如每个 IP 10/s，同时全局 5000/s
+// WithGlobalTiers is a method that takes tiers as parameters, sets the global rate limiting tiers shared by all keys, and returns the configuration.
+// The global tiers are checked together with the tiers of each key, such as 10/s per IP and 5000/s globally at the same time
+func (c *Config) WithGlobalTiers(tiers ...Tier) *Config {
+	c.globalTiers = tiers
+	return c
+}
+
+// WithCostFunc 是一个方法，接收一个代价函数作为参数，设置配置的代价函数，并返回配置。
+// 每个请求消耗代价函数返回的令牌数量，小于 1 的代价按 1 计算，代价超过突发的请求永远不会被允许
+// WithCostFunc is a method that takes a cost function as a parameter, sets the cost function of the configuration, and returns the configuration.
+// Each request consumes the number of tokens returned by the cost function, a cost less than 1 counts as 1, and a request whose cost exceeds the burst is never allowed
+func (c *Config) WithCostFunc(fn CostFunc) *Config {
+	c.costFunc = fn
+	return c
+}
+
+// WithLimitResolver 是一个方法，接收一个限额解析函数作为参数，设置每个键的限额解析函数，并返回配置。
+// 设置后每个键的限流器使用解析出的速率和突发创建，例如不同套餐的客户使用不同的配额，解析结果优先于配置和规则的速率和突发。
+// 配置了层级时，层级代替解析出的速率和突发
+// WithLimitResolver is a method that takes a limit resolver as a parameter, sets the limit resolver of each key, and returns the configuration.
+// Once set, the limiter of each key is created with the resolved rate and burst, such as different quotas for customers on different plans, the resolved values take precedence over the rate and burst of the configuration and of rules.
+// When tiers are configured, the tiers replace the resolved rate and burst
+func (c *Config) WithLimitResolver(fn LimitResolver) *Config {
+	c.limitResolver = fn
+	return c
+}
+
+// WithMaxWait 是一个方法，接收一个时间作为参数，开启等待模式并设置请求最多等待的时间，并返回配置。
+// 等待模式下被限流的请求会预留令牌并等待，只有等待时间超过 maxWait 或者请求的上下文被取消时才会被拒绝，为 0 时关闭等待模式
+// WithMaxWait is a method that takes a duration as a parameter, enables wait mode and sets the maximum time a request waits, and returns the configuration.
+// In wait mode a limited request reserves a token and waits, it is only rejected when the wait exceeds maxWait or the context of the request is canceled, 0 disables wait mode
+func (c *Config) WithMaxWait(maxWait time.Duration) *Config {
+	c.maxWait = maxWait
+	return c
+}
+
+// WithMaxWaiters 是一个方法，接收一个整数作为参数，设置等待模式下每个键最多等待的请求数量，并返回配置，超出的请求会被直接拒绝
+// WithMaxWaiters is a method that takes an integer as a parameter, sets the maximum number of waiting requests per key in wait mode, and returns the configuration, requests beyond it are rejected immediately
+func (c *Config) WithMaxWaiters(maxWaiters int) *Config {
+	c.maxWaiters = maxWaiters
+	return c
+}
+
+// WithCacheTTL 是一个方法，设置键的限流器在没有请求后保留的时间，并返回配置。过期的键会重新从满的桶开始
+// WithCacheTTL is a method that sets the time the rate limiter of a key is kept after its last request, and returns the configuration. An expired key starts again from a full bucket
+func (c *Config) WithCacheTTL(ttl time.Duration) *Config {
+	c.cacheTTL = ttl
+	return c
+}
+
+// WithCacheScanInterval 是一个方法，设置清理过期的键的扫描间隔，并返回配置
+// WithCacheScanInterval is a method that sets the scan interval for removing expired keys, and returns the configuration
+func (c *Config) WithCacheScanInterval(interval time.Duration) *Config {
+	c.cacheScanInterval = interval
+	return c
+}
+
+// WithCacheCapacity 是一个方法，设置最多跟踪的键的数量，并返回配置。超过时淘汰最久没有请求的键 (LRU)，为 0 时不限制。
+// 容量平均分配到缓存的每个段，所以实际的容量会向上取整到段数量的整数倍
+// WithCacheCapacity is a method that sets the maximum number of tracked keys, and returns the configuration. The key without requests for the longest time is evicted when it is exceeded (LRU), there is no limit when it is 0.
+// The capacity is split evenly across the segments of the cache, so the actual capacity is rounded up to a multiple of the number of segments
+func (c *Config) WithCacheCapacity(capacity int) *Config {
+	c.cacheCapacity = capacity
+	return c
+}
+
+// WithBanThreshold 是一个方法，设置键在时间窗口内被拒绝多少次之后被封禁，并返回配置，为 0 时不自动封禁。
+// 被封禁的键的请求在检查限流器之前就被拒绝
+// WithBanThreshold is a method that sets the number of rejections within the time window after which a key is banned, and returns the configuration, keys are not banned automatically when it is 0.
+// Requests of a banned key are rejected before the rate limiter is checked
+func (c *Config) WithBanThreshold(threshold int) *Config {
+	c.banThreshold = threshold
+	return c
+}
+
+// WithBanWindow 是一个方法，设置统计被拒绝次数的时间窗口，并返回配置，时间窗口从第一次被拒绝开始
+// WithBanWindow is a method that sets the time window for counting rejections, and returns the configuration, the time window starts at the first rejection
+func (c *Config) WithBanWindow(window time.Duration) *Config {
+	c.banWindow = window
+	return c
+}
+
+// WithBanDuration 是一个方法，设置封禁时间，并返回配置
+// WithBanDuration is a method that sets the ban duration, and returns the configuration
+func (c *Config) WithBanDuration(duration time.Duration) *Config {
+	c.banDuration = duration
+	return c
+}
+
+// WithBanMaxDuration 是一个方法，设置最长的封禁时间，并返回配置。大于封禁时间时，同一个键重复被封禁的时间每次加倍，直到最长的封禁时间。
+// 键在时间窗口加上最长封禁时间内没有再被拒绝时，封禁的次数清零
+// WithBanMaxDuration is a method that sets the maximum ban duration, and returns the configuration. When it is greater than the ban duration, the duration of repeated bans of the same key doubles each time, up to the maximum ban duration.
+// The ban count of a key is reset when it is not rejected again within the time window plus the maximum ban duration
+func (c *Config) WithBanMaxDuration(duration time.Duration) *Config {
+	c.banMaxDuration = duration
+	return c
+}
+
+// WithSnapshotFile 是一个方法，设置保存限流器状态快照的文件，并返回配置。
+// 设置后 IpRateLimiter 在创建时从文件恢复状态，之后定期并在停止时将快照原子地写入文件，所以状态在滚动重启之后仍然保留
+// WithSnapshotFile is a method that sets the file where the snapshots of the limiter state are saved, and returns the configuration.
+// Once set, IpRateLimiter restores the state from the file when created, then atomically writes snapshots to the file periodically and when stopped, so the state survives a rolling restart
+func (c *Config) WithSnapshotFile(path string) *Config {
+	c.snapshotFile = path
+	return c
+}
+
+// WithSnapshotInterval 是一个方法，设置定期快照的间隔，并返回配置
+// WithSnapshotInterval is a method that sets the interval of periodic snapshots, and returns the configuration
+func (c *Config) WithSnapshotInterval(interval time.Duration) *Config {
+	c.snapshotInterval = interval
+	return c
+}
+
+// WithIpWhitelist 是一个方法，接收一个字符串切片作为参数，设置配置的 IP 白名单，并返回配置。每一项是一个 IP 地址或者 CIDR 网段，无法解析的项被忽略
+// WithIpWhitelist is a method that takes a slice of strings as a parameter, sets the IP whitelist of the configuration, and returns the configuration. Each item is an IP address or a CIDR network, items that cannot be parsed are ignored
 func (c *Config) WithIpWhitelist(whitelist []string) *Config {
-	for _, ip := range whitelist {
-		c.ipWhitelist[ip] = com.Empty
-	}
+	c.ipWhitelist.Add(whitelist...)
+	return c
+}
+
+// WithIpResolver 是一个方法，接收一个客户端 IP 地址的解析器作为参数，设置 IP 白名单和默认的键函数使用的解析器，并返回配置。
+// 为 nil 时使用 gin.Context 的 ClientIP 方法，它的结果取决于 gin 引擎的设置
+// WithIpResolver is a method that takes a resolver of the client IP address as a parameter, sets the resolver used by the IP whitelist and the default key function, and returns the configuration.
+// The ClientIP method of gin.Context is used when it is nil, whose result depends on the settings of the gin engine
+func (c *Config) WithIpResolver(resolver *IpResolver) *Config {
+	c.ipResolver = resolver
 	return c
 }
 
+// WithIpv4Prefix 是一个方法，设置 IPv4 地址形式的键归并到的前缀长度，并返回配置。例如为 24 时同一个 /24 网段的地址共用一个桶，
+// 有效的范围是 16 到 32，超出范围时使用默认值
+// WithIpv4Prefix is a method that sets the prefix length IPv4 address keys are aggregated to, and returns the configuration. For example, when it is 24, the addresses of the same /24 network share one bucket,
+// the valid range is 16 to 32, the default value is used when it is out of range
+func (c *Config) WithIpv4Prefix(bits int) *Config {
+	c.ipv4Prefix = bits
+	return c
+}
+
+// WithIpv6Prefix 是一个方法，设置 IPv6 地址形式的键归并到的前缀长度，并返回配置。有效的范围是 48 到 128，为 128 时不归并，超出范围时使用默认值
+// WithIpv6Prefix is a method that sets the prefix length IPv6 address keys are aggregated to, and returns the configuration. The valid range is 48 to 128, there is no aggregation when it is 128, the default value is used when it is out of range
+func (c *Config) WithIpv6Prefix(bits int) *Config {
+	c.ipv6Prefix = bits
+	return c
+}
+
+// clientIP 方法返回请求的客户端 IP 地址，配置了解析器时将结果保存在 gin.Context 中，供 KeyByClientIP 和后续的处理函数使用
+// The clientIP method returns the client IP address of the request, when a resolver is configured the result is saved in the gin.Context for KeyByClientIP and subsequent handlers
+func (c *Config) clientIP(ctx *gin.Context) string {
+	if c.ipResolver == nil {
+		return ctx.ClientIP()
+	}
+
+	ip := c.ipResolver.ClientIP(ctx.Request)
+	ctx.Set(ClientIPContextKey, ip)
+	return ip
+}
+
+// normalizeKey 方法将 IP 地址形式的键归并为配置的前缀长度的网段，例如 "2001:db8::1" 归并为 "2001:db8::/64"。
+// IPv4 映射的 IPv6 地址按 IPv4 地址归并，不是 IP 地址的键不归并，已经归并的键保持不变
+// The normalizeKey method aggregates an IP address key to the network of the configured prefix length, e.g. "2001:db8::1" is aggregated to "2001:db8::/64".
+// IPv4-mapped IPv6 addresses are aggregated as IPv4 addresses, keys that are not IP addresses are not aggregated, and keys already aggregated are kept
+func (c *Config) normalizeKey(key string) string {
+	if addr, ok := parseKeyAddr(key); ok {
+		// 解析成功的 IPv4 地址已经是规范形式
+		// IPv4 addresses that parse successfully are already in the canonical form
+		canonical, bits := addr.Is4(), c.ipv6Prefix
+		if addr.Is4() || addr.Is4In6() {
+			addr, bits = addr.Unmap(), c.ipv4Prefix
+		}
+
+		// 不需要归并时，只有不是规范形式的地址才改写，使同一个地址总是对应同一个键
+		// When no aggregation is needed, only addresses not in the canonical form are rewritten, so that the same address always maps to the same key
+		if bits >= addr.BitLen() {
+			if !canonical {
+				key = addr.WithZone("").String()
+			}
+		} else if prefix, err := addr.WithZone("").Prefix(bits); err == nil {
+			key = prefix.String()
+		}
+	}
+
+	return key
+}
+
+// parseKeyAddr 是一个函数，将键解析为 IP 地址。先检查字符，所以不是 IP 地址的键不会在解析失败时分配内存
+// parseKeyAddr is a function that parses the key as an IP address. The characters are checked first, so keys that are not IP addresses do not allocate memory when the parsing fails
+func parseKeyAddr(key string) (netip.Addr, bool) {
+	separator := false
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case c == '.' || c == ':':
+			separator = true
+		case c == '%':
+			i = len(key)
+		case (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F'):
+			return netip.Addr{}, false
+		}
+	}
+	if !separator {
+		return netip.Addr{}, false
+	}
+	addr, err := netip.ParseAddr(key)
+	return addr, err == nil
+}
+
 // isConfigValid 是一个函数，它接收一个 Config 指针作为参数，检查配置是否有效，如果无效则设置为默认值，最后返回有效的配置
 // isConfigValid is a function that takes a pointer to Config as a parameter, checks if the configuration is valid, if not, sets it to the default value, and finally returns the valid configuration
 func isConfigValid(config *Config) *Config {
@@ -123,16 +603,126 @@ func isConfigValid(config *Config) *Config {
 			config.burst = DefaultLimitBurst
 		}
 
+		// 如果限流算法不是已知的算法，则设置为默认的限流算法
+		// If the algorithm is not a known algorithm, set it to the default rate limiting algorithm
+		if config.algorithm < AlgorithmTokenBucket || config.algorithm > AlgorithmGCRA {
+			config.algorithm = DefaultAlgorithm
+		}
+
 		// 如果匹配函数为 nil，则设置为默认的限制匹配函数
 		// If the match function is nil, set it to the default limit match function
 		if config.matchFunc == nil {
 			config.matchFunc = com.DefaultLimitMatchFunc
 		}
 
+		// 如果键函数为 nil，则设置为默认的键函数
+		// If the key function is nil, set it to the default key function
+		if config.keyFunc == nil {
+			config.keyFunc = DefaultKeyFunc
+		}
+
+		// 如果 IP 地址形式的键归并到的前缀长度超出范围，则设置为默认值
+		// If the prefix lengths IP address keys are aggregated to are out of range, set them to the default values
+		if config.ipv4Prefix < minIpv4Prefix || config.ipv4Prefix > 32 {
+			config.ipv4Prefix = DefaultIpv4Prefix
+		}
+		if config.ipv6Prefix < minIpv6Prefix || config.ipv6Prefix > 128 {
+			config.ipv6Prefix = DefaultIpv6Prefix
+		}
+
+		// 如果限流响应头样式不是已知的样式，则设置为默认的样式
+		// If the header style is not a known style, set it to the default style
+		if config.headerStyle < HeaderStyleNone || config.headerStyle > HeaderStyleLegacy {
+			config.headerStyle = DefaultHeaderStyle
+		}
+
+		// 如果键函数没有找到键时的处理方式不是已知的方式，则设置为默认值
+		// If the way a request without a key is handled is not a known one, set it to the default value
+		if config.missingKey < MissingKeyClientIP || config.missingKey > MissingKeyReject {
+			config.missingKey = DefaultMissingKeyPolicy
+		}
+
+		// 如果存储返回错误时请求的处理方式不是已知的方式，则设置为默认值
+		// If the way a request is handled when the store returns an error is not a known one, set it to the default value
+		if config.storeFailure < StoreFailOpen || config.storeFailure > StoreFailClosed {
+			config.storeFailure = DefaultStoreFailurePolicy
+		}
+
+		// 如果代价函数为 nil，则设置为默认的代价函数
+		// If the cost function is nil, set it to the default cost function
+		if config.costFunc == nil {
+			config.costFunc = DefaultCostFunc
+		}
+
+		// 去掉无效的层级
+		// Drop invalid tiers
+		config.tiers = validTiers(config.tiers)
+		config.globalTiers = validTiers(config.globalTiers)
+
+		// 如果最大等待时间小于 0，则关闭等待模式
+		// If the maximum wait time is less than 0, disable wait mode
+		if config.maxWait < 0 {
+			config.maxWait = 0
+		}
+
+		// 如果最大等待请求数量小于等于 0，则设置为默认值
+		// If the maximum number of waiting requests is less than or equal to 0, set it to the default value
+		if config.maxWaiters <= 0 {
+			config.maxWaiters = DefaultMaxWaiters
+		}
+
+		// 如果键的缓存的过期时间或者扫描间隔小于等于 0，则设置为默认值
+		// If the expiration time or the scan interval of the cache of keys is less than or equal to 0, set it to the default value
+		if config.cacheTTL <= 0 {
+			config.cacheTTL = DefaultCacheTTL
+		}
+		if config.cacheScanInterval <= 0 {
+			config.cacheScanInterval = DefaultCacheScanInterval
+		}
+
+		// 如果键的缓存的容量小于 0，则不限制
+		// If the capacity of the cache of keys is less than 0, there is no limit
+		if config.cacheCapacity < 0 {
+			config.cacheCapacity = 0
+		}
+
+		// 如果封禁阈值小于 0，则不自动封禁
+		// If the ban threshold is less than 0, keys are not banned automatically
+		if config.banThreshold < 0 {
+			config.banThreshold = 0
+		}
+
+		// 如果封禁的时间窗口或者封禁时间小于等于 0，则设置为默认值
+		// If the time window or the duration of bans is less than or equal to 0, set it to the default value
+		if config.banWindow <= 0 {
+			config.banWindow = DefaultBanWindow
+		}
+		if config.banDuration <= 0 {
+			config.banDuration = DefaultBanDuration
+		}
+
+		// 如果最长的封禁时间小于封禁时间，则封禁时间不增长
+		// If the maximum ban duration is less than the ban duration, the ban duration does not grow
+		if config.banMaxDuration < config.banDuration {
+			config.banMaxDuration = config.banDuration
+		}
+
+		// 如果定期快照的间隔小于等于 0，则设置为默认值
+		// If the interval of periodic snapshots is less than or equal to 0, set it to the default value
+		if config.snapshotInterval <= 0 {
+			config.snapshotInterval = DefaultSnapshotInterval
+		}
+
 		// 如果 IP 白名单为 nil，则设置为默认的 IP 白名单
 		// If the IP whitelist is nil, set it to the default IP whitelist
 		if config.ipWhitelist == nil {
-			config.ipWhitelist = com.DefaultIpWhitelist
+			config.ipWhitelist = com.NewIpList(com.DefaultIpWhitelist...)
+		}
+
+		// 如果拒绝处理函数为 nil，则设置为默认的拒绝处理函数
+		// If the reject handler is nil, set it to the default reject handler
+		if config.rejectHandler == nil {
+			config.rejectHandler = DefaultRejectHandler
 		}
 
 		// 如果回调为 nil，则设置为空回调
@@ -150,3 +740,61 @@ func isConfigValid(config *Config) *Config {
 	// Return the valid configuration
 	return config
 }
+
+// liveConfig 是一个可以在运行时修改的配置，读取时无锁地原子加载，修改时在锁内复制一份新的配置，修改并校验后原子地替换 (写时复制)
+// liveConfig is a configuration that can be changed at runtime, it is loaded atomically without locks when reading,
+// and when changing it, a new copy is made within the lock, modified, validated and then replaced atomically (copy-on-write)
+type liveConfig struct {
+	// mu 是保证修改互斥的锁
+	// mu is the lock that makes changes mutually exclusive
+	mu sync.Mutex
+
+	// value 是当前的配置，不能被修改
+	// value is the current configuration, it must not be modified
+	value atomic.Pointer[Config]
+}
+
+// newLiveConfig 是一个函数，返回一个初始值为指定配置的可修改配置
+// newLiveConfig is a function that returns a live configuration whose initial value is the specified configuration
+func newLiveConfig(config *Config) *liveConfig {
+	v := &liveConfig{}
+	v.value.Store(config)
+	return v
+}
+
+// Load 方法返回当前的配置，一个请求应该只加载一次，以便在整个处理过程中使用一致的配置
+// The Load method returns the current configuration, a request should load it only once so that it uses a consistent configuration during the whole processing
+func (v *liveConfig) Load() *Config {
+	return v.value.Load()
+}
+
+// Update 方法复制当前的配置，使用 modify 修改副本并校验后替换当前的配置，然后在同一个锁内调用 apply 将新的配置应用到已有的限流器，
+// 所以并发的修改按顺序生效，已有的限流器最终与当前的配置一致
+// The Update method copies the current configuration, modifies the copy with modify, validates it and replaces the current configuration,
+// then calls apply within the same lock to apply the new configuration to the existing rate limiters,
+// so concurrent changes take effect in order, and the existing rate limiters end up consistent with the current configuration
+func (v *liveConfig) Update(modify func(config *Config), apply func(config *Config)) *Config {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// 复制并修改当前的配置
+	// Copy and modify the current configuration
+	c := *v.value.Load()
+	modify(&c)
+	config := isConfigValid(&c)
+
+	// 先替换配置，之后创建的限流器使用新的配置，再将新的配置应用到已有的限流器
+	// Replace the configuration first so that rate limiters created afterwards use the new configuration, then apply the new configuration to the existing rate limiters
+	v.value.Store(config)
+	if apply != nil {
+		apply(config)
+	}
+
+	return config
+}
+
+// cacheOptions 是一个函数，返回配置中键的缓存的选项
+// cacheOptions is a function that returns the options of the cache of keys in the configuration
+func cacheOptions(config *Config) *itl.Options {
+	return &itl.Options{ExpireTime: config.cacheTTL, ScanInterval: config.cacheScanInterval, Capacity: config.cacheCapacity}
+}
@@ -0,0 +1,22 @@
+package ratelimiter
+
+import "net/http"
+
+// CostFunc 是一个代价函数，返回请求需要消耗的令牌数量，开销大的请求 (例如导出、搜索) 可以消耗更多的配额
+// CostFunc is a cost function that returns the number of tokens a request consumes, expensive requests (such as exports and searches) can consume more of the quota
+type CostFunc func(r *http.Request) int
+
+// DefaultCostFunc 是默认的代价函数，每个请求消耗一个令牌
+// DefaultCostFunc is the default cost function, each request consumes one token
+var DefaultCostFunc = func(r *http.Request) int {
+	return 1
+}
+
+// costOf 是一个函数，使用配置的代价函数计算请求的代价，代价至少为 1，避免代价函数绕过限流
+// costOf is a function that calculates the cost of the request with the cost function of the configuration, the cost is at least 1 so that the cost function cannot bypass the limit
+func costOf(config *Config, r *http.Request) int {
+	if cost := config.costFunc(r); cost > 1 {
+		return cost
+	}
+	return 1
+}
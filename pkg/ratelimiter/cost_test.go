@@ -0,0 +1,112 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCostCallback struct {
+	costs []int
+}
+
+func (c *testCostCallback) OnLimited(r *http.Request) {}
+
+func (c *testCostCallback) OnDecision(r *http.Request, d *Decision) {
+	if !d.Allowed {
+		c.costs = append(c.costs, d.Cost)
+	}
+}
+
+// testCostFunc reads the cost from the "cost" query parameter
+func testCostFunc(r *http.Request) int {
+	cost, err := strconv.Atoi(r.URL.Query().Get("cost"))
+	if err != nil {
+		return 1
+	}
+	return cost
+}
+
+func testCostRequest(router *gin.Engine, cost int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, com.TestUrlPath+"?cost="+strconv.Itoa(cost), nil)
+	req.RemoteAddr = com.TestEndpoint2
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestRateLimiter_CostFunc(t *testing.T) {
+	callback := &testCostCallback{}
+	conf := NewConfig().WithRate(1).WithBurst(5).WithCostFunc(testCostFunc).WithCallback(callback)
+	router := testHeadersRouter(NewRateLimiter(conf).HandlerFunc())
+
+	// An expensive request consumes more of the quota
+	resp := testCostRequest(router, 3)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get(HeaderRateLimitRemaining))
+
+	// The remaining quota is not enough for another expensive request
+	resp = testCostRequest(router, 3)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get(HeaderRetryAfter))
+
+	// But it is enough for cheap requests, and a cost less than 1 counts as 1
+	assert.Equal(t, http.StatusOK, testCostRequest(router, 1).Code)
+	assert.Equal(t, http.StatusOK, testCostRequest(router, 0).Code)
+	assert.Equal(t, http.StatusTooManyRequests, testCostRequest(router, -1).Code)
+
+	// The callback sees the cost of the limited requests
+	assert.Equal(t, []int{3, 1}, callback.costs)
+}
+
+func TestIpRateLimiter_CostFunc(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmSlidingLog, AlgorithmFixedWindow, AlgorithmGCRA} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			callback := &testCostCallback{}
+			conf := NewConfig().WithRate(1).WithBurst(4).WithAlgorithm(algorithm).WithCostFunc(testCostFunc).WithCallback(callback)
+			limiter := NewIpRateLimiter(conf)
+			defer limiter.Stop()
+			router := testHeadersRouter(limiter.HandlerFunc())
+
+			assert.Equal(t, http.StatusOK, testCostRequest(router, 2).Code)
+			assert.Equal(t, http.StatusOK, testCostRequest(router, 2).Code)
+			assert.Equal(t, http.StatusTooManyRequests, testCostRequest(router, 2).Code)
+
+			// A request costing more than the burst is never allowed
+			assert.Equal(t, http.StatusTooManyRequests, testCostRequest(router, 5).Code)
+
+			assert.Equal(t, []int{2, 5}, callback.costs)
+		})
+	}
+}
+
+func TestIpRateLimiter_CostStore(t *testing.T) {
+	_, _, store := testRedisStore(t)
+
+	conf := NewConfig().WithRate(1).WithBurst(4).WithCostFunc(testCostFunc).WithStore(store)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	resp := testCostRequest(router, 3)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, http.StatusTooManyRequests, testCostRequest(router, 2).Code)
+}
+
+func TestRateLimiter_CostWait(t *testing.T) {
+	// 10 tokens per second with a burst of 2, a request costing 2 waits for 200ms
+	conf := NewConfig().WithRate(10).WithBurst(2).WithCostFunc(testCostFunc).WithMaxWait(500 * time.Millisecond)
+	router := testHeadersRouter(NewRateLimiter(conf).HandlerFunc())
+
+	start := time.Now()
+	assert.Equal(t, http.StatusOK, testCostRequest(router, 2).Code)
+	assert.Equal(t, http.StatusOK, testCostRequest(router, 2).Code)
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
@@ -0,0 +1,200 @@
+package ratelimiter
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// DecisionContextKey 是限流决策保存在 gin.Context 中的键
+// DecisionContextKey is the key under which the rate limiting decision is saved in the gin.Context
+const DecisionContextKey = "ratelimiter.decision"
+
+// Delayer 是一个可选的接口，限流器实现这个接口时，由限流器自身计算等待可用令牌的时间
+// Delayer is an optional interface, when a limiter implements it, the limiter calculates the time to wait for available tokens itself
+type Delayer interface {
+	// DelayAt 返回从时间 t 开始，直到 n 个令牌可用需要等待的时间
+	// DelayAt returns the time to wait from time t until n tokens are available
+	DelayAt(t time.Time, n int) time.Duration
+}
+
+// Decision 是限流决策，包含限流器在做出决策时的状态
+// Decision is the rate limiting decision, containing the state of the limiter when the decision is made
+type Decision struct {
+	// Allowed 表示请求是否被允许
+	// Allowed indicates whether the request is allowed
+	Allowed bool
+
+	// Whitelisted 表示请求因为客户端 IP 地址在白名单中而没有被限流
+	// Whitelisted indicates that the request is not limited because the client IP address is in the whitelist
+	Whitelisted bool
+
+	// Skipped 表示请求因为不匹配匹配函数、没有匹配的规则或者没有键 (MissingKeySkip) 而没有被限流
+	// Skipped indicates that the request is not limited because it does not match the match function, matches no rule or has no key (MissingKeySkip)
+	Skipped bool
+
+	// MissingKey 表示键函数没有找到键，请求按配置的 MissingKeyPolicy 处理
+	// MissingKey indicates that the key function found no key, and the request is handled by the configured MissingKeyPolicy
+	MissingKey bool
+
+	// Banned 表示请求因为键被封禁而被拒绝，没有检查限流器
+	// Banned indicates that the request is rejected because the key is banned, without checking the limiter
+	Banned bool
+
+	// Shadow 表示请求本应被拒绝，但是因为限流器处于影子模式而被放行，此时 Allowed 为 false
+	// Shadow indicates that the request would have been rejected, but it is let through because the limiter is in shadow mode, Allowed is false in this case
+	Shadow bool
+
+	// Key 是限流的键
+	// Key is the rate limiting key
+	Key string
+
+	// Rule 是匹配的规则的名称，没有使用规则时为空
+	// Rule is the name of the matching rule, it is empty when no rule is used
+	Rule string
+
+	// Limit 是限流器的配额，即突发的大小
+	// Limit is the quota of the limiter, which is the size of the burst
+	Limit int
+
+	// Remaining 是决策之后剩余的配额
+	// Remaining is the quota remaining after the decision
+	Remaining int
+
+	// Reset 是配额完全恢复需要的时间
+	// Reset is the time needed for the quota to be fully restored
+	Reset time.Duration
+
+	// RetryAfter 是请求被拒绝时，客户端需要等待的时间
+	// RetryAfter is the time the client needs to wait when the request is rejected
+	RetryAfter time.Duration
+
+	// Cost 是请求消耗的令牌数量
+	// Cost is the number of tokens the request consumes
+	Cost int
+
+	// StoreError 是存储返回的错误，此时决策由配置的 StoreFailurePolicy 做出
+	// StoreError is the error returned by the store, the decision is made by the configured StoreFailurePolicy in this case
+	StoreError error
+}
+
+// GetDecision 是一个函数，返回限流中间件保存在 gin.Context 中的决策，后续的处理函数可以使用它
+// GetDecision is a function that returns the decision saved in the gin.Context by the rate limiting middleware, subsequent handlers can use it
+func GetDecision(ctx *gin.Context) (*Decision, bool) {
+	if value, ok := ctx.Get(DecisionContextKey); ok {
+		d, ok := value.(*Decision)
+		return d, ok
+	}
+	return nil, false
+}
+
+// applyDecision 是一个函数，将决策保存到 gin.Context 中，然后根据决策放行请求，或者中止请求并写入拒绝响应，最后调用相应的回调。
+// 影子模式下被拒绝的请求调用回调之后继续处理
+// applyDecision is a function that saves the decision in the gin.Context, then allows the request according to the decision, or aborts it and writes the reject response, and finally calls the corresponding callbacks.
+// In shadow mode a rejected request continues to be processed after the callbacks are called
+func applyDecision(ctx *gin.Context, config *Config, d *Decision) {
+	// 将决策保存到 gin.Context 中
+	// Save the decision in the gin.Context
+	ctx.Set(DecisionContextKey, d)
+
+	// 如果请求被拒绝，则中止请求处理，调用拒绝处理函数写入拒绝响应，并调用回调处理限流事件
+	// If the request is rejected, abort the request processing, call the reject handler to write the reject response, and call the callback to handle the rate limiting event
+	if !d.Allowed && !config.shadow {
+		ctx.Abort()
+		config.rejectHandler(ctx, d)
+		config.callback.OnLimited(ctx.Request)
+		notifyDecision(config, ctx.Request, d)
+		return
+	}
+
+	// 如果请求在影子模式下被拒绝，则标记决策并调用回调处理限流事件，但是不中止请求
+	// If the request is rejected in shadow mode, mark the decision and call the callback to handle the rate limiting event, but do not abort the request
+	if !d.Allowed {
+		d.Shadow = true
+		config.callback.OnLimited(ctx.Request)
+	}
+	notifyDecision(config, ctx.Request, d)
+
+	// 执行后续的请求处理
+	// Execute subsequent request processing
+	ctx.Next()
+}
+
+// notifyDecision 是一个函数，如果配置的回调实现了 DecisionCallback 接口，则通知限流器做出的决策
+// notifyDecision is a function that notifies the decision made by the limiter if the callback of the configuration implements the DecisionCallback interface
+func notifyDecision(config *Config, r *http.Request, d *Decision) {
+	if callback, ok := config.callback.(DecisionCallback); ok {
+		callback.OnDecision(r, d)
+	}
+}
+
+// newDecision 是一个函数，根据限流器在时间 t 的状态创建一个新的决策
+// newDecision is a function that creates a new decision based on the state of the limiter at time t
+func newDecision(limiter Limiter, t time.Time, n int, allowed bool) *Decision {
+	// 获取配额和剩余的令牌数量
+	// Get the quota and the number of tokens remaining
+	burst := limiter.Burst()
+	remaining := math.Floor(limiter.TokensAt(t))
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	d := &Decision{
+		Allowed:   allowed,
+		Limit:     burst,
+		Remaining: int(remaining),
+		Reset:     delayAt(limiter, t, burst),
+		Cost:      n,
+	}
+
+	// 如果请求被拒绝，则计算需要等待的时间
+	// If the request is rejected, calculate the time to wait
+	if !allowed {
+		d.RetryAfter = delayAt(limiter, t, n)
+	}
+
+	return d
+}
+
+// delayAt 是一个函数，返回从时间 t 开始，直到限流器有 n 个令牌可用需要等待的时间
+// delayAt is a function that returns the time to wait from time t until n tokens of the limiter are available
+func delayAt(limiter Limiter, t time.Time, n int) time.Duration {
+	// 如果限流器实现了 Delayer 接口，则由限流器自身计算
+	// If the limiter implements the Delayer interface, let the limiter calculate it itself
+	if d, ok := limiter.(Delayer); ok {
+		return d.DelayAt(t, n)
+	}
+
+	// 否则按照令牌桶的方式计算：缺少的令牌数量除以速率
+	// Otherwise calculate it as a token bucket: the number of missing tokens divided by the rate
+	limit := limiter.Limit()
+	if limit == rate.Inf {
+		return 0
+	}
+
+	tokens := limiter.TokensAt(t)
+	if tokens >= float64(n) {
+		return 0
+	}
+
+	if limit <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return durationOf((float64(n) - tokens) / float64(limit))
+}
+
+// durationOf 是一个函数，将秒数转换为 time.Duration，并限制在 time.Duration 的范围内
+// durationOf is a function that converts seconds to time.Duration and clamps it to the range of time.Duration
+func durationOf(seconds float64) time.Duration {
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
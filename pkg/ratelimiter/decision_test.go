@@ -0,0 +1,271 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type testDecisionCallback struct {
+	mu      sync.Mutex
+	calls   int
+	limited []Decision
+	allowed []Decision
+}
+
+func (c *testDecisionCallback) OnLimited(r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+}
+
+func (c *testDecisionCallback) OnDecision(r *http.Request, d *Decision) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d.Allowed {
+		c.allowed = append(c.allowed, *d)
+	} else {
+		c.limited = append(c.limited, *d)
+	}
+}
+
+// testDecisionRouter returns a router whose handlers respond with the decision saved in the context
+func testDecisionRouter(handler gin.HandlerFunc, decisions *[]*Decision) *gin.Engine {
+	router := gin.New()
+	router.Use(handler)
+	router.Any("/*path", func(c *gin.Context) {
+		d, ok := GetDecision(c)
+		if ok {
+			*decisions = append(*decisions, d)
+		}
+		c.String(http.StatusOK, "OK")
+	})
+	return router
+}
+
+func testDecisionRequest(router *gin.Engine, path, ep string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = ep
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp.Code
+}
+
+func TestRateLimiter_Decision(t *testing.T) {
+	callback := &testDecisionCallback{}
+	conf := NewConfig().WithRate(1).WithBurst(1).WithCallback(callback)
+	decisions := []*Decision{}
+	router := testDecisionRouter(NewRateLimiter(conf).HandlerFunc(), &decisions)
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, com.TestEndpoint2))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, com.TestEndpoint2))
+
+	// The allowed request is reported to OnDecision and saved in the context
+	assert.Len(t, callback.allowed, 1)
+	assert.Len(t, decisions, 1)
+	d := callback.allowed[0]
+	assert.True(t, d.Allowed)
+	assert.Equal(t, DefaultStoreGlobalKey, d.Key)
+	assert.Equal(t, 1, d.Limit)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, d, *decisions[0])
+
+	// The rejected request is reported to OnLimited, and to OnDecision with the time to retry
+	assert.Equal(t, 1, callback.calls)
+	assert.Len(t, callback.limited, 1)
+	d = callback.limited[0]
+	assert.False(t, d.Allowed)
+	assert.Equal(t, DefaultStoreGlobalKey, d.Key)
+	assert.Greater(t, d.RetryAfter.Seconds(), 0.0)
+}
+
+func TestIpRateLimiter_Decision(t *testing.T) {
+	callback := &testDecisionCallback{}
+	conf := NewConfig().WithBurst(1).WithCallback(callback).WithIpWhitelist([]string{"10.0.0.1"})
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	decisions := []*Decision{}
+	router := testDecisionRouter(limiter.HandlerFunc(), &decisions)
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, com.TestEndpoint2))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, com.TestEndpoint2))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.0.1:8080"))
+
+	// The key of the decision is the client IP address
+	assert.Len(t, callback.limited, 1)
+	assert.Equal(t, com.TestIpAddress2, callback.limited[0].Key)
+	assert.Equal(t, com.TestIpAddress2, callback.allowed[0].Key)
+	assert.Empty(t, callback.allowed[0].Rule)
+
+	// Whitelisted requests are allowed and marked as whitelisted
+	assert.Len(t, callback.allowed, 2)
+	assert.True(t, callback.allowed[1].Whitelisted)
+	assert.True(t, decisions[1].Whitelisted)
+}
+
+func TestIpRateLimiter_DecisionSkipped(t *testing.T) {
+	callback := &testDecisionCallback{}
+	conf := NewConfig().WithCallback(callback).WithKeyFunc(KeyByHeader("X-Api-Key")).WithMissingKey(MissingKeySkip)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	decisions := []*Decision{}
+	router := testDecisionRouter(limiter.HandlerFunc(), &decisions)
+
+	// Requests without a key are not limited and marked as skipped
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, com.TestEndpoint2))
+	assert.Len(t, callback.allowed, 1)
+	assert.True(t, callback.allowed[0].Skipped)
+	assert.True(t, callback.allowed[0].MissingKey)
+	assert.True(t, decisions[0].Skipped)
+}
+
+func TestIpRateLimiter_DecisionMissingKey(t *testing.T) {
+	t.Run("client ip", func(t *testing.T) {
+		conf := NewConfig().WithBurst(1).WithKeyFunc(KeyByHeader("X-Api-Key"))
+		limiter := NewIpRateLimiter(conf)
+		defer limiter.Stop()
+		decisions := []*Decision{}
+		router := testDecisionRouter(limiter.HandlerFunc(), &decisions)
+
+		// Requests without a key are limited by the client IP address by default
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, com.TestEndpoint2))
+		assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, com.TestEndpoint2))
+		assert.Equal(t, com.TestIpAddress2, decisions[0].Key)
+		assert.False(t, decisions[0].Skipped)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		callback := &testDecisionCallback{}
+		conf := NewConfig().WithCallback(callback).WithKeyFunc(KeyByHeader("X-Api-Key")).WithMissingKey(MissingKeyReject)
+		limiter := NewIpRateLimiter(conf)
+		defer limiter.Stop()
+		decisions := []*Decision{}
+		router := testDecisionRouter(limiter.HandlerFunc(), &decisions)
+
+		// Requests without a key are rejected
+		assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, com.TestEndpoint2))
+		assert.Len(t, callback.limited, 1)
+		assert.True(t, callback.limited[0].MissingKey)
+		assert.Empty(t, callback.limited[0].Key)
+	})
+}
+
+func TestRuleRateLimiter_Decision(t *testing.T) {
+	callback := &testDecisionCallback{}
+	rules := NewRuleSet(NewRule("users", http.MethodGet, "/users/:id").WithBurst(1))
+	limiter := NewRuleRateLimiter(NewConfig().WithCallback(callback), rules)
+	defer limiter.Stop()
+	decisions := []*Decision{}
+	router := testDecisionRouter(limiter.HandlerFunc(), &decisions)
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, "/users/1", com.TestEndpoint2))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, "/users/1", com.TestEndpoint2))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, "/health", com.TestEndpoint2))
+
+	// The decision carries the name of the matching rule
+	assert.Equal(t, "users", callback.allowed[0].Rule)
+	assert.Equal(t, "users", callback.limited[0].Rule)
+
+	// Requests matching no rule are marked as skipped
+	assert.Len(t, callback.allowed, 2)
+	assert.True(t, callback.allowed[1].Skipped)
+	assert.Empty(t, callback.allowed[1].Rule)
+	assert.Len(t, decisions, 2)
+}
+
+func TestGetDecision(t *testing.T) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	_, ok := GetDecision(ctx)
+	assert.False(t, ok)
+
+	ctx.Set(DecisionContextKey, "invalid")
+	_, ok = GetDecision(ctx)
+	assert.False(t, ok)
+
+	d := &Decision{Allowed: true}
+	ctx.Set(DecisionContextKey, d)
+	got, ok := GetDecision(ctx)
+	assert.True(t, ok)
+	assert.Same(t, d, got)
+}
+
+func TestRateLimiter_Shadow(t *testing.T) {
+	callback := &testDecisionCallback{}
+	conf := NewConfig().WithRate(0.001).WithBurst(1).WithCallback(callback).WithShadow(true).WithMaxWait(time.Second)
+	decisions := []*Decision{}
+	router := testDecisionRouter(NewRateLimiter(conf).HandlerFunc(), &decisions)
+
+	// The request over the limit is let through without waiting, but reported as limited
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.9.0.1:80"))
+	start := time.Now()
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.9.0.1:80"))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Len(t, callback.allowed, 1)
+	assert.Len(t, callback.limited, 1)
+	assert.False(t, callback.limited[0].Allowed)
+	assert.True(t, callback.limited[0].Shadow)
+	assert.False(t, callback.allowed[0].Shadow)
+	assert.Len(t, decisions, 2)
+	assert.True(t, decisions[1].Shadow)
+}
+
+func TestIpRateLimiter_Shadow(t *testing.T) {
+	callback := &testBanCallback{}
+	conf := NewConfig().WithRate(0.001).WithBurst(1).WithCallback(callback).WithShadow(true).WithBanThreshold(1)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// The response headers report the limit as if it were enforced
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.9.1.1:80"))
+	req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+	req.RemoteAddr = "10.9.1.1:80"
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "0", resp.Header().Get(HeaderRateLimitRemaining))
+	assert.NotEmpty(t, resp.Header().Get(HeaderRetryAfter))
+
+	// Bans are recorded and reported, but banned requests are let through too
+	assert.Len(t, callback.bans, 1)
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.9.1.1:80"))
+	d := callback.limited[len(callback.limited)-1]
+	assert.True(t, d.Banned)
+	assert.True(t, d.Shadow)
+}
+
+func TestRuleRateLimiter_Shadow(t *testing.T) {
+	callback := &testDecisionCallback{}
+	rules := NewRuleSet(
+		NewRule("login", http.MethodGet, "/login").WithBurst(1),
+		NewRule("users", http.MethodGet, "/users/:id").WithBurst(1).WithShadow(true),
+	)
+	limiter := NewRuleRateLimiter(NewConfig().WithRate(0.001).WithCallback(callback), rules)
+	defer limiter.Stop()
+	decisions := []*Decision{}
+	router := testDecisionRouter(limiter.HandlerFunc(), &decisions)
+
+	// One rule enforces while the other only shadows
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, "/login", "10.9.2.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, "/login", "10.9.2.1:80"))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, "/users/1", "10.9.2.1:80"))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, "/users/1", "10.9.2.1:80"))
+	assert.Len(t, callback.limited, 2)
+	assert.False(t, callback.limited[0].Shadow)
+	assert.True(t, callback.limited[1].Shadow)
+	assert.Equal(t, "users", callback.limited[1].Rule)
+
+	// A rule can also enforce when the configuration shadows
+	rules = NewRuleSet(NewRule("login", http.MethodGet, "/login").WithBurst(1).WithShadow(false))
+	limiter = NewRuleRateLimiter(NewConfig().WithRate(0.001).WithShadow(true), rules)
+	defer limiter.Stop()
+	router = testDecisionRouter(limiter.HandlerFunc(), &decisions)
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, "/login", "10.9.2.2:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, "/login", "10.9.2.2:80"))
+}
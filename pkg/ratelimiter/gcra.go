@@ -0,0 +1,286 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// gcraParams 是 GCRA 算法的不可变参数
+// gcraParams is the immutable parameters of the GCRA algorithm
+type gcraParams struct {
+	// limit 是每秒限制速率
+	// limit is the limit rate per second
+	limit rate.Limit
+
+	// burst 是限制突发
+	// burst is the limit burst
+	burst int
+
+	// interval 是两个请求之间的发射间隔，单位为纳秒
+	// interval is the emission interval between two requests, in nanoseconds
+	interval int64
+
+	// tolerance 是允许的突发容忍度，单位为纳秒
+	// tolerance is the burst tolerance, in nanoseconds
+	tolerance int64
+}
+
+// newGCRAParams 是一个函数，根据速率和突发计算 GCRA 算法的参数
+// newGCRAParams is a function that calculates the parameters of the GCRA algorithm based on the rate and burst
+func newGCRAParams(r rate.Limit, b int) *gcraParams {
+	p := &gcraParams{limit: r, burst: b}
+
+	// 速率为无限时发射间隔为 0，总是允许；速率小于等于 0 时不计算间隔，总是拒绝
+	// The emission interval is 0 when the rate is infinite, which always allows; the interval is not calculated when the rate is less than or equal to 0, which always denies
+	if r != rate.Inf && r > 0 {
+		interval := float64(time.Second) / float64(r)
+		if interval*float64(b) >= math.MaxInt64 {
+			interval = math.MaxInt64 / float64(b+1)
+		}
+		p.interval = int64(interval)
+		p.tolerance = p.interval * int64(b)
+	}
+
+	return p
+}
+
+// GCRA 是通用信元速率算法的共享参数，多个 GCRAState 可以共享同一组参数
+// GCRA holds the shared parameters of the generic cell rate algorithm, multiple GCRAState can share the same parameters
+type GCRA struct {
+	// params 是一个原子指针，指向当前的算法参数
+	// params is an atomic pointer to the current algorithm parameters
+	params atomic.Pointer[gcraParams]
+}
+
+// NewGCRA 是一个函数，根据速率和突发返回一个新的 GCRA
+// NewGCRA is a function that returns a new GCRA based on the rate and burst
+func NewGCRA(r rate.Limit, b int) *GCRA {
+	g := &GCRA{}
+	g.params.Store(newGCRAParams(r, b))
+	return g
+}
+
+// Limit 方法返回每秒限制速率
+// The Limit method returns the limit rate per second
+func (g *GCRA) Limit() rate.Limit {
+	return g.params.Load().limit
+}
+
+// Burst 方法返回限制突发
+// The Burst method returns the limit burst
+func (g *GCRA) Burst() int {
+	return g.params.Load().burst
+}
+
+// SetLimit 方法设置每秒限制速率
+// The SetLimit method sets the limit rate per second
+func (g *GCRA) SetLimit(newLimit rate.Limit) {
+	for {
+		old := g.params.Load()
+		if g.params.CompareAndSwap(old, newGCRAParams(newLimit, old.burst)) {
+			return
+		}
+	}
+}
+
+// SetBurst 方法设置限制突发
+// The SetBurst method sets the limit burst
+func (g *GCRA) SetBurst(newBurst int) {
+	for {
+		old := g.params.Load()
+		if g.params.CompareAndSwap(old, newGCRAParams(old.limit, newBurst)) {
+			return
+		}
+	}
+}
+
+// AllowN 方法判断在时间 t 是否允许 n 个请求，如果允许则无锁地推进状态的理论到达时间
+// The AllowN method reports whether n requests may happen at time t, and advances the theoretical arrival time of the state lock-free if allowed
+func (g *GCRA) AllowN(state *GCRAState, t time.Time, n int) bool {
+	p := g.params.Load()
+
+	// 如果速率为无限，则总是允许；如果速率小于等于 0，则总是拒绝
+	// If the rate is infinite, always allow; if the rate is less than or equal to 0, always deny
+	if p.limit == rate.Inf {
+		return true
+	}
+	if p.interval == 0 || n > p.burst {
+		return false
+	}
+
+	now := t.UnixNano()
+	for {
+		// 理论到达时间不能早于当前时间
+		// The theoretical arrival time cannot be earlier than the current time
+		tat := state.tat.Load()
+		base := tat
+		if base < now {
+			base = now
+		}
+
+		// 如果新的理论到达时间超出了突发容忍度，则不允许
+		// If the new theoretical arrival time exceeds the burst tolerance, do not allow
+		newTat := base + int64(n)*p.interval
+		if newTat-p.tolerance > now {
+			return false
+		}
+
+		if state.tat.CompareAndSwap(tat, newTat) {
+			return true
+		}
+	}
+}
+
+// ReserveN 方法在时间 t 为状态预留 n 个令牌，返回令牌可用之前需要等待的时间和取消预留的函数。
+// 如果需要等待的时间超过 maxWait，则不预留并返回 false
+// The ReserveN method reserves n tokens for the state at time t, and returns the time to wait before the tokens are available and a function to cancel the reservation.
+// If the time to wait exceeds maxWait, nothing is reserved and false is returned
+func (g *GCRA) ReserveN(state *GCRAState, t time.Time, n int, maxWait time.Duration) (time.Duration, func(), bool) {
+	p := g.params.Load()
+
+	// 如果速率为无限，则不需要等待；如果速率小于等于 0，则永远无法预留
+	// If the rate is infinite, there is no need to wait; if the rate is less than or equal to 0, it can never be reserved
+	if p.limit == rate.Inf {
+		return 0, func() {}, true
+	}
+	if p.interval == 0 || n > p.burst {
+		return 0, nil, false
+	}
+
+	now := t.UnixNano()
+	for {
+		tat := state.tat.Load()
+		base := tat
+		if base < now {
+			base = now
+		}
+
+		// 与 AllowN 不同，新的理论到达时间可以超出突发容忍度，超出的部分就是需要等待的时间
+		// Unlike AllowN, the new theoretical arrival time may exceed the burst tolerance, the excess is the time to wait
+		newTat := base + int64(n)*p.interval
+		delay := time.Duration(newTat - p.tolerance - now)
+		if delay < 0 {
+			delay = 0
+		}
+		if delay > maxWait {
+			return 0, nil, false
+		}
+
+		if state.tat.CompareAndSwap(tat, newTat) {
+			// 取消时归还预留的令牌，即将理论到达时间回退相应的间隔
+			// Return the reserved tokens when canceled, that is, move the theoretical arrival time back by the corresponding interval
+			return delay, func() { state.tat.Add(-int64(n) * p.interval) }, true
+		}
+	}
+}
+
+// TokensAt 方法返回状态在时间 t 可用的令牌数量
+// The TokensAt method returns the number of tokens available for the state at time t
+func (g *GCRA) TokensAt(state *GCRAState, t time.Time) float64 {
+	p := g.params.Load()
+
+	if p.limit == rate.Inf {
+		return float64(p.burst)
+	}
+	if p.interval == 0 {
+		return 0
+	}
+
+	// 理论到达时间领先当前时间越多，可用的令牌越少
+	// The more the theoretical arrival time is ahead of the current time, the fewer tokens are available
+	ahead := state.tat.Load() - t.UnixNano()
+	if ahead <= 0 {
+		return float64(p.burst)
+	}
+
+	return float64(p.burst) - float64(ahead)/float64(p.interval)
+}
+
+// GCRAState 是 GCRA 算法中每个键的状态，只有一个原子的理论到达时间
+// GCRAState is the per-key state of the GCRA algorithm, it is only an atomic theoretical arrival time
+type GCRAState struct {
+	// tat 是理论到达时间，单位为 Unix 纳秒
+	// tat is the theoretical arrival time, in Unix nanoseconds
+	tat atomic.Int64
+}
+
+// GetUpdateAt 方法返回理论到达时间的 Unix 毫秒数，缓存在这之后经过过期时间即可安全地删除该状态
+// The GetUpdateAt method returns the theoretical arrival time in Unix milliseconds, the cache can safely delete the state once the expiration time has passed after it
+func (s *GCRAState) GetUpdateAt() int64 {
+	return s.tat.Load() / int64(time.Millisecond)
+}
+
+// GCRALimiter 是基于 GCRA 算法的限流器，它由共享的参数和独立的状态组成。状态直接保存在限流器中，所以每个限流器只需要一次内存分配
+// GCRALimiter is a rate limiter based on the GCRA algorithm, it consists of shared parameters and its own state. The state is stored in the limiter directly, so each limiter needs only one allocation
+type GCRALimiter struct {
+	// gcra 是算法参数
+	// gcra is the algorithm parameters
+	gcra *GCRA
+
+	// state 是限流器的状态
+	// state is the state of the limiter
+	state GCRAState
+}
+
+// NewGCRALimiter 是一个函数，返回一个新的 GCRA 限流器
+// NewGCRALimiter is a function that returns a new GCRA rate limiter
+func NewGCRALimiter(r rate.Limit, b int) *GCRALimiter {
+	return &GCRALimiter{gcra: NewGCRA(r, b)}
+}
+
+// Limit 方法返回每秒限制速率
+// The Limit method returns the limit rate per second
+func (l *GCRALimiter) Limit() rate.Limit {
+	return l.gcra.Limit()
+}
+
+// Burst 方法返回限制突发
+// The Burst method returns the limit burst
+func (l *GCRALimiter) Burst() int {
+	return l.gcra.Burst()
+}
+
+// SetLimit 方法设置每秒限制速率，共享参数的所有限流器都会生效
+// The SetLimit method sets the limit rate per second, which takes effect for all limiters sharing the parameters
+func (l *GCRALimiter) SetLimit(newLimit rate.Limit) {
+	l.gcra.SetLimit(newLimit)
+}
+
+// SetBurst 方法设置限制突发，共享参数的所有限流器都会生效
+// The SetBurst method sets the limit burst, which takes effect for all limiters sharing the parameters
+func (l *GCRALimiter) SetBurst(newBurst int) {
+	l.gcra.SetBurst(newBurst)
+}
+
+// GetUpdateAt 方法返回状态的理论到达时间的 Unix 毫秒数，缓存在这之后经过过期时间才会删除该限流器
+// The GetUpdateAt method returns the theoretical arrival time of the state in Unix milliseconds, the cache deletes the limiter only once the expiration time has passed after it
+func (l *GCRALimiter) GetUpdateAt() int64 {
+	return l.state.GetUpdateAt()
+}
+
+// Allow 方法是 AllowN(time.Now(), 1) 的简写
+// The Allow method is shorthand for AllowN(time.Now(), 1)
+func (l *GCRALimiter) Allow() bool {
+	return l.AllowN(time.Now(), 1)
+}
+
+// AllowN 方法判断在时间 t 是否允许 n 个请求
+// The AllowN method reports whether n requests may happen at time t
+func (l *GCRALimiter) AllowN(t time.Time, n int) bool {
+	return l.gcra.AllowN(&l.state, t, n)
+}
+
+// TokensAt 方法返回在时间 t 可用的令牌数量
+// The TokensAt method returns the number of tokens available at time t
+func (l *GCRALimiter) TokensAt(t time.Time) float64 {
+	return l.gcra.TokensAt(&l.state, t)
+}
+
+// ReserveN 方法在时间 t 预留 n 个令牌，实现了 Reserver 接口
+// The ReserveN method reserves n tokens at time t, it implements the Reserver interface
+func (l *GCRALimiter) ReserveN(t time.Time, n int, maxWait time.Duration) (time.Duration, func(), bool) {
+	return l.gcra.ReserveN(&l.state, t, n, maxWait)
+}
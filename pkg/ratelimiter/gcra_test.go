@@ -0,0 +1,179 @@
+package ratelimiter
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestGCRALimiter_AllowN(t *testing.T) {
+	// 2 requests per second with a burst of 5
+	limiter := NewGCRALimiter(rate.Limit(2), 5)
+
+	// The full burst is available at once
+	assert.Equal(t, float64(5), limiter.TokensAt(testWindowStart))
+	assert.True(t, limiter.AllowN(testWindowStart, 5))
+	assert.False(t, limiter.AllowN(testWindowStart, 1))
+	assert.Equal(t, float64(0), limiter.TokensAt(testWindowStart))
+
+	// One token is emitted every 500ms
+	assert.False(t, limiter.AllowN(testWindowStart.Add(499*time.Millisecond), 1))
+	assert.True(t, limiter.AllowN(testWindowStart.Add(500*time.Millisecond), 1))
+	assert.False(t, limiter.AllowN(testWindowStart.Add(500*time.Millisecond), 1))
+
+	// The bucket is full again after the whole burst has been emitted
+	assert.Equal(t, float64(5), limiter.TokensAt(testWindowStart.Add(3*time.Second)))
+
+	// Requests larger than the burst are never allowed
+	assert.False(t, limiter.AllowN(testWindowStart.Add(time.Hour), 6))
+}
+
+func TestGCRALimiter_SetLimitAndBurst(t *testing.T) {
+	limiter := NewGCRALimiter(rate.Limit(1), 1)
+
+	limiter.SetLimit(rate.Limit(10))
+	limiter.SetBurst(20)
+
+	assert.Equal(t, rate.Limit(10), limiter.Limit())
+	assert.Equal(t, 20, limiter.Burst())
+	assert.True(t, limiter.AllowN(testWindowStart, 20))
+	assert.False(t, limiter.AllowN(testWindowStart, 1))
+
+	// Infinite rate always allows
+	limiter.SetLimit(rate.Inf)
+	assert.True(t, limiter.AllowN(testWindowStart, 20))
+}
+
+func TestGCRALimiter_Concurrent(t *testing.T) {
+	// A very low rate so that no token is emitted during the test
+	limiter := NewGCRALimiter(rate.Limit(0.001), 100)
+
+	var allowed atomic.Int64
+	wg := sync.WaitGroup{}
+
+	// Hammer the limiter from many goroutines
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if limiter.Allow() {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Exactly the burst is allowed
+	assert.Equal(t, int64(100), allowed.Load())
+}
+
+func TestIpRateLimiter_GCRA(t *testing.T) {
+	// Create a new rate limiter with the GCRA algorithm
+	conf := NewConfig().WithRate(2).WithBurst(5).WithAlgorithm(AlgorithmGCRA)
+	rl := NewIpRateLimiter(conf)
+	defer rl.Stop()
+
+	// The limiter of each key in the cache only has its own state and shares the parameters
+	value, handle := rl.acquire(com.TestIpAddress, nil)
+	assert.True(t, value.Allow())
+	handle.Release()
+	value, ok := rl.cache.Get(com.TestIpAddress)
+	assert.True(t, ok)
+	assert.IsType(t, &GCRALimiter{}, value)
+	assert.Same(t, rl.gcra, value.(*GCRALimiter).gcra)
+
+	// Creating the limiter of a key allocates once
+	assert.Equal(t, float64(1), testing.AllocsPerRun(100, func() { rl.newLimiter(com.TestIpAddress2, nil) }))
+
+	// The limiter of the key shares the parameters of the rate limiter
+	limiter := rl.GetLimiter(com.TestIpAddress)
+	assert.NotNil(t, limiter)
+	assert.InDelta(t, float64(4), limiter.TokensAt(time.Now()), 0.1)
+
+	// Set rate and burst for all keys
+	rl.SetRate(10)
+	rl.SetBurst(20)
+	assert.Equal(t, rate.Limit(10), limiter.Limit())
+	assert.Equal(t, 20, limiter.Burst())
+}
+
+func benchmarkIpRateLimiterKeys(b *testing.B, algorithm Algorithm) {
+	rl := NewIpRateLimiter(NewConfig().WithRate(10).WithBurst(10).WithAlgorithm(algorithm))
+	defer rl.Stop()
+
+	keys := make([]string, b.N)
+	for i := 0; i < b.N; i++ {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	// Every iteration tracks a new client
+	for i := 0; i < b.N; i++ {
+		limiter, handle := rl.acquire(keys[i], nil)
+		limiter.Allow()
+		handle.Release()
+	}
+}
+
+func BenchmarkIpRateLimiter_NewKeyTokenBucket(b *testing.B) {
+	benchmarkIpRateLimiterKeys(b, AlgorithmTokenBucket)
+}
+
+func BenchmarkIpRateLimiter_NewKeyGCRA(b *testing.B) {
+	benchmarkIpRateLimiterKeys(b, AlgorithmGCRA)
+}
+
+func BenchmarkIpRateLimiter_NewLimiterGCRA(b *testing.B) {
+	rl := NewIpRateLimiter(NewConfig().WithRate(10).WithBurst(10).WithAlgorithm(AlgorithmGCRA))
+	defer rl.Stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	// Every iteration creates the limiter of a key, without the cache
+	for i := 0; i < b.N; i++ {
+		rl.newLimiter(com.TestIpAddress, nil)
+	}
+}
+
+func benchmarkIpRateLimiterHit(b *testing.B, algorithm Algorithm) {
+	rl := NewIpRateLimiter(NewConfig().WithRate(10).WithBurst(10).WithAlgorithm(algorithm))
+	defer rl.Stop()
+
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	// Every iteration looks up a client that is already tracked
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			limiter, handle := rl.acquire(keys[i&1023], nil)
+			limiter.Allow()
+			handle.Release()
+			i++
+		}
+	})
+}
+
+func BenchmarkIpRateLimiter_HitTokenBucket(b *testing.B) {
+	benchmarkIpRateLimiterHit(b, AlgorithmTokenBucket)
+}
+
+func BenchmarkIpRateLimiter_HitGCRA(b *testing.B) {
+	benchmarkIpRateLimiterHit(b, AlgorithmGCRA)
+}
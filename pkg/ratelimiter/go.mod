@@ -5,6 +5,7 @@ go 1.19
 replace github.com/shengyanli1982/orbit-contrib => ../../
 
 require (
+	github.com/alicebob/miniredis/v2 v2.31.0
 	github.com/cespare/xxhash/v2 v2.2.0
 	github.com/gin-gonic/gin v1.8.2
 	github.com/shengyanli1982/orbit-contrib v0.0.0
@@ -13,6 +14,7 @@ require (
 )
 
 require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gabriel-vasile/mimetype v1.4.2 // indirect
 	github.com/gin-contrib/sse v0.1.0 // indirect
@@ -30,6 +32,7 @@ require (
 	github.com/pelletier/go-toml/v2 v2.0.8 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/ugorji/go/codec v1.2.11 // indirect
+	github.com/yuin/gopher-lua v1.1.0 // indirect
 	golang.org/x/crypto v0.9.0 // indirect
 	golang.org/x/net v0.10.0 // indirect
 	golang.org/x/sys v0.8.0 // indirect
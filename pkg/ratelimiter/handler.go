@@ -1,23 +1,28 @@
 package ratelimiter
 
 import (
-	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
 	gr "golang.org/x/time/rate"
 )
 
 // RateLimiter 是一个结构体，包含配置和限流器
 // RateLimiter is a struct that contains configuration and rate limiter
 type RateLimiter struct {
-	// config 是一个指向 Config 结构体的指针，用于存储配置信息
-	// config is a pointer to the Config struct, used to store configuration information
-	config *Config
+	// config 是可以在运行时修改的配置
+	// config is the configuration that can be changed at runtime
+	config *liveConfig
 
-	// limiter 是一个指向 rate.Limiter 结构体的指针，用于存储限流器
-	// limiter is a pointer to the rate.Limiter struct, used to store rate limiter
-	limiter *rate.Limiter
+	// limiter 是一个限流器，具体的算法由配置决定，重置时被原子地替换
+	// limiter is a rate limiter, the specific algorithm is determined by the configuration, it is replaced atomically when reset
+	limiter atomic.Pointer[Limiter]
+
+	// queue 是等待模式下的等待队列
+	// queue is the wait queue in wait mode
+	queue *waitQueue
 }
 
 // NewRateLimiter 是一个函数，接收一个 Config 结构体的指针作为参数，返回一个新的 RateLimiter 结构体的指针
@@ -27,49 +32,102 @@ func NewRateLimiter(config *Config) *RateLimiter {
 	// Validate and get valid configuration
 	config = isConfigValid(config)
 
-	// 返回一个新的 RateLimiter 结构体的指针，其中包含配置和新的限流器
-	// Return a new pointer to the RateLimiter struct, which includes configuration and a new rate limiter
-	return &RateLimiter{
+	// 创建一个新的 RateLimiter 结构体的指针，其中包含配置和等待模式下的等待队列
+	// Create a new pointer to the RateLimiter struct, which includes configuration and the wait queue in wait mode
+	rl := &RateLimiter{
 		// 设置配置
 		// Set configuration
-		config: config,
+		config: newLiveConfig(config),
 
-		// 创建并设置新的限流器，其中速率和突发来自配置
-		// Create and set a new rate limiter, where the rate and burst come from the configuration
-		limiter: rate.NewLimiter(rate.Limit(config.rate), config.burst),
+		// 创建等待模式下的等待队列
+		// Create the wait queue in wait mode
+		queue: newWaitQueue(),
 	}
+
+	// 创建并设置新的限流器
+	// Create and set a new rate limiter
+	rl.reset(config)
+
+	// 返回新创建的 RateLimiter 结构体的指针
+	// Return the newly created pointer to the RateLimiter struct
+	return rl
+}
+
+// reset 方法使用配置创建一个新的限流器，替换当前的限流器，其中算法、速率和突发来自配置，如果配置了层级，则由所有层级组成
+// The reset method creates a new rate limiter with the configuration and replaces the current one, where the algorithm, rate and burst come from the configuration, it is composed of all tiers if tiers are configured
+func (rl *RateLimiter) reset(config *Config) {
+	limiter := newConfigLimiter(config, config.limits(), append(append([]Tier{}, config.tiers...), config.globalTiers...), nil)
+	rl.limiter.Store(&limiter)
 }
 
 // GetLimiter 方法用于获取限流器
 // The GetLimiter method is used to get the rate limiter
-func (rl *RateLimiter) GetLimiter() *rate.Limiter {
+func (rl *RateLimiter) GetLimiter() Limiter {
 	// 返回限流器
 	// Return the rate limiter
-	return rl.limiter
+	return *rl.limiter.Load()
 }
 
 // SetRate 方法用于设置限流器的速率
 // The SetRate method is used to set the rate of the rate limiter
 func (rl *RateLimiter) SetRate(rate float64) {
-	// 设置配置的速率
-	// Set the rate of the configuration
-	rl.config.rate = rate
-
-	// 设置限流器的速率
-	// Set the rate of the rate limiter
-	rl.limiter.SetLimit(gr.Limit(rl.config.rate))
+	rl.config.Update(func(config *Config) {
+		// 设置配置的速率
+		// Set the rate of the configuration
+		config.rate = rate
+	}, func(config *Config) {
+		// 设置限流器的速率
+		// Set the rate of the rate limiter
+		rl.GetLimiter().SetLimit(gr.Limit(config.rate))
+	})
 }
 
 // SetBurst 方法用于设置限流器的突发流量
 // The SetBurst method is used to set the burst traffic of the rate limiter
 func (rl *RateLimiter) SetBurst(burst int) {
-	// 设置配置的突发流量
-	// Set the burst traffic of the configuration
-	rl.config.burst = burst
+	rl.config.Update(func(config *Config) {
+		// 设置配置的突发流量
+		// Set the burst traffic of the configuration
+		config.burst = burst
+	}, func(config *Config) {
+		// 设置限流器的突发流量
+		// Set the burst traffic of the rate limiter
+		rl.GetLimiter().SetBurst(config.burst)
+	})
+}
+
+// AddIp 方法向 IP 白名单添加 IP 地址和 CIDR 网段，无法解析的项被忽略，之后的请求立即生效
+// The AddIp method adds IP addresses and CIDR networks to the IP whitelist, items that cannot be parsed are ignored, and it takes effect immediately for later requests
+func (rl *RateLimiter) AddIp(ips ...string) {
+	rl.config.Load().ipWhitelist.Add(ips...)
+}
 
-	// 设置限流器的突发流量
-	// Set the burst traffic of the rate limiter
-	rl.limiter.SetBurst(rl.config.burst)
+// RemoveIp 方法从 IP 白名单删除之前添加的 IP 地址和 CIDR 网段
+// The RemoveIp method removes IP addresses and CIDR networks added before from the IP whitelist
+func (rl *RateLimiter) RemoveIp(ips ...string) {
+	rl.config.Load().ipWhitelist.Remove(ips...)
+}
+
+// ReplaceIpList 方法使用指定的 IP 地址和 CIDR 网段替换 IP 白名单
+// The ReplaceIpList method replaces the IP whitelist with the specified IP addresses and CIDR networks
+func (rl *RateLimiter) ReplaceIpList(ips []string) {
+	rl.config.Load().ipWhitelist.Replace(ips)
+}
+
+// SetIpWhitelist 方法用于替换 IP 白名单，与 ReplaceIpList 相同
+// The SetIpWhitelist method is used to replace the IP whitelist, it is the same as ReplaceIpList
+func (rl *RateLimiter) SetIpWhitelist(whitelist []string) {
+	rl.ReplaceIpList(whitelist)
+}
+
+// SetMatchFunc 方法用于替换匹配函数，为 nil 时使用默认的匹配函数
+// The SetMatchFunc method is used to replace the match function, the default match function is used when it is nil
+func (rl *RateLimiter) SetMatchFunc(fn com.HttpRequestHeaderMatchFunc) {
+	rl.config.Update(func(config *Config) {
+		// 设置配置的匹配函数
+		// Set the match function of the configuration
+		config.matchFunc = fn
+	}, nil)
 }
 
 // Stop 方法用于停止限流器，但在这里没有实现任何功能
@@ -83,39 +141,55 @@ func (rl *RateLimiter) HandlerFunc() gin.HandlerFunc {
 	// 返回一个闭包函数，该函数接收一个 gin.Context 参数，用于处理 HTTP 请求
 	// Returns a closure function that takes a gin.Context parameter to handle HTTP requests
 	return func(ctx *gin.Context) {
+		// 加载当前的配置，整个请求使用同一份配置
+		// Load the current configuration, the whole request uses the same configuration
+		config := rl.config.Load()
 
-		// 如果请求匹配配置的匹配函数，则进行下一步处理
-		// If the request matches the match function in the configuration, then proceed to the next step
-		if rl.config.matchFunc(ctx.Request) {
-
-			// 获取客户端 IP 地址
-			// Get the client IP address
-			clientIP := ctx.ClientIP()
+		// 做出限流决策，并根据决策放行或者拒绝请求
+		// Make the rate limiting decision, and allow or reject the request according to it
+		applyDecision(ctx, config, rl.decide(ctx, config))
+	}
+}
 
-			// 如果客户端 IP 地址不在配置的 IP 白名单中，并且限流器不允许新的请求，则进行下一步处理
-			// If the client IP address is not in the IP whitelist in the configuration, and the rate limiter does not allow new requests, then proceed to the next step
-			if _, ok := rl.config.ipWhitelist[clientIP]; !ok && !rl.limiter.Allow() {
+// decide 方法为请求做出限流决策
+// The decide method makes the rate limiting decision for the request
+func (rl *RateLimiter) decide(ctx *gin.Context, config *Config) *Decision {
+	// 如果请求不匹配配置的匹配函数，则不进行限流
+	// If the request does not match the match function in the configuration, do not limit
+	if !config.matchFunc(ctx.Request) {
+		return &Decision{Allowed: true, Skipped: true, Key: DefaultStoreGlobalKey, Rule: config.rule}
+	}
 
-				// 中止请求处理
-				// Abort the request processing
-				ctx.Abort()
+	// 如果客户端 IP 地址在配置的 IP 白名单中，则不进行限流
+	// If the client IP address is in the IP whitelist in the configuration, do not limit
+	if config.ipWhitelist.ContainsString(config.clientIP(ctx)) {
+		return &Decision{Allowed: true, Whitelisted: true, Key: DefaultStoreGlobalKey, Rule: config.rule}
+	}
 
-				// 返回 429 错误，表示请求过多
-				// Return a 429 error, indicating too many requests
-				ctx.String(http.StatusTooManyRequests, "[429] too many http requests, method: "+ctx.Request.Method+", path: "+ctx.Request.URL.Path)
+	// 判断限流器是否允许新的请求，并根据限流器的状态生成决策，如果配置了存储，则由存储做出决策
+	// Check whether the rate limiter allows new requests, and generate a decision based on the state of the rate limiter, if a store is configured, the store makes the decision
+	now := time.Now()
+	cost := costOf(config, ctx.Request)
+	limiter := rl.GetLimiter()
+	var decision *Decision
+	if config.store != nil {
+		decision = takeFromStore(ctx, config, DefaultStoreGlobalKey, config.limits(), cost)
+	} else {
+		allowed := limiter.AllowN(now, cost)
+		decision = newDecision(limiter, now, cost, allowed)
+	}
 
-				// 调用配置的回调函数，处理限流事件
-				// Call the callback function in the configuration to handle the rate limiting event
-				rl.config.callback.OnLimited(ctx.Request)
+	// 如果请求被拒绝并且开启了等待模式，则排队等待令牌，存储返回错误时不等待
+	// If the request is rejected and wait mode is enabled, queue up and wait for a token, do not wait when the store returns an error
+	if !decision.Allowed && decision.StoreError == nil && config.maxWait > 0 && !config.shadow {
+		decision = waitDecision(ctx, config, rl.queue, DefaultStoreGlobalKey, config.limits(), limiter, now, cost, decision)
+		now = time.Now()
+	}
+	decision.Key, decision.Rule = DefaultStoreGlobalKey, config.rule
 
-				// 返回，不再执行后续代码
-				// Return, no further code is executed
-				return
-			}
-		}
+	// 将决策写入限流响应头
+	// Write the decision to the rate limiting response headers
+	writeHeaders(ctx, config.headerStyle, decision, now)
 
-		// 执行后续的请求处理
-		// Execute subsequent request processing
-		ctx.Next()
-	}
+	return decision
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	com "github.com/shengyanli1982/orbit-contrib/internal/common"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
 )
 
 type testCallback struct {
@@ -165,3 +166,39 @@ func TestLimiter_IpWhitelistWithOther(t *testing.T) {
 		testWhitelistRequestFunc(t, i, router, com.TestEndpoint3, com.TestUrlPath)
 	}
 }
+
+func TestLimiter_AddRemoveIp(t *testing.T) {
+	limiter := NewRateLimiter(NewConfig().WithRate(1).WithBurst(1))
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.5.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.32.5.1:80"))
+
+	// Added addresses bypass the shared bucket until they are removed
+	limiter.AddIp("10.32.5.1")
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.5.1:80"))
+	limiter.RemoveIp("10.32.5.1")
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.32.5.1:80"))
+}
+
+func TestLimiter_Reconfigure(t *testing.T) {
+	limiter := NewRateLimiter(NewConfig().WithRate(1).WithBurst(1))
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.3.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.0.3.1:80"))
+
+	// The whitelisted address and requests not matching the match function are not limited
+	limiter.SetIpWhitelist([]string{"10.0.3.1"})
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.3.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.0.3.2:80"))
+	limiter.SetMatchFunc(func(r *http.Request) bool { return false })
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.3.2:80"))
+
+	// The rate and burst of the configuration and the limiter change together
+	limiter.SetRate(5)
+	limiter.SetBurst(3)
+	assert.Equal(t, rate.Limit(5), limiter.GetLimiter().Limit())
+	assert.Equal(t, 3, limiter.GetLimiter().Burst())
+	assert.Equal(t, 3, limiter.config.Load().burst)
+}
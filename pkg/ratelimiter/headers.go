@@ -0,0 +1,85 @@
+package ratelimiter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderStyle 是限流响应头的样式
+// HeaderStyle is the style of the rate limiting response headers
+type HeaderStyle int8
+
+const (
+	// HeaderStyleNone 表示不输出限流响应头
+	// HeaderStyleNone means no rate limiting response headers are written
+	HeaderStyleNone HeaderStyle = iota
+
+	// HeaderStyleDraft 表示输出 IETF 草案格式的 RateLimit-Limit、RateLimit-Remaining 和 RateLimit-Reset 响应头，
+	// 其中 RateLimit-Reset 是距离配额完全恢复的秒数
+	// HeaderStyleDraft means the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset response headers in the IETF draft format are written,
+	// where RateLimit-Reset is the number of seconds until the quota is fully restored
+	HeaderStyleDraft
+
+	// HeaderStyleLegacy 表示输出传统的 X-RateLimit-Limit、X-RateLimit-Remaining 和 X-RateLimit-Reset 响应头，
+	// 其中 X-RateLimit-Reset 是配额完全恢复时的 Unix 秒数
+	// HeaderStyleLegacy means the legacy X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset response headers are written,
+	// where X-RateLimit-Reset is the Unix time in seconds when the quota is fully restored
+	HeaderStyleLegacy
+)
+
+// DefaultHeaderStyle 是默认的限流响应头样式
+// DefaultHeaderStyle is the default style of the rate limiting response headers
+var DefaultHeaderStyle = HeaderStyleDraft
+
+const (
+	// 限流响应头的名称
+	// Names of the rate limiting response headers
+	HeaderRateLimitLimit           = "RateLimit-Limit"
+	HeaderRateLimitRemaining       = "RateLimit-Remaining"
+	HeaderRateLimitReset           = "RateLimit-Reset"
+	HeaderLegacyRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderLegacyRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderLegacyRateLimitReset     = "X-RateLimit-Reset"
+	HeaderRetryAfter               = "Retry-After"
+)
+
+// writeHeaders 是一个函数，根据响应头样式将决策写入响应头，请求被拒绝时还会写入 Retry-After 响应头
+// writeHeaders is a function that writes the decision to the response headers according to the header style, and also writes the Retry-After response header when the request is rejected
+func writeHeaders(ctx *gin.Context, style HeaderStyle, d *Decision, now time.Time) {
+	switch style {
+	case HeaderStyleDraft:
+		ctx.Header(HeaderRateLimitLimit, strconv.Itoa(d.Limit))
+		ctx.Header(HeaderRateLimitRemaining, strconv.Itoa(d.Remaining))
+		ctx.Header(HeaderRateLimitReset, strconv.FormatInt(ceilSeconds(d.Reset), 10))
+
+	case HeaderStyleLegacy:
+		ctx.Header(HeaderLegacyRateLimitLimit, strconv.Itoa(d.Limit))
+		ctx.Header(HeaderLegacyRateLimitRemaining, strconv.Itoa(d.Remaining))
+		ctx.Header(HeaderLegacyRateLimitReset, strconv.FormatInt(now.Unix()+ceilSeconds(d.Reset), 10))
+
+	default:
+		return
+	}
+
+	// 如果请求被拒绝，则写入 Retry-After 响应头，至少为 1 秒
+	// If the request is rejected, write the Retry-After response header, at least 1 second
+	if !d.Allowed {
+		retryAfter := ceilSeconds(d.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		ctx.Header(HeaderRetryAfter, strconv.FormatInt(retryAfter, 10))
+	}
+}
+
+// ceilSeconds 是一个函数，返回向上取整的秒数
+// ceilSeconds is a function that returns the number of seconds rounded up
+func ceilSeconds(d time.Duration) int64 {
+	seconds := int64(d / time.Second)
+	if d%time.Second > 0 {
+		seconds++
+	}
+	return seconds
+}
@@ -0,0 +1,87 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func testHeadersRouter(handler gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(handler)
+	router.GET(com.TestUrlPath, func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+	return router
+}
+
+func TestLimiter_DraftHeaders(t *testing.T) {
+	// Create a new rate limiter, 1 token per second with a burst of 3
+	conf := NewConfig().WithRate(1).WithBurst(3)
+	router := testHeadersRouter(NewRateLimiter(conf).HandlerFunc())
+
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = com.TestEndpoint2
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		// The limit is the burst, and the remaining quota counts down
+		assert.Equal(t, "3", resp.Header().Get(HeaderRateLimitLimit))
+		if i < 3 {
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, strconv.Itoa(2-i), resp.Header().Get(HeaderRateLimitRemaining))
+			assert.Equal(t, strconv.Itoa(i+1), resp.Header().Get(HeaderRateLimitReset))
+			assert.Empty(t, resp.Header().Get(HeaderRetryAfter))
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+			assert.Equal(t, "0", resp.Header().Get(HeaderRateLimitRemaining))
+			assert.Equal(t, "3", resp.Header().Get(HeaderRateLimitReset))
+			assert.Equal(t, "1", resp.Header().Get(HeaderRetryAfter))
+		}
+	}
+}
+
+func TestIpRateLimiter_LegacyHeaders(t *testing.T) {
+	// Create a new rate limiter with the legacy header style
+	conf := NewConfig().WithRate(1).WithBurst(1).WithHeaderStyle(HeaderStyleLegacy).WithAlgorithm(AlgorithmFixedWindow)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = com.TestEndpoint2
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		// Only the legacy headers are written
+		assert.Equal(t, "1", resp.Header().Get(HeaderLegacyRateLimitLimit))
+		assert.Equal(t, "0", resp.Header().Get(HeaderLegacyRateLimitRemaining))
+		assert.NotEmpty(t, resp.Header().Get(HeaderLegacyRateLimitReset))
+		assert.Empty(t, resp.Header().Get(HeaderRateLimitLimit))
+	}
+}
+
+func TestIpRateLimiter_NoHeaders(t *testing.T) {
+	// Create a new rate limiter without headers
+	conf := NewConfig().WithHeaderStyle(HeaderStyleNone)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = com.TestEndpoint2
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Empty(t, resp.Header().Get(HeaderRateLimitLimit))
+		assert.Empty(t, resp.Header().Get(HeaderRetryAfter))
+	}
+}
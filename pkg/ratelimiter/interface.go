@@ -17,3 +17,13 @@ type emptyCallback struct{}
 // OnLimited 是 emptyCallback 结构体的方法，它不执行任何操作，接收一个 http.Request 指针作为参数
 // OnLimited is a method of the emptyCallback struct, it does not perform any operations, it takes a pointer to http.Request as a parameter
 func (e *emptyCallback) OnLimited(header *http.Request) {}
+
+// DecisionCallback 是一个可选的回调接口，配置的回调实现这个接口时，限流器做出的每个决策都会调用它，包括被允许的请求。
+// 被拒绝的请求仍然会调用 Callback 的 OnLimited 方法
+// DecisionCallback is an optional callback interface, when the callback of the configuration implements it, it is called for every decision made by the limiter, including allowed requests.
+// The OnLimited method of Callback is still called for rejected requests
+type DecisionCallback interface {
+	// OnDecision 是一个方法，在限流器做出决策之后被调用，接收请求和限流决策作为参数
+	// OnDecision is a method that is called after the limiter makes a decision, it takes the request and the rate limiting decision as parameters
+	OnDecision(r *http.Request, d *Decision)
+}
@@ -1,79 +1,283 @@
 package internal
 
 import (
+	"context"
+	"runtime"
 	"sync"
+	"time"
 
 	"github.com/cespare/xxhash/v2"
 )
 
-// Cache 是一个结构体，包含多个 Segment 和一个 sync.Once 类型的变量
-// Cache is a struct that contains multiple Segments and a variable of type sync.Once
-type Cache struct {
+const (
+	// segmentsPerProc 是默认每个处理器对应的段数量
+	// segmentsPerProc is the default number of segments per processor
+	segmentsPerProc = 4
+
+	// minSegments 是默认的最少段数量
+	// minSegments is the default minimum number of segments
+	minSegments = 16
+
+	// maxSegments 是最多的段数量
+	// maxSegments is the maximum number of segments
+	maxSegments = 1 << 12
+)
+
+var (
+	// DefaultScanInterval 定义了默认的扫描间隔
+	// DefaultScanInterval defines the default scan interval
+	DefaultScanInterval = 10 * time.Second
+
+	// DefaultExpireTime 定义了默认的过期时间，条目超过这个时间没有被访问时会被清理
+	// DefaultExpireTime defines the default expiration time, entries not accessed for longer than it are removed
+	DefaultExpireTime = DefaultScanInterval * 3
+)
+
+// Options 是缓存的选项
+// Options is the options of the cache
+type Options struct {
+	// ExpireTime 是过期时间，小于等于 0 时使用默认的过期时间
+	// ExpireTime is the expiration time, the default expiration time is used when it is less than or equal to 0
+	ExpireTime time.Duration
+
+	// ScanInterval 是清理过期条目的扫描间隔，小于等于 0 时使用默认的扫描间隔
+	// ScanInterval is the scan interval for removing expired entries, the default scan interval is used when it is less than or equal to 0
+	ScanInterval time.Duration
+
+	// Capacity 是最多保存的条目数量，超过时淘汰最久没有使用的条目 (LRU)，小于等于 0 时不限制
+	// Capacity is the maximum number of entries kept, the least recently used entry is evicted when it is exceeded (LRU), there is no limit when it is less than or equal to 0
+	Capacity int
+
+	// Segments 是段的数量，会向上取整到 2 的幂，小于等于 0 时根据 GOMAXPROCS 计算
+	// Segments is the number of segments, it is rounded up to a power of 2, it is calculated from GOMAXPROCS when it is less than or equal to 0
+	Segments int
+}
+
+// DefaultOptions 是一个函数，返回默认的选项
+// DefaultOptions is a function that returns the default options
+func DefaultOptions() *Options {
+	return &Options{ExpireTime: DefaultExpireTime, ScanInterval: DefaultScanInterval}
+}
+
+// isOptionsValid 是一个函数，检查选项是否有效，如果无效则设置为默认值，最后返回有效的选项
+// isOptionsValid is a function that checks whether the options are valid, sets them to the default values if not, and finally returns the valid options
+func isOptionsValid(opts *Options) *Options {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if opts.ExpireTime <= 0 {
+		opts.ExpireTime = DefaultExpireTime
+	}
+	if opts.ScanInterval <= 0 {
+		opts.ScanInterval = DefaultScanInterval
+	}
+	if opts.Capacity < 0 {
+		opts.Capacity = 0
+	}
+	opts.Segments = segmentsOf(opts.Segments)
+	return opts
+}
+
+// segmentsOf 是一个函数，返回不小于 n 的 2 的幂作为段的数量，n 小于等于 0 时使用 GOMAXPROCS 的若干倍，使锁的数量与并行度相当
+// segmentsOf is a function that returns the power of 2 not less than n as the number of segments, a multiple of GOMAXPROCS is used when n is less than or equal to 0, so that the number of locks matches the parallelism
+func segmentsOf(n int) int {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0) * segmentsPerProc
+		if n < minSegments {
+			n = minSegments
+		}
+	}
+	if n > maxSegments {
+		n = maxSegments
+	}
+
+	segments := 1
+	for segments < n {
+		segments <<= 1
+	}
+	return segments
+}
+
+// Cache 是一个按键分段加锁的泛型缓存，所有的段共享一个清理过期条目的协程
+// Cache is a generic cache locked by segments of keys, all segments share one goroutine that removes expired entries
+type Cache[V any] struct {
 	// segments 是一个 Segment 类型的切片，用于存储多个 Segment
 	// segments is a slice of type Segment, used to store multiple Segments
-	segments []*Segment
+	segments []*Segment[V]
+
+	// mask 是段数量减 1 的结果，用于根据哈希值选择段
+	// mask is the number of segments minus 1, used to pick the segment by the hash value
+	mask uint64
+
+	// capacity 是实际的容量，为 0 时不限制
+	// capacity is the actual capacity, there is no limit when it is 0
+	capacity int
 
-	// once 是一个 sync.Once 类型的变量，用于确保某些操作只执行一次
-	// once is a variable of type sync.Once, used to ensure that certain operations are performed only once
+	// once 是一个 sync.Once 类型的变量，用于确保缓存只被停止一次
+	// once is a variable of type sync.Once, used to ensure that the cache is stopped only once
 	once sync.Once
+
+	// wg 是一个等待组，用于等待清理协程结束
+	// wg is a wait group used to wait for the cleaning goroutine to finish
+	wg sync.WaitGroup
+
+	// cancel 是一个函数，用于停止清理协程
+	// cancel is a function used to stop the cleaning goroutine
+	cancel context.CancelFunc
+}
+
+// NewCache 是一个函数，返回一个使用默认选项的 Cache 结构体的指针
+// NewCache is a function that returns a new pointer to the Cache struct with the default options
+func NewCache[V any]() *Cache[V] {
+	return NewCacheWithOptions[V](DefaultOptions())
 }
 
-// NewCache 是一个函数，返回一个新的 Cache 结构体的指针
-// NewCache is a function that returns a new pointer to the Cache struct
-func NewCache() *Cache {
-	// 创建一个 Segment 类型的切片，长度为 SegmentSize
-	// Create a slice of type Segment with a length of SegmentSize
-	segments := make([]*Segment, SegmentSize)
+// NewCacheWithOptions 是一个函数，返回一个使用指定选项的 Cache 结构体的指针。
+// 容量平均分配到每个段，向上取整，所以实际的容量是段数量的整数倍
+// NewCacheWithOptions is a function that returns a new pointer to the Cache struct with the specified options.
+// The capacity is split evenly across the segments and rounded up, so the actual capacity is a multiple of the number of segments
+func NewCacheWithOptions[V any](opts *Options) *Cache[V] {
+	// 检查选项是否有效，并计算每个段的容量
+	// Check whether the options are valid, and calculate the capacity of each segment
+	opts = isOptionsValid(opts)
+	capacity := (opts.Capacity + opts.Segments - 1) / opts.Segments
 
-	// 遍历切片
-	// Traverse the slice
-	for i := 0; i < SegmentSize; i++ {
-		// 将切片的每个元素初始化为一个新的 Segment
-		// Initialize each element of the slice as a new Segment
-		segments[i] = NewSegment()
+	// 创建所有的段
+	// Create all segments
+	c := &Cache[V]{
+		segments: make([]*Segment[V], opts.Segments),
+		mask:     uint64(opts.Segments - 1),
+		capacity: capacity * opts.Segments,
+		once:     sync.Once{},
+		wg:       sync.WaitGroup{},
 	}
+	for i := range c.segments {
+		c.segments[i] = NewSegment[V](capacity)
+	}
+
+	// 启动一个清理协程，定期清理所有段中过期的条目
+	// Start a cleaning goroutine that periodically removes expired entries in all segments
+	var ctx context.Context
+	ctx, c.cancel = context.WithCancel(context.Background())
+	c.wg.Add(1)
+	go c.janitor(ctx, opts.ScanInterval, opts.ExpireTime.Milliseconds())
+
+	// 返回新创建的 Cache 结构体的指针
+	// Return the newly created pointer to the Cache struct
+	return c
+}
+
+// janitor 方法每隔 interval 依次清理每个段中过期的条目，直到 ctx 被取消
+// The janitor method removes the expired entries in each segment in turn every interval, until ctx is cancelled
+func (c *Cache[V]) janitor(ctx context.Context, interval time.Duration, expireTime int64) {
+	// 在协程结束时，减少等待组的计数
+	// When the goroutine ends, decrease the count of the wait group
+	defer c.wg.Done()
+
+	// 创建一个新的定时器
+	// Create a new timer
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// 循环处理定时器的事件
+	// Loop to handle the events of the timer
+	for {
+		select {
+		// 如果上下文被取消，则返回
+		// If the context is cancelled, return
+		case <-ctx.Done():
+			return
+
+		// 如果定时器触发，则清理每个段中过期的条目，每次只锁住一个段
+		// If the timer is triggered, remove the expired entries in each segment, locking only one segment at a time
+		case <-ticker.C:
+			now := time.Now().UnixMilli()
+			for _, segment := range c.segments {
+				segment.expire(now, expireTime)
+			}
+		}
+	}
+}
 
-	// 返回一个新的 Cache 结构体的指针，其中 segments 为刚刚创建的切片，once 为一个新的 sync.Once
-	// Return a new pointer to the Cache struct, where segments is the slice just created and once is a new sync.Once
-	return &Cache{segments: segments, once: sync.Once{}}
+// segment 方法返回键所在的段
+// The segment method returns the segment of the key
+func (c *Cache[V]) segment(key string) *Segment[V] {
+	return c.segments[xxhash.Sum64String(key)&c.mask]
 }
 
 // Get 方法用于从缓存中获取指定键的值
 // The Get method is used to get the value of the specified key from the cache
-func (c *Cache) Get(key string) (any, bool) {
-	return c.segments[xxhash.Sum64String(key)&segmentAndOpVal].Get(key)
+func (c *Cache[V]) Get(key string) (V, bool) {
+	return c.segment(key).Get(key)
+}
+
+// Peek 方法用于从缓存中获取指定键的值，不更新它的最后访问时间
+// The Peek method is used to get the value of the specified key from the cache without updating its last access time
+func (c *Cache[V]) Peek(key string) (V, bool) {
+	return c.segment(key).Peek(key)
 }
 
 // GetOrCreate 方法用于从缓存中获取指定键的值，如果键不存在，则使用指定的函数创建一个新的值
 // The GetOrCreate method is used to get the value of the specified key from the cache, if the key does not exist, a new value is created using the specified function
-func (c *Cache) GetOrCreate(key string, fn func() any) (any, bool) {
-	return c.segments[xxhash.Sum64String(key)&segmentAndOpVal].GetOrCreate(key, fn)
+func (c *Cache[V]) GetOrCreate(key string, fn func() V) (V, bool) {
+	return c.segment(key).GetOrCreate(key, fn)
+}
+
+// Acquire 方法用于从缓存中获取或创建指定键的值，并返回一个句柄，在句柄被释放之前，条目不会过期，也不会被淘汰
+// The Acquire method is used to get or create the value of the specified key from the cache and returns a handle, the entry neither expires nor is evicted until the handle is released
+func (c *Cache[V]) Acquire(key string, fn func() V) (V, Handle[V]) {
+	return c.segment(key).Acquire(key, fn)
 }
 
 // Set 方法用于在缓存中设置指定键的值
 // The Set method is used to set the value of the specified key in the cache
-func (c *Cache) Set(key string, value any) {
-	c.segments[xxhash.Sum64String(key)&segmentAndOpVal].Set(key, value)
+func (c *Cache[V]) Set(key string, value V) {
+	c.segment(key).Set(key, value)
+}
+
+// Replace 方法用于使用 fn 创建的新值替换缓存中指定键已有的值，返回键是否存在
+// The Replace method is used to replace the existing value of the specified key in the cache with a new value created by fn, and returns whether the key exists
+func (c *Cache[V]) Replace(key string, fn func() V) bool {
+	return c.segment(key).Replace(key, fn)
 }
 
 // Delete 方法用于从缓存中删除指定键的值
 // The Delete method is used to delete the value of the specified key from the cache
-func (c *Cache) Delete(key string) {
-	c.segments[xxhash.Sum64String(key)&segmentAndOpVal].Delete(key)
+func (c *Cache[V]) Delete(key string) {
+	c.segment(key).Delete(key)
+}
+
+// Len 方法用于获取缓存中条目的数量
+// The Len method is used to get the number of entries in the cache
+func (c *Cache[V]) Len() int {
+	n := 0
+	for _, segment := range c.segments {
+		n += segment.Len()
+	}
+	return n
 }
 
-// Segments 方法用于获取缓存的所有段
-// The Segments method is used to get all segments of the cache
-func (c *Cache) Segments() []*Segment {
-	return c.segments
+// Capacity 方法用于获取缓存实际的容量，为 0 时不限制
+// The Capacity method is used to get the actual capacity of the cache, there is no limit when it is 0
+func (c *Cache[V]) Capacity() int {
+	return c.capacity
 }
 
-// Stop 方法用于停止缓存，它会停止缓存的所有段
-// The Stop method is used to stop the cache, it will stop all segments of the cache
-func (c *Cache) Stop() {
-	c.once.Do(func() {
-		for i := 0; i < SegmentSize; i++ {
-			c.segments[i].Stop()
+// Range 方法依次在每个段的锁内对缓存中的每个键和值调用 fn，fn 返回 false 时停止遍历
+// The Range method calls fn for each key and value in the cache within the lock of each segment in turn, and stops when fn returns false
+func (c *Cache[V]) Range(fn func(key string, value V) bool) {
+	for _, segment := range c.segments {
+		if !segment.Range(fn) {
+			return
 		}
+	}
+}
+
+// Stop 方法用于停止缓存的清理协程
+// The Stop method is used to stop the cleaning goroutine of the cache
+func (c *Cache[V]) Stop() {
+	c.once.Do(func() {
+		c.cancel()
+		c.wg.Wait()
 	})
 }
@@ -1,15 +1,18 @@
 package internal
 
 import (
+	"runtime"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCache_GetOrCreate(t *testing.T) {
 	// Create a new cache
-	cache := NewCache()
+	cache := NewCache[string]()
 	defer cache.Stop()
 
 	// Define a test key and value
@@ -17,7 +20,7 @@ func TestCache_GetOrCreate(t *testing.T) {
 	value := "testValue"
 
 	// Define a test function
-	fn := func() any {
+	fn := func() string {
 		return value
 	}
 
@@ -38,7 +41,7 @@ func TestCache_GetOrCreate(t *testing.T) {
 
 func TestCache_Get(t *testing.T) {
 	// Create a new cache
-	cache := NewCache()
+	cache := NewCache[string]()
 	defer cache.Stop()
 
 	// Define a test key and value
@@ -46,7 +49,7 @@ func TestCache_Get(t *testing.T) {
 	value := "testValue"
 
 	// Set the value in the cache
-	cache.segments[xxhash.Sum64String(key)&segmentAndOpVal].Set(key, value)
+	cache.segment(key).Set(key, value)
 
 	// Call the Get function
 	result, ok := cache.Get(key)
@@ -56,19 +59,19 @@ func TestCache_Get(t *testing.T) {
 	assert.Equal(t, value, result)
 
 	// Delete the value from the cache
-	cache.segments[xxhash.Sum64String(key)&segmentAndOpVal].Delete(key)
+	cache.segment(key).Delete(key)
 
 	// Call the Get function
 	result, ok = cache.Get(key)
 
 	// Assert that the result is correct
 	assert.False(t, ok)
-	assert.Nil(t, result)
+	assert.Empty(t, result)
 }
 
 func TestCache_Set(t *testing.T) {
 	// Create a new cache
-	cache := NewCache()
+	cache := NewCache[string]()
 	defer cache.Stop()
 
 	// Define a test key and value
@@ -85,3 +88,142 @@ func TestCache_Set(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, value, result)
 }
+
+func TestCache_Range(t *testing.T) {
+	// Create a new cache
+	cache := NewCache[int]()
+	defer cache.Stop()
+
+	// Set values spread over several segments
+	for i := 0; i < 100; i++ {
+		cache.Set(strconv.Itoa(i), i)
+	}
+
+	// Call the Range function to visit all values
+	seen := make(map[string]int)
+	cache.Range(func(key string, value int) bool {
+		seen[key] = value
+		return true
+	})
+	assert.Len(t, seen, 100)
+
+	// Stop the traversal after the first value
+	count := 0
+	cache.Range(func(key string, value int) bool {
+		count++
+		return false
+	})
+	assert.Equal(t, 1, count)
+}
+
+func TestCache_Capacity(t *testing.T) {
+	// The capacity is split across the segments and rounded up
+	cache := NewCacheWithOptions[int](&Options{Capacity: 20, Segments: 16})
+	defer cache.Stop()
+	assert.Equal(t, 32, cache.Capacity())
+
+	for i := 0; i < 1000; i++ {
+		cache.Set(strconv.Itoa(i), i)
+	}
+	assert.LessOrEqual(t, cache.Len(), 32)
+	assert.Greater(t, cache.Len(), 0)
+}
+
+func TestCache_Expire(t *testing.T) {
+	// Create a new cache whose entries expire quickly
+	cache := NewCacheWithOptions[int](&Options{ExpireTime: 20 * time.Millisecond, ScanInterval: 5 * time.Millisecond})
+	defer cache.Stop()
+
+	cache.Set("a", 1)
+	assert.Eventually(t, func() bool { return cache.Len() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestCache_AcquireExpireConcurrently(t *testing.T) {
+	// Create a new cache whose entries expire and are evicted all the time
+	cache := NewCacheWithOptions[*string](&Options{ExpireTime: time.Millisecond, ScanInterval: time.Millisecond, Capacity: 8, Segments: 1})
+	defer cache.Stop()
+
+	// While a value is held, the key keeps the same value, whatever the cleaning goroutine and the other callers do
+	wg := sync.WaitGroup{}
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				key := strconv.Itoa((i + j) % 16)
+				value, handle := cache.Acquire(key, func() *string { return &key })
+				got, ok := cache.Get(key)
+				assert.True(t, ok)
+				assert.Same(t, value, got)
+				assert.Equal(t, key, *value)
+				handle.Release()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Released entries expire as usual
+	assert.Eventually(t, func() bool { return cache.Len() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestCache_Goroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	// A cache starts exactly one cleaning goroutine, whatever the number of segments
+	cache := NewCacheWithOptions[int](&Options{Segments: 256})
+	assert.Equal(t, before+1, runtime.NumGoroutine())
+
+	cache.Stop()
+	assert.Equal(t, before, runtime.NumGoroutine())
+}
+
+func TestSegmentsOf(t *testing.T) {
+	assert.Equal(t, 16, segmentsOf(9))
+	assert.Equal(t, 16, segmentsOf(16))
+	assert.Equal(t, maxSegments, segmentsOf(maxSegments*2))
+
+	// The default number of segments is a power of 2 scaled to GOMAXPROCS
+	n := segmentsOf(0)
+	assert.Equal(t, 0, n&(n-1))
+	assert.GreaterOrEqual(t, n, minSegments)
+	assert.GreaterOrEqual(t, n, runtime.GOMAXPROCS(0))
+}
+
+func BenchmarkCache_GetOrCreate(b *testing.B) {
+	cache := NewCache[*int]()
+	defer cache.Stop()
+
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	fn := func() *int { return new(int) }
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cache.GetOrCreate(keys[i&1023], fn)
+			i++
+		}
+	})
+}
+
+func BenchmarkNewCache(b *testing.B) {
+	// Report the goroutines started by each cache, the former design started one per segment
+	before := runtime.NumGoroutine()
+	caches := make([]*Cache[int], 0, b.N)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		caches = append(caches, NewCache[int]())
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(runtime.NumGoroutine()-before)/float64(b.N), "goroutines/op")
+	for _, cache := range caches {
+		cache.Stop()
+	}
+}
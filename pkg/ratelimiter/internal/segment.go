@@ -1,241 +1,343 @@
 package internal
 
 import (
-	"context"
+	"container/list"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const (
-	// SegmentSize 定义了 Segment 的大小
-	// SegmentSize defines the size of the Segment
-	SegmentSize = 1 << 8
+// Expirer 是一个接口，缓存中的值可以实现这个接口，提供一个比最后访问时间更晚的更新时间来推迟自身的过期
+// Expirer is an interface, values in the cache can implement it to provide an update time later than the last access time to delay their own expiration
+type Expirer interface {
+	// GetUpdateAt 返回最后更新时间的 Unix 毫秒数
+	// GetUpdateAt returns the last update time in Unix milliseconds
+	GetUpdateAt() int64
+}
 
-	// segmentAndOpVal 是 SegmentSize 减 1 的结果，用于位运算
-	// segmentAndOpVal is the result of SegmentSize minus 1, used for bitwise operations
-	segmentAndOpVal = SegmentSize - 1
-)
+// entry 是段中的一个条目，包含值、最后访问时间和引用计数
+// entry is an entry in the segment, containing the value, the last access time and the reference count
+type entry[V any] struct {
+	// key 是条目的键
+	// key is the key of the entry
+	key string
 
-var (
-	// defaultScanInterval 定义了默认的扫描间隔
-	// defaultScanInterval defines the default scan interval
-	defaultScanInterval = 10 * time.Second
+	// value 是条目的值
+	// value is the value of the entry
+	value V
 
-	// defaultExpireTime 定义了默认的过期时间
-	// defaultExpireTime defines the default expiration time
-	defaultExpireTime = (defaultScanInterval).Milliseconds() * 3
-)
+	// accessAt 是最后访问时间的 Unix 毫秒数
+	// accessAt is the last access time in Unix milliseconds
+	accessAt atomic.Int64
+
+	// refs 是正在使用条目的调用者数量，大于 0 时条目不会过期，也不会被淘汰
+	// refs is the number of callers using the entry, the entry neither expires nor is evicted while it is greater than 0
+	refs atomic.Int32
+
+	// lru 是条目在段的 LRU 列表中的位置，只有限制了容量时才不为 nil
+	// lru is the position of the entry in the LRU list of the segment, it is not nil only when the capacity is limited
+	lru *list.Element
+}
+
+// Handle 是通过 Acquire 获取的条目的句柄，使用完值之后需要调用 Release 释放
+// Handle is the handle of an entry obtained by Acquire, Release must be called after the value is no longer used
+type Handle[V any] struct {
+	// e 是句柄引用的条目
+	// e is the entry referenced by the handle
+	e *entry[V]
+}
+
+// Release 方法释放句柄引用的条目，并更新它的最后访问时间，所以过期时间从最后一次使用结束时开始计算。每个句柄只能释放一次
+// The Release method releases the entry referenced by the handle and updates its last access time, so the expiration time counts from the end of the last use. Each handle can be released only once
+func (h Handle[V]) Release() {
+	if h.e != nil {
+		h.e.accessAt.Store(time.Now().UnixMilli())
+		h.e.refs.Add(-1)
+	}
+}
 
-// Segment 是一个结构体，包含数据、锁、上下文等字段
-// Segment is a struct that contains fields such as data, lock, context, etc.
-type Segment struct {
-	// data 是一个 map，用于存储数据
-	// data is a map used to store data
-	data map[string]any
+// Segment 是一个结构体，包含数据和保护数据的锁，是缓存的一个分片
+// Segment is a struct that contains the data and the lock protecting it, it is a shard of the cache
+type Segment[V any] struct {
+	// data 是一个 map，用于存储条目
+	// data is a map used to store entries
+	data map[string]*entry[V]
 
 	// lock 是一个互斥锁，用于保护数据的并发访问
 	// lock is a mutex used to protect concurrent access to data
 	lock sync.Mutex
 
-	// once 是一个 sync.Once 类型的变量，用于确保某些操作只执行一次
-	// once is a variable of type sync.Once, used to ensure that certain operations are performed only once
-	once sync.Once
-
-	// wg 是一个等待组，用于等待 goroutine 完成
-	// wg is a wait group used to wait for goroutines to finish
-	wg sync.WaitGroup
-
-	// ctx 是一个上下文，用于控制 goroutine 的生命周期
-	// ctx is a context used to control the lifecycle of goroutines
-	ctx context.Context
+	// capacity 是段最多保存的条目数量，为 0 时不限制
+	// capacity is the maximum number of entries kept in the segment, there is no limit when it is 0
+	capacity int
 
-	// cancel 是一个函数，用于取消 ctx
-	// cancel is a function used to cancel ctx
-	cancel context.CancelFunc
+	// lru 是按最近使用时间排列的键，最近使用的在前面，只有限制了容量时才不为 nil
+	// lru is the keys ordered by the time of the last use, the most recently used first, it is not nil only when the capacity is limited
+	lru *list.List
 }
 
-// NewSegment 是一个函数，返回一个新的 Segment 结构体的指针
-// NewSegment is a function that returns a new pointer to the Segment struct
-func NewSegment() *Segment {
+// NewSegment 是一个函数，返回一个最多保存 capacity 个条目的 Segment 结构体的指针，capacity 小于等于 0 时不限制
+// NewSegment is a function that returns a new pointer to the Segment struct keeping at most capacity entries, there is no limit when capacity is less than or equal to 0
+func NewSegment[V any](capacity int) *Segment[V] {
 	// 创建一个新的 Segment 结构体的指针
 	// Create a new pointer to the Segment struct
-	s := &Segment{
+	s := &Segment[V]{
 		// 初始化 data 为一个新的 map
 		// Initialize data as a new map
-		data: make(map[string]any),
+		data: make(map[string]*entry[V]),
 
 		// 初始化 lock 为一个新的 sync.Mutex
 		// Initialize lock as a new sync.Mutex
 		lock: sync.Mutex{},
+	}
 
-		// 初始化 once 为一个新的 sync.Once
-		// Initialize once as a new sync.Once
-		once: sync.Once{},
-
-		// 初始化 wg 为一个新的 sync.WaitGroup
-		// Initialize wg as a new sync.WaitGroup
-		wg: sync.WaitGroup{},
-	}
-
-	// 创建一个新的上下文和取消函数
-	// Create a new context and cancel function
-	s.ctx, s.cancel = context.WithCancel(context.Background())
-
-	// 增加等待组的计数
-	// Increase the count of the wait group
-	s.wg.Add(1)
-
-	// 创建一个新的 goroutine
-	// Create a new goroutine
-	go func() {
-		// 在 goroutine 结束时，减少等待组的计数
-		// When the goroutine ends, decrease the count of the wait group
-		defer s.wg.Done()
-
-		// 创建一个新的定时器
-		// Create a new timer
-		ticker := time.NewTicker(defaultScanInterval)
-
-		// 循环处理定时器的事件
-		// Loop to handle the events of the timer
-		for {
-			select {
-			// 如果上下文被取消，停止定时器并返回
-			// If the context is cancelled, stop the timer and return
-			case <-s.ctx.Done():
-				// 停止定时器
-				// Stop the timer
-				ticker.Stop()
-
-				return
-
-			// 如果定时器触发，锁定数据并处理过期的元素
-			// If the timer is triggered, lock the data and handle the expired elements
-			case <-ticker.C:
-				// 加锁，保护数据的并发访问
-				// Lock to protect concurrent access to data
-				s.lock.Lock()
-
-				// 获取当前的 Unix 毫秒时间
-				// Get the current Unix millisecond time
-				now := time.Now().UnixMilli()
-
-				// 遍历数据
-				// Traverse the data
-				for key, value := range s.data {
-					// 如果元素的更新时间距离现在超过了默认的过期时间
-					// If the update time of the element is more than the default expiration time from now
-					if now-value.(*Element).GetUpdateAt() >= defaultExpireTime {
-						// 将元素的值设置为 nil
-						// Set the value of the element to nil
-						value.(*Element).SetValue(nil)
-
-						// 将元素放回到元素池
-						// Put the element back into the element pool
-						ElementPool.Put(value)
-
-						// 从数据中删除这个元素
-						// Delete this element from the data
-						delete(s.data, key)
-					}
-				}
-
-				// 解锁，释放数据的并发访问
-				// Unlock to release concurrent access to data
-				s.lock.Unlock()
-			}
-		}
-	}()
+	// 如果限制了容量，则按最近使用时间记录键
+	// If the capacity is limited, record the keys by the time of the last use
+	if capacity > 0 {
+		s.capacity = capacity
+		s.lru = list.New()
+	}
 
 	// 返回新创建的 Segment 结构体的指针
 	// Return the newly created pointer to the Segment struct
 	return s
 }
 
-// Get 方法用于获取指定键的值
-// The Get method is used to get the value of the specified key
-func (s *Segment) Get(key string) (any, bool) {
+// Get 方法用于获取指定键的值，并更新它的最后访问时间
+// The Get method is used to get the value of the specified key and update its last access time
+func (s *Segment[V]) Get(key string) (V, bool) {
 	// 加锁，防止并发操作
 	// Lock to prevent concurrent operations
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	// 获取指定键的值
-	// Get the value of the specified key
-	value, ok := s.data[key]
+	// 获取指定键的条目
+	// Get the entry of the specified key
+	e, ok := s.data[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	s.touch(e)
 
 	// 返回值和是否存在的标志
 	// Return the value and the flag of whether it exists
-	return value, ok
+	return e.value, true
+}
+
+// Peek 方法用于获取指定键的值，不更新它的最后访问时间，所以查看条目不会推迟它的过期
+// The Peek method is used to get the value of the specified key without updating its last access time, so looking at an entry does not delay its expiration
+func (s *Segment[V]) Peek(key string) (V, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if e, ok := s.data[key]; ok {
+		return e.value, true
+	}
+	var zero V
+	return zero, false
 }
 
-// GetOrCreate 方法用于获取指定键的值，如果不存在，则创建一个新的值
-// The GetOrCreate method is used to get the value of the specified key, if it does not exist, create a new value
-func (s *Segment) GetOrCreate(key string, fn func() any) (any, bool) {
+// GetOrCreate 方法用于获取指定键的值，如果不存在，则在锁内使用 fn 创建一个新的值
+// The GetOrCreate method is used to get the value of the specified key, if it does not exist, a new value is created with fn within the lock
+func (s *Segment[V]) GetOrCreate(key string, fn func() V) (V, bool) {
 	// 加锁，防止并发操作
 	// Lock to prevent concurrent operations
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	// 获取指定键的值
-	// Get the value of the specified key
-	value, ok := s.data[key]
-
-	// 如果值不存在
-	// If the value does not exist
-	if !ok {
-		// 创建一个新的值
-		// Create a new value
-		value = fn()
-		// 将新的值添加到数据中
-		// Add the new value to the data
-		s.data[key] = value
+	// 如果键已经存在，则返回它的值
+	// If the key already exists, return its value
+	if e, ok := s.data[key]; ok {
+		s.touch(e)
+		return e.value, true
 	}
 
+	// 创建一个新的值，并添加到数据中
+	// Create a new value and add it to the data
+	value := fn()
+	s.add(key, value, 0)
+
 	// 返回值和是否存在的标志
 	// Return the value and the flag of whether it exists
-	return value, ok
+	return value, false
+}
+
+// Acquire 方法与 GetOrCreate 相同，但是同时增加条目的引用计数，在返回的句柄被释放之前，条目不会过期，也不会被淘汰，
+// 所以调用者在使用值的过程中，不会有其他调用者为同一个键创建另一个值
+// The Acquire method is the same as GetOrCreate, but it also increases the reference count of the entry, the entry neither expires nor is evicted until the returned handle is released,
+// so while the caller uses the value, no other caller creates another value for the same key
+func (s *Segment[V]) Acquire(key string, fn func() V) (V, Handle[V]) {
+	// 加锁，防止并发操作
+	// Lock to prevent concurrent operations
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// 如果键已经存在，则增加它的引用计数
+	// If the key already exists, increase its reference count
+	if e, ok := s.data[key]; ok {
+		e.refs.Add(1)
+		s.touch(e)
+		return e.value, Handle[V]{e: e}
+	}
+
+	// 创建一个新的值，并以引用计数 1 添加到数据中，避免它在添加时被淘汰
+	// Create a new value and add it to the data with a reference count of 1, so that it is not evicted when it is added
+	e := s.add(key, fn(), 1)
+	return e.value, Handle[V]{e: e}
 }
 
 // Set 方法用于设置指定键的值
 // The Set method is used to set the value of the specified key
-func (s *Segment) Set(key string, value any) {
+func (s *Segment[V]) Set(key string, value V) {
 	// 加锁，防止并发操作
 	// Lock to prevent concurrent operations
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	// 设置指定键的值
-	// Set the value of the specified key
-	s.data[key] = value
+	// 如果键已经存在，则替换它的值，否则添加一个新的条目
+	// If the key already exists, replace its value, otherwise add a new entry
+	if e, ok := s.data[key]; ok {
+		e.value = value
+		s.touch(e)
+		return
+	}
+	s.add(key, value, 0)
+}
+
+// Replace 方法在锁内使用 fn 创建一个新的值替换指定键已有的值，键不存在时不创建，返回键是否存在
+// The Replace method replaces the existing value of the specified key with a new value created by fn within the lock, nothing is created when the key does not exist, and returns whether the key exists
+func (s *Segment[V]) Replace(key string, fn func() V) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.data[key]
+	if ok {
+		e.value = fn()
+		s.touch(e)
+	}
+	return ok
 }
 
 // Delete 方法用于删除指定键的值
 // The Delete method is used to delete the value of the specified key
-func (s *Segment) Delete(key string) {
+func (s *Segment[V]) Delete(key string) {
 	// 加锁，防止并发操作
 	// Lock to prevent concurrent operations
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	// 删除指定键的值
-	// Delete the value of the specified key
-	delete(s.data, key)
+	// 删除指定键的条目
+	// Delete the entry of the specified key
+	if e, ok := s.data[key]; ok {
+		s.remove(key, e)
+	}
+}
+
+// Len 方法用于获取段中条目的数量
+// The Len method is used to get the number of entries in the segment
+func (s *Segment[V]) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.data)
+}
+
+// Range 方法在持有锁的情况下依次对段中的每个键和值调用 fn，fn 返回 false 时停止遍历，遍历不会更新最后访问时间。
+// fn 中不能再调用段的其他方法，否则会死锁
+// The Range method calls fn for each key and value in the segment while holding the lock, and stops when fn returns false, the traversal does not update the last access time.
+// fn must not call other methods of the segment, otherwise it deadlocks
+func (s *Segment[V]) Range(fn func(key string, value V) bool) bool {
+	// 加锁，防止遍历时数据被并发修改
+	// Lock to prevent the data from being modified concurrently during the traversal
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// 遍历数据
+	// Traverse the data
+	for key, e := range s.data {
+		if !fn(key, e.value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expire 方法删除在 now 之前 expireTime 毫秒内没有被访问，并且没有被使用的条目，返回删除的数量。
+// 如果值实现了 Expirer 接口，并且它的更新时间晚于最后访问时间，则使用它的更新时间
+// The expire method deletes the entries that are not in use and not accessed within expireTime milliseconds before now, and returns the number of deleted entries.
+// If the value implements the Expirer interface and its update time is later than the last access time, its update time is used
+func (s *Segment[V]) expire(now, expireTime int64) int {
+	// 加锁，保护数据的并发访问
+	// Lock to protect concurrent access to data
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// 遍历数据，删除过期的条目
+	// Traverse the data and delete the expired entries
+	n := 0
+	for key, e := range s.data {
+		// 正在被使用的条目不会过期
+		// Entries in use do not expire
+		if e.refs.Load() > 0 {
+			continue
+		}
+
+		updateAt := e.accessAt.Load()
+		if v, ok := any(e.value).(Expirer); ok {
+			if at := v.GetUpdateAt(); at > updateAt {
+				updateAt = at
+			}
+		}
+		if now-updateAt >= expireTime {
+			s.remove(key, e)
+			n++
+		}
+	}
+
+	return n
 }
 
-// GetData 方法用于获取所有的数据
-// The GetData method is used to get all data
-func (s *Segment) GetData() map[string]any {
-	// 返回所有的数据
-	// Return all data
-	return s.data
+// add 方法以指定的引用计数添加一个新的键和值，如果超过了容量，则淘汰最久没有使用并且没有被使用的键，调用时需要持有锁。
+// 新添加的键不会被自己淘汰，如果其他的键都在被使用，则暂时超过容量，超出的数量不会超过并发的调用者数量加一
+// The add method adds a new key and value with the specified reference count, and evicts the least recently used key that is not in use if the capacity is exceeded, the lock must be held when calling it.
+// The new key is never evicted by its own addition, if all other keys are in use, the capacity is exceeded temporarily, by no more than the number of concurrent callers plus one
+func (s *Segment[V]) add(key string, value V, refs int32) *entry[V] {
+	e := &entry[V]{key: key, value: value}
+	e.accessAt.Store(time.Now().UnixMilli())
+	e.refs.Store(refs)
+	s.data[key] = e
+	if s.lru == nil {
+		return e
+	}
+
+	e.lru = s.lru.PushFront(e)
+	for victim := s.lru.Back(); victim != nil && len(s.data) > s.capacity; {
+		prev := victim.Prev()
+		if v := victim.Value.(*entry[V]); v != e && v.refs.Load() <= 0 {
+			s.remove(v.key, v)
+		}
+		victim = prev
+	}
+
+	return e
 }
 
-// Stop 方法用于停止段的操作，但在这里没有实现任何功能
-// The Stop method is used to stop the operation of the segment, but it does not implement any functionality here
-func (s *Segment) Stop() {
-	s.once.Do(func() {
-		s.cancel()
-		s.wg.Wait()
-	})
+// touch 方法更新条目的最后访问时间，并将它标记为最近使用，调用时需要持有锁
+// The touch method updates the last access time of the entry and marks it as the most recently used, the lock must be held when calling it
+func (s *Segment[V]) touch(e *entry[V]) {
+	e.accessAt.Store(time.Now().UnixMilli())
+	if e.lru != nil {
+		s.lru.MoveToFront(e.lru)
+	}
+}
+
+// remove 方法删除键的条目，调用时需要持有锁
+// The remove method deletes the entry of the key, the lock must be held when calling it
+func (s *Segment[V]) remove(key string, e *entry[V]) {
+	delete(s.data, key)
+	if e.lru != nil {
+		s.lru.Remove(e.lru)
+		e.lru = nil
+	}
 }
@@ -2,21 +2,21 @@ package internal
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSegment_GetOrCreate(t *testing.T) {
 	// Create a new segment
-	segment := NewSegment()
-	defer segment.Stop()
+	segment := NewSegment[string](0)
 
 	// Define a test key and value
 	key := "testKey"
 	value := "testValue"
 
 	// Define a test function
-	fn := func() any {
+	fn := func() string {
 		return value
 	}
 
@@ -37,15 +37,14 @@ func TestSegment_GetOrCreate(t *testing.T) {
 
 func TestSegment_Get(t *testing.T) {
 	// Create a new segment
-	segment := NewSegment()
-	defer segment.Stop()
+	segment := NewSegment[string](0)
 
 	// Define a test key and value
 	key := "testKey"
 	value := "testValue"
 
 	// Set the value in the segment
-	segment.data[key] = value
+	segment.data[key] = &entry[string]{value: value}
 
 	// Call the Get function
 	result, ok := segment.Get(key)
@@ -62,13 +61,12 @@ func TestSegment_Get(t *testing.T) {
 
 	// Assert that the result is correct
 	assert.False(t, ok)
-	assert.Nil(t, result)
+	assert.Empty(t, result)
 }
 
 func TestSegment_Set(t *testing.T) {
 	// Create a new segment
-	segment := NewSegment()
-	defer segment.Stop()
+	segment := NewSegment[string](0)
 
 	// Define a test key and value
 	key := "testKey"
@@ -84,3 +82,182 @@ func TestSegment_Set(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, value, result)
 }
+
+func TestSegment_Range(t *testing.T) {
+	// Create a new segment
+	segment := NewSegment[int](0)
+
+	segment.Set("a", 1)
+	segment.Set("b", 2)
+
+	// Call the Range function to sum all values
+	sum := 0
+	assert.True(t, segment.Range(func(key string, value int) bool {
+		sum += value
+		return true
+	}))
+	assert.Equal(t, 3, sum)
+
+	// Stop the traversal after the first value
+	count := 0
+	assert.False(t, segment.Range(func(key string, value int) bool {
+		count++
+		return false
+	}))
+	assert.Equal(t, 1, count)
+}
+
+func TestSegment_Capacity(t *testing.T) {
+	// Create a new segment which keeps at most 2 elements
+	segment := NewSegment[int](2)
+
+	segment.Set("a", 1)
+	segment.Set("b", 2)
+
+	// Use "a" so that "b" becomes the least recently used
+	_, ok := segment.Get("a")
+	assert.True(t, ok)
+
+	// Adding a third element evicts "b"
+	segment.GetOrCreate("c", func() int { return 3 })
+	assert.Equal(t, 2, segment.Len())
+	_, ok = segment.Get("b")
+	assert.False(t, ok)
+	_, ok = segment.Get("a")
+	assert.True(t, ok)
+
+	// Updating an existing element does not evict anything
+	segment.Set("a", 4)
+	assert.Equal(t, 2, segment.Len())
+
+	// Deleted elements free their place
+	segment.Delete("a")
+	segment.Set("d", 5)
+	assert.Equal(t, 2, segment.Len())
+	_, ok = segment.Get("c")
+	assert.True(t, ok)
+}
+
+func TestSegment_Expire(t *testing.T) {
+	// Create a new segment which keeps at most 10 entries
+	segment := NewSegment[int](10)
+	segment.Set("a", 1)
+	segment.Set("b", 2)
+
+	// Only the entries not accessed within the expiration time are removed
+	now := time.Now().UnixMilli()
+	segment.data["a"].accessAt.Store(now - 100)
+	assert.Equal(t, 1, segment.expire(now, 50))
+	assert.Equal(t, 1, segment.Len())
+	_, ok := segment.Get("b")
+	assert.True(t, ok)
+
+	// The expired key no longer takes a place in the LRU list
+	assert.Equal(t, 1, segment.lru.Len())
+}
+
+type testExpirer int64
+
+func (e testExpirer) GetUpdateAt() int64 { return int64(e) }
+
+func TestSegment_Expirer(t *testing.T) {
+	segment := NewSegment[testExpirer](0)
+
+	// A value with a later update time delays its own expiration
+	now := time.Now().UnixMilli()
+	segment.Set("a", testExpirer(now+1000))
+	segment.data["a"].accessAt.Store(now - 100)
+	assert.Equal(t, 0, segment.expire(now, 50))
+	assert.Equal(t, 1, segment.expire(now+1100, 50))
+}
+
+func TestSegment_Acquire(t *testing.T) {
+	segment := NewSegment[int](0)
+
+	// Acquire creates the value once and pins the entry
+	value, h1 := segment.Acquire("a", func() int { return 1 })
+	assert.Equal(t, 1, value)
+	value, h2 := segment.Acquire("a", func() int { return 2 })
+	assert.Equal(t, 1, value)
+	assert.Equal(t, int32(2), segment.data["a"].refs.Load())
+
+	// A pinned entry does not expire
+	now := time.Now().UnixMilli()
+	segment.data["a"].accessAt.Store(now - 100)
+	assert.Equal(t, 0, segment.expire(now, 50))
+
+	// The entry expires only after every handle is released, counting from the last release
+	h1.Release()
+	assert.Equal(t, 0, segment.expire(now, 50))
+	h2.Release()
+	assert.Equal(t, 0, segment.expire(time.Now().UnixMilli(), 50))
+	assert.Equal(t, 1, segment.expire(time.Now().UnixMilli()+100, 50))
+	assert.Equal(t, 0, segment.Len())
+}
+
+func TestSegment_AcquireCapacity(t *testing.T) {
+	// Create a new segment which keeps at most 1 entry
+	segment := NewSegment[int](1)
+
+	// A pinned entry is not evicted, and the new entry is kept too, so the capacity is exceeded temporarily
+	_, h := segment.Acquire("a", func() int { return 1 })
+	segment.Set("b", 2)
+	assert.Equal(t, 2, segment.Len())
+	_, ok := segment.Get("a")
+	assert.True(t, ok)
+	_, ok = segment.Peek("b")
+	assert.True(t, ok)
+
+	// After the release, the entry can be evicted again
+	h.Release()
+	segment.Set("c", 3)
+	assert.Equal(t, 1, segment.Len())
+	_, ok = segment.Get("c")
+	assert.True(t, ok)
+}
+
+func TestSegment_GetOrCreateAllPinned(t *testing.T) {
+	// Create a new segment which keeps at most 1 entry
+	segment := NewSegment[int](1)
+
+	// When all other entries are in use, the created entry is still tracked by the segment
+	_, h := segment.Acquire("a", func() int { return 1 })
+	defer h.Release()
+	value, ok := segment.GetOrCreate("b", func() int { return 2 })
+	assert.False(t, ok)
+	assert.Equal(t, 2, value)
+	value, ok = segment.GetOrCreate("b", func() int { return 3 })
+	assert.True(t, ok)
+	assert.Equal(t, 2, value)
+
+	// The next entry evicts the unpinned one instead of itself
+	segment.Set("c", 3)
+	assert.Equal(t, 2, segment.Len())
+	_, ok = segment.Peek("b")
+	assert.False(t, ok)
+	_, ok = segment.Peek("c")
+	assert.True(t, ok)
+}
+
+func TestSegment_PeekReplace(t *testing.T) {
+	segment := NewSegment[int](0)
+
+	// Replacing a missing key creates nothing
+	assert.False(t, segment.Replace("a", func() int { return 1 }))
+	_, ok := segment.Peek("a")
+	assert.False(t, ok)
+
+	// Peeking does not update the last access time
+	segment.Set("a", 1)
+	now := time.Now().UnixMilli()
+	segment.data["a"].accessAt.Store(now - 100)
+	value, ok := segment.Peek("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+	assert.Equal(t, now-100, segment.data["a"].accessAt.Load())
+
+	// Replacing an existing key replaces its value
+	assert.True(t, segment.Replace("a", func() int { return 2 }))
+	value, _ = segment.Peek("a")
+	assert.Equal(t, 2, value)
+}
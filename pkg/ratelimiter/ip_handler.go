@@ -3,22 +3,48 @@ package ratelimiter
 import (
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
 	itl "github.com/shengyanli1982/orbit-contrib/pkg/ratelimiter/internal"
-	"golang.org/x/time/rate"
+	gr "golang.org/x/time/rate"
 )
 
 // IpRateLimiter 是一个结构体，包含配置和限流器
 // IpRateLimiter is a struct that contains configuration and rate limiter
 type IpRateLimiter struct {
-	// cache 是一个指向 itl.Cache 的指针，用于存储限流器
-	// cache is a pointer to itl.Cache, used to store rate limiters
-	cache *itl.Cache
+	// cache 是一个指向 itl.Cache 的指针，用于存储每个键的限流器
+	// cache is a pointer to itl.Cache, used to store the rate limiter of each key
+	cache *itl.Cache[Limiter]
 
-	// config 是一个指向 Config 的指针，用于存储限流器的配置
-	// config is a pointer to Config, used to store the configuration of the rate limiter
-	config *Config
+	// config 是可以在运行时修改的配置
+	// config is the configuration that can be changed at runtime
+	config *liveConfig
+
+	// gcra 是 GCRA 算法的共享参数，只有在使用 GCRA 算法时才不为 nil
+	// gcra is the shared parameters of the GCRA algorithm, it is not nil only when the GCRA algorithm is used
+	gcra *GCRA
+
+	// global 是所有键共享的全局层级，只有在配置了全局层级时才不为 nil
+	// global is the global tiers shared by all keys, it is not nil only when global tiers are configured
+	global *MultiLimiter
+
+	// queue 是等待模式下的等待队列
+	// queue is the wait queue in wait mode
+	queue *waitQueue
+
+	// bans 是被拒绝的键的封禁列表
+	// bans is the ban list of rejected keys
+	bans *banList
+
+	// done 是一个通道，关闭时停止定期快照
+	// done is a channel, periodic snapshots stop when it is closed
+	done chan struct{}
+
+	// wg 是一个等待组，用于等待定期快照的协程结束
+	// wg is a wait group used to wait for the goroutine of periodic snapshots to finish
+	wg sync.WaitGroup
 
 	// once 是一个 sync.Once 类型的变量，用于确保某些操作只执行一次
 	// once is a variable of type sync.Once, used to ensure that certain operations are performed only once
@@ -28,32 +54,83 @@ type IpRateLimiter struct {
 // NewIpRateLimiter 是一个函数，接收一个 Config 结构体的指针作为参数，返回一个新的 IpRateLimiter 结构体的指针
 // NewIpRateLimiter is a function that takes a pointer to the Config struct as a parameter and returns a new pointer to the IpRateLimiter struct
 func NewIpRateLimiter(config *Config) *IpRateLimiter {
-	// 返回一个新的 IpRateLimiter 结构体的指针
-	// Return a new pointer to the IpRateLimiter struct
-	return &IpRateLimiter{
-		// 初始化 cache 为一个新的 itl.Cache
-		// Initialize cache as a new itl.Cache
-		cache: itl.NewCache(),
+	// 检查 config 是否有效，如果有效则返回 config，否则返回默认配置
+	// Check if config is valid, if it is valid then return config, otherwise return the default configuration
+	config = isConfigValid(config)
 
-		// 检查 config 是否有效，如果有效则返回 config，否则返回默认配置
-		// Check if config is valid, if it is valid then return config, otherwise return the default configuration
-		config: isConfigValid(config),
+	// 创建一个新的 IpRateLimiter 结构体的指针
+	// Create a new pointer to the IpRateLimiter struct
+	rl := &IpRateLimiter{
+		// 初始化 cache 为一个新的 itl.Cache，使用配置的过期时间、扫描间隔和容量
+		// Initialize cache as a new itl.Cache with the expiration time, scan interval and capacity of the configuration
+		cache: itl.NewCacheWithOptions[Limiter](cacheOptions(config)),
+
+		// 设置配置
+		// Set configuration
+		config: newLiveConfig(config),
+
+		// 创建等待模式下的等待队列
+		// Create the wait queue in wait mode
+		queue: newWaitQueue(),
+
+		// 创建封禁列表
+		// Create the ban list
+		bans: newBanList(config),
+
+		// 创建停止定期快照的通道
+		// Create the channel that stops periodic snapshots
+		done: make(chan struct{}),
 
 		// 初始化 once 为一个新的 sync.Once
 		// Initialize once as a new sync.Once
 		once: sync.Once{},
 	}
+
+	// 如果使用 GCRA 算法，则所有的键共享同一组算法参数，缓存中只存储每个键的理论到达时间。配置了限额解析函数时每个键的参数不同，不能共享
+	// If the GCRA algorithm is used, all keys share the same algorithm parameters, and only the theoretical arrival time of each key is stored in the cache.
+	// When a limit resolver is configured, the parameters of each key differ and cannot be shared
+	if config.algorithm == AlgorithmGCRA && len(config.tiers) == 0 && len(config.globalTiers) == 0 && config.limitResolver == nil {
+		rl.gcra = NewGCRA(gr.Limit(config.rate), config.burst)
+	}
+
+	// 如果配置了全局层级，则所有键共享同一组全局层级
+	// If global tiers are configured, all keys share the same global tiers
+	if len(config.globalTiers) > 0 {
+		rl.global = newMultiLimiter(config.algorithm, config.globalTiers, nil)
+	}
+
+	// 如果配置了快照文件，则从文件恢复状态，并启动定期快照的协程。文件无法读取时通知 SnapshotErrorCallback，并从空的状态开始
+	// If a snapshot file is configured, restore the state from the file, and start the goroutine of periodic snapshots. When the file cannot be read, SnapshotErrorCallback is notified and the limiter starts from an empty state
+	if len(config.snapshotFile) > 0 {
+		if err := rl.RestoreFile(config.snapshotFile); err != nil {
+			notifyRestoreError(config, config.snapshotFile, err)
+		}
+		rl.wg.Add(1)
+		go rl.snapshotLoop(config.snapshotFile, config.snapshotInterval, rl.done)
+	}
+
+	// 返回新创建的 IpRateLimiter 结构体的指针
+	// Return the newly created pointer to the IpRateLimiter struct
+	return rl
+}
+
+// KeyedRateLimiter 是 IpRateLimiter 的别名，配合 Config 的键函数可以按任意键进行限流
+// KeyedRateLimiter is an alias of IpRateLimiter, which can limit by any key together with the key function of the Config
+type KeyedRateLimiter = IpRateLimiter
+
+// NewKeyedRateLimiter 是一个函数，接收一个 Config 结构体的指针作为参数，返回一个新的 KeyedRateLimiter 结构体的指针
+// NewKeyedRateLimiter is a function that takes a pointer to the Config struct as a parameter and returns a new pointer to the KeyedRateLimiter struct
+func NewKeyedRateLimiter(config *Config) *KeyedRateLimiter {
+	return NewIpRateLimiter(config)
 }
 
-// GetLimiter 方法用于根据键获取限流器
-// The GetLimiter method is used to get the rate limiter based on the key
-func (rl *IpRateLimiter) GetLimiter(key string) *rate.Limiter {
+// GetLimiter 方法用于根据键获取限流器，IP 地址形式的键按配置归并为网段
+// The GetLimiter method is used to get the rate limiter based on the key, IP address keys are aggregated to networks by the configuration
+func (rl *IpRateLimiter) GetLimiter(key string) Limiter {
 	// 从缓存中获取限流器
 	// Get the rate limiter from the cache
-	if rl, ok := rl.cache.Get(key); ok {
-		// 如果存在，则返回限流器
-		// If it exists, return the rate limiter
-		return rl.(*RateLimiter).GetLimiter()
+	if limiter, ok := rl.cache.Get(rl.config.Load().normalizeKey(key)); ok {
+		return limiter
 	}
 
 	// 如果不存在，则返回 nil
@@ -61,79 +138,174 @@ func (rl *IpRateLimiter) GetLimiter(key string) *rate.Limiter {
 	return nil
 }
 
-// Stop 方法用于停止 IP 限流器
-// The Stop method is used to stop the IP rate limiter
+// Stop 方法用于停止 IP 限流器，配置了快照文件时，停止前写入最后一次快照
+// The Stop method is used to stop the IP rate limiter, when a snapshot file is configured, the last snapshot is written before stopping
 func (rl *IpRateLimiter) Stop() {
 	// 使用 sync.Once 确保缓存只被停止一次
 	// Use sync.Once to ensure that the cache is stopped only once
 	rl.once.Do(func() {
-		// 停止缓存
-		// Stop the cache
+		// 停止定期快照，并写入最后一次快照，写入失败时通知 SnapshotErrorCallback
+		// Stop periodic snapshots, and write the last snapshot, SnapshotErrorCallback is notified when writing fails
+		close(rl.done)
+		rl.wg.Wait()
+		config := rl.config.Load()
+		if path := config.snapshotFile; len(path) > 0 {
+			if err := rl.SnapshotFile(path); err != nil {
+				notifySnapshotError(config, path, err)
+			}
+		}
+
+		// 停止缓存和封禁列表
+		// Stop the cache and the ban list
 		rl.cache.Stop()
+		rl.bans.stop()
 	})
 }
 
-// SetRate 方法用于设置限流器的速率
-// The SetRate method is used to set the rate of the rate limiter
+// SetRate 方法用于设置限流器的速率，已有的键和之后创建的键都使用新的速率。
+// 配置了 WithTiers 的层级时，层级的速率在创建时确定，不受影响；只配置了全局层级时，修改每个键由速率和突发组成的层级；配置了限额解析函数时，解析出速率的键不受影响
+// The SetRate method is used to set the rate of the rate limiter, both existing keys and keys created afterwards use the new rate.
+// When the tiers of WithTiers are configured, their rates are fixed at creation and are not affected; when only global tiers are configured, the tier of each key made of the rate and burst is changed; when a limit resolver is configured, keys with a resolved rate are not affected
 func (rl *IpRateLimiter) SetRate(rate float64) {
-	// 获取缓存的所有段
-	// Get all segments of the cache
-	segments := rl.cache.Segments()
-
-	// 遍历所有段
-	// Traverse all segments
-	for i := 0; i < itl.SegmentSize; i++ {
-		// 获取当前段的数据
-		// Get the data of the current segment
-		data := segments[i].GetData()
-
-		// 遍历当前段的所有数据
-		// Traverse all data of the current segment
-		for key, value := range data {
-			// 获取当前数据的限流器
-			// Get the rate limiter of the current data
-			limiter := value.(*RateLimiter)
-
-			// 设置限流器的速率
-			// Set the rate of the rate limiter
-			limiter.SetRate(rate)
-
-			// 更新当前数据的限流器
-			// Update the rate limiter of the current data
-			data[key] = limiter
-		}
-	}
+	rl.config.Update(func(config *Config) {
+		// 设置配置的速率
+		// Set the rate of the configuration
+		config.rate = rate
+	}, func(config *Config) {
+		// 设置所有已有的限流器的速率
+		// Set the rate of all existing rate limiters
+		rl.eachLimits(config, func(limiter Limiter, limits Limits) {
+			limiter.SetLimit(gr.Limit(limits.Rate))
+		})
+	})
 }
 
-// SetBurst 方法用于设置限流器的突发流量
-// The SetBurst method is used to set the burst traffic of the rate limiter
+// SetBurst 方法用于设置限流器的突发流量，已有的键和之后创建的键都使用新的突发流量。
+// 配置了 WithTiers 的层级时，层级的突发在创建时确定，不受影响；只配置了全局层级时，修改每个键由速率和突发组成的层级；配置了限额解析函数时，解析出突发的键不受影响
+// The SetBurst method is used to set the burst traffic of the rate limiter, both existing keys and keys created afterwards use the new burst traffic.
+// When the tiers of WithTiers are configured, their bursts are fixed at creation and are not affected; when only global tiers are configured, the tier of each key made of the rate and burst is changed; when a limit resolver is configured, keys with a resolved burst are not affected
 func (rl *IpRateLimiter) SetBurst(burst int) {
-	// 获取缓存的所有段
-	// Get all segments of the cache
-	segments := rl.cache.Segments()
-
-	// 遍历所有段
-	// Traverse all segments
-	for i := 0; i < itl.SegmentSize; i++ {
-		// 获取当前段的数据
-		// Get the data of the current segment
-		data := segments[i].GetData()
-
-		// 遍历当前段的所有数据
-		// Traverse all data of the current segment
-		for key, value := range data {
-			// 获取当前数据的限流器
-			// Get the rate limiter of the current data
-			limiter := value.(*RateLimiter)
-
-			// 设置限流器的突发流量
-			// Set the burst traffic of the rate limiter
-			limiter.SetBurst(burst)
-
-			// 更新当前数据的限流器
-			// Update the rate limiter of the current data
-			data[key] = limiter
-		}
+	rl.config.Update(func(config *Config) {
+		// 设置配置的突发流量
+		// Set the burst traffic of the configuration
+		config.burst = burst
+	}, func(config *Config) {
+		// 设置所有已有的限流器的突发流量
+		// Set the burst traffic of all existing rate limiters
+		rl.eachLimits(config, func(limiter Limiter, limits Limits) {
+			limiter.SetBurst(limits.Burst)
+		})
+	})
+}
+
+// RefreshLimits 方法使用限额解析函数重新解析键的速率和突发，并应用到键已有的限流器，例如在客户的套餐变化之后。
+// 限流器中已有的令牌被保留，键没有限流器时什么也不做。使用 CachedLimitResolver 时需要先调用它的 Invalidate 方法
+// The RefreshLimits method resolves the rate and burst of the key again with the limit resolver and applies them to the existing rate limiter of the key, such as after the plan of the customer changes.
+// The tokens already in the rate limiter are kept, nothing is done when the key has no rate limiter. When CachedLimitResolver is used, its Invalidate method must be called first
+func (rl *IpRateLimiter) RefreshLimits(key string) {
+	config := rl.config.Load()
+	key = config.normalizeKey(key)
+	if limiter, ok := rl.cache.Get(key); ok {
+		limits := config.limitsOf(key, newResolveRequest())
+		limiter.SetLimit(gr.Limit(limits.Rate))
+		limiter.SetBurst(limits.Burst)
+	}
+}
+
+// AddIp 方法向 IP 白名单添加 IP 地址和 CIDR 网段，无法解析的项被忽略，之后的请求立即生效
+// The AddIp method adds IP addresses and CIDR networks to the IP whitelist, items that cannot be parsed are ignored, and it takes effect immediately for later requests
+func (rl *IpRateLimiter) AddIp(ips ...string) {
+	rl.config.Load().ipWhitelist.Add(ips...)
+}
+
+// RemoveIp 方法从 IP 白名单删除之前添加的 IP 地址和 CIDR 网段
+// The RemoveIp method removes IP addresses and CIDR networks added before from the IP whitelist
+func (rl *IpRateLimiter) RemoveIp(ips ...string) {
+	rl.config.Load().ipWhitelist.Remove(ips...)
+}
+
+// ReplaceIpList 方法使用指定的 IP 地址和 CIDR 网段替换 IP 白名单
+// The ReplaceIpList method replaces the IP whitelist with the specified IP addresses and CIDR networks
+func (rl *IpRateLimiter) ReplaceIpList(ips []string) {
+	rl.config.Load().ipWhitelist.Replace(ips)
+}
+
+// SetIpWhitelist 方法用于替换 IP 白名单，与 ReplaceIpList 相同
+// The SetIpWhitelist method is used to replace the IP whitelist, it is the same as ReplaceIpList
+func (rl *IpRateLimiter) SetIpWhitelist(whitelist []string) {
+	rl.ReplaceIpList(whitelist)
+}
+
+// SetMatchFunc 方法用于替换匹配函数，为 nil 时使用默认的匹配函数
+// The SetMatchFunc method is used to replace the match function, the default match function is used when it is nil
+func (rl *IpRateLimiter) SetMatchFunc(fn com.HttpRequestHeaderMatchFunc) {
+	rl.config.Update(func(config *Config) {
+		// 设置配置的匹配函数
+		// Set the match function of the configuration
+		config.matchFunc = fn
+	}, nil)
+}
+
+// Ban 方法将键封禁 d 时间，d 小于等于 0 时使用配置的封禁时间，并返回封禁。被封禁的键的请求在检查限流器之前就被拒绝，
+// IP 地址形式的键按配置归并为网段，所以封禁一个 IPv6 地址会封禁它所在的网段
+// The Ban method bans the key for d, the ban duration of the configuration is used when d is less than or equal to 0, and returns the ban. Requests of a banned key are rejected before the rate limiter is checked,
+// IP address keys are aggregated to networks by the configuration, so banning an IPv6 address bans its network
+func (rl *IpRateLimiter) Ban(key string, d time.Duration) Ban {
+	config := rl.config.Load()
+	ban := rl.bans.ban(config.normalizeKey(key), config, d, time.Now())
+	notifyBanned(config, ban)
+	return *ban
+}
+
+// Unban 方法解封键，并清除键被拒绝和被封禁的次数，返回键之前是否被封禁
+// The Unban method unbans the key and clears the rejections and the ban count of the key, and returns whether the key was banned
+func (rl *IpRateLimiter) Unban(key string) bool {
+	config := rl.config.Load()
+	key = config.normalizeKey(key)
+	if !rl.bans.unban(key, time.Now()) {
+		return false
+	}
+	notifyUnbanned(config, key)
+	return true
+}
+
+// ListBans 方法返回当前所有被封禁的键的封禁，按键排序
+// The ListBans method returns the bans of all currently banned keys, sorted by key
+func (rl *IpRateLimiter) ListBans() []Ban {
+	return rl.bans.list(time.Now())
+}
+
+// eachLimits 方法对每个已有的限流器和它的键在配置 config 下的速率和突发调用 fn。使用共享参数的 GCRA 算法时，只需要调用一次。
+// 配置了限额解析函数时，先在段锁内收集键，再在锁外解析限额，所以较慢的解析不会阻塞请求
+// The eachLimits method calls fn for each existing rate limiter and the rate and burst of its key under the configuration config. When the GCRA algorithm with shared parameters is used, fn only needs to be called once.
+// When a limit resolver is configured, the keys are collected within the segment locks first and the limits are resolved outside the locks, so slow resolving does not block requests
+func (rl *IpRateLimiter) eachLimits(config *Config, fn func(limiter Limiter, limits Limits)) {
+	if rl.gcra != nil {
+		fn(&GCRALimiter{gcra: rl.gcra}, config.limits())
+		return
+	}
+
+	// 没有限额解析函数时所有键的限额相同，直接在段锁内设置
+	// Without a limit resolver all keys have the same limits, set them within the segment locks directly
+	if config.limitResolver == nil {
+		limits := config.limits()
+		rl.cache.Range(func(_ string, limiter Limiter) bool {
+			fn(limiter, limits)
+			return true
+		})
+		return
+	}
+
+	// 收集键和限流器，在锁外解析每个键的限额
+	// Collect the keys and rate limiters, and resolve the limits of each key outside the locks
+	keys, limiters := []string{}, []Limiter{}
+	rl.cache.Range(func(key string, limiter Limiter) bool {
+		keys, limiters = append(keys, key), append(limiters, limiter)
+		return true
+	})
+	r := newResolveRequest()
+	for i, key := range keys {
+		fn(limiters[i], config.limitsOf(key, r))
 	}
 }
 
@@ -144,59 +316,136 @@ func (rl *IpRateLimiter) HandlerFunc() gin.HandlerFunc {
 	// 返回一个闭包函数，该函数接收一个 gin.Context 参数，用于处理 HTTP 请求
 	// Returns a closure function that takes a gin.Context parameter to handle HTTP requests
 	return func(ctx *gin.Context) {
+		// 加载当前的配置，整个请求使用同一份配置
+		// Load the current configuration, the whole request uses the same configuration
+		config := rl.config.Load()
+
+		// 做出限流决策，并根据决策放行或者拒绝请求
+		// Make the rate limiting decision, and allow or reject the request according to it
+		applyDecision(ctx, config, rl.decide(ctx, config))
+	}
+}
+
+// decide 方法为请求做出限流决策
+// The decide method makes the rate limiting decision for the request
+func (rl *IpRateLimiter) decide(ctx *gin.Context, config *Config) *Decision {
+	// 如果请求不匹配配置的匹配函数，则不进行限流
+	// If the request does not match the match function in the configuration, do not limit
+	if !config.matchFunc(ctx.Request) {
+		return &Decision{Allowed: true, Skipped: true, Rule: config.rule}
+	}
+
+	// 如果客户端 IP 地址在配置的 IP 白名单中，则不进行限流
+	// If the client IP address is in the IP whitelist in the configuration, do not limit
+	if config.ipWhitelist.ContainsString(config.clientIP(ctx)) {
+		return &Decision{Allowed: true, Whitelisted: true, Rule: config.rule}
+	}
 
-		// 如果请求匹配配置的匹配函数，则进行下一步处理
-		// If the request matches the match function in the configuration, then proceed to the next step
-		if rl.config.matchFunc(ctx.Request) {
-
-			// 获取客户端 IP 地址
-			// Get the client IP address
-			clientIP := ctx.ClientIP()
-
-			// 如果客户端 IP 地址不在配置的 IP 白名单中，则进行下一步处理
-			// If the client IP address is not in the IP whitelist in the configuration, then proceed to the next step
-			if _, ok := rl.config.ipWhitelist[clientIP]; !ok {
-
-				// 从缓存中获取或创建一个限流器
-				// Get or create a rate limiter from the cache
-				limiter, _ := rl.cache.GetOrCreate(clientIP, func() any {
-					// 从元素池中获取一个元素，并设置其值为一个新的限流器
-					// Get an element from the element pool and set its value to a new rate limiter
-					element := itl.ElementPool.Get()
-
-					// 将元素的值设置为一个新的限流器，该限流器的配置为 rl.config
-					// Set the value of the element to a new rate limiter, the configuration of this rate limiter is rl.config
-					element.(*itl.Element).SetValue(NewRateLimiter(rl.config))
-
-					// 返回元素，该元素将被添加到缓存中
-					// Return the element, this element will be added to the cache
-					return element
-				})
-
-				// 如果限流器不允许新的请求，则中止请求处理，并返回 429 错误
-				// If the rate limiter does not allow new requests, abort the request processing and return a 429 error
-				if !limiter.(*itl.Element).GetValue().(*RateLimiter).GetLimiter().Allow() {
-					// 中止请求处理
-					// Abort the request processing
-					ctx.Abort()
-
-					// 返回 429 错误
-					// Return a 429 error
-					ctx.String(http.StatusTooManyRequests, "[429] too many http requests, ip:"+clientIP+", method: "+ctx.Request.Method+", path: "+ctx.Request.URL.Path)
-
-					// 调用回调函数，处理被限制的请求
-					// Call the callback function to handle the limited request
-					rl.config.callback.OnLimited(ctx.Request)
-
-					// 返回，不再执行后续代码
-					// Return, no further code is executed
-					return
-				}
+	// 使用配置的键函数获取限流的键，没有键的请求按配置的方式处理
+	// Use the key function in the configuration to get the rate limiting key, a request without a key is handled by the configured policy
+	key, ok := config.keyFunc(ctx)
+	if !ok {
+		switch config.missingKey {
+		case MissingKeySkip:
+			return &Decision{Allowed: true, Skipped: true, MissingKey: true, Rule: config.rule}
+		case MissingKeyReject:
+			return &Decision{MissingKey: true, Rule: config.rule}
+		default:
+			// 使用客户端 IP 地址作为键，没有客户端 IP 地址时不进行限流
+			// Use the client IP address as the key, do not limit when there is no client IP address
+			if key, ok = clientIPKeyFunc(ctx); !ok {
+				return &Decision{Allowed: true, Skipped: true, MissingKey: true, Rule: config.rule}
 			}
 		}
+	}
+
+	// 将 IP 地址形式的键归并为网段，使同一个网段中轮换的地址共用一个桶
+	// Aggregate IP address keys to networks, so that addresses rotating within the same network share one bucket
+	key = config.normalizeKey(key)
+
+	// 如果键被封禁，则直接拒绝请求，不检查限流器
+	// If the key is banned, reject the request directly without checking the rate limiter
+	now := time.Now()
+	cost := costOf(config, ctx.Request)
+	if retryAfter, banned := rl.bans.banned(key, now); banned {
+		decision := &Decision{Banned: true, Key: key, Rule: config.rule, Reset: retryAfter, RetryAfter: retryAfter, Cost: cost}
+		writeHeaders(ctx, config.headerStyle, decision, now)
+		return decision
+	}
+
+	// 获取键对应的限流器，判断是否允许新的请求，并根据限流器的状态生成决策，如果配置了存储，则由存储做出决策。
+	// 在决策完成之前一直持有限流器，所以它不会过期或被淘汰，并发的请求也不会为同一个键创建另一个限流器
+	// Get the rate limiter of the key, check whether it allows new requests, and generate a decision based on its state, if a store is configured, the store makes the decision.
+	// The rate limiter is held until the decision is made, so it neither expires nor is evicted, and concurrent requests do not create another rate limiter for the same key
+	var limiter Limiter
+	var limits Limits
+	var decision *Decision
+	if config.store != nil {
+		limits = config.limitsOf(key, ctx.Request)
+		decision = takeFromStore(ctx, config, key, limits, cost)
+	} else {
+		var handle itl.Handle[Limiter]
+		limiter, handle = rl.acquire(key, ctx.Request)
+		defer handle.Release()
+		allowed := limiter.AllowN(now, cost)
+		decision = newDecision(limiter, now, cost, allowed)
+	}
+
+	// 如果请求被拒绝并且开启了等待模式，则在键的等待队列中排队等待令牌，存储返回错误时不等待
+	// If the request is rejected and wait mode is enabled, queue up in the wait queue of the key and wait for a token, do not wait when the store returns an error
+	if !decision.Allowed && decision.StoreError == nil && config.maxWait > 0 && !config.shadow {
+		decision = waitDecision(ctx, config, rl.queue, key, limits, limiter, now, cost, decision)
+		now = time.Now()
+	}
+	decision.Key, decision.Rule = key, config.rule
+
+	// 如果请求被拒绝并且开启了自动封禁，则记录一次拒绝，次数达到阈值时封禁键。因为存储返回错误而被拒绝的请求不计入
+	// If the request is rejected and automatic banning is enabled, record a rejection, and ban the key when the rejections reach the threshold. Requests rejected because the store returned an error are not counted
+	if !decision.Allowed && decision.StoreError == nil && config.banThreshold > 0 {
+		if ban := rl.bans.reject(key, config, now); ban != nil {
+			notifyBanned(config, ban)
+		}
+	}
+
+	// 将决策写入限流响应头
+	// Write the decision to the rate limiting response headers
+	writeHeaders(ctx, config.headerStyle, decision, now)
+
+	return decision
+}
+
+// acquire 方法从缓存中获取或创建键对应的限流器，并返回一个句柄，使用完限流器之后需要释放句柄。r 是创建限流器时传给限额解析函数的请求
+// The acquire method gets or creates the rate limiter of the key from the cache and returns a handle, which must be released after the rate limiter is no longer used. r is the request passed to the limit resolver when creating the rate limiter
+func (rl *IpRateLimiter) acquire(key string, r *http.Request) (Limiter, itl.Handle[Limiter]) {
+	return rl.cache.Acquire(key, func() Limiter {
+		return rl.newLimiter(key, r)
+	})
+}
+
+// newLimiter 方法创建键的新的限流器，在缓存的段锁内调用
+// The newLimiter method creates a new rate limiter of the key, it is called within the segment lock of the cache
+func (rl *IpRateLimiter) newLimiter(key string, r *http.Request) Limiter {
+	// 如果使用 GCRA 算法，则每个键只有一个理论到达时间，并共享同一组算法参数，不需要解析限额
+	// If the GCRA algorithm is used, each key only has a theoretical arrival time and shares the same algorithm parameters, there is no need to resolve the limits
+	if rl.gcra != nil {
+		return &GCRALimiter{gcra: rl.gcra}
+	}
+
+	// 创建一个新的限流器，创建在段锁内进行，并使用此时的配置，所以不会错过并发的配置修改。
+	// 如果配置了限额解析函数，则速率和突发由它解析
+	// Create a new rate limiter, the creation happens within the segment lock and uses the configuration at this moment, so it does not miss concurrent configuration changes.
+	// The rate and burst come from the limit resolver if it is configured
+	config := rl.config.Load()
+	return rl.newConfigLimiter(config, config.limitsOf(key, r))
+}
 
-		// 执行后续的请求处理
-		// Execute subsequent request processing
-		ctx.Next()
+// newConfigLimiter 方法使用配置 config 和键的速率和突发创建一个新的限流器。
+// 使用 GCRA 算法时只有一个理论到达时间，创建只需要一次内存分配；配置了层级时，由键的层级和共享的全局层级组成
+// The newConfigLimiter method creates a new rate limiter with the configuration config and the rate and burst of the key.
+// When the GCRA algorithm is used there is only a theoretical arrival time, and the creation needs only one allocation; when tiers are configured, it is composed of the tiers of the key and the shared global tiers
+func (rl *IpRateLimiter) newConfigLimiter(config *Config, limits Limits) Limiter {
+	if rl.gcra != nil {
+		return &GCRALimiter{gcra: rl.gcra}
 	}
+	return newConfigLimiter(config, limits, config.tiers, rl.global)
 }
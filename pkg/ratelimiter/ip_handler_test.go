@@ -2,7 +2,11 @@ package ratelimiter
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	com "github.com/shengyanli1982/orbit-contrib/internal/common"
@@ -19,7 +23,7 @@ func TestIpRateLimiter_GetLimiter(t *testing.T) {
 	// Test case 1: Limiter exists in cache
 	key := com.TestIpAddress
 	limiter := rate.NewLimiter(rate.Limit(10), 100)
-	rl.cache.Set(key, &RateLimiter{config: conf, limiter: limiter})
+	rl.cache.Set(key, limiter)
 
 	result := rl.GetLimiter(key)
 	assert.NotNil(t, result)
@@ -40,7 +44,7 @@ func TestIpRateLimiter_SetRate(t *testing.T) {
 	// Set up test data
 	key1 := com.TestIpAddress
 	limiter := rate.NewLimiter(rate.Limit(10), 100)
-	rl.cache.Set(key1, &RateLimiter{config: conf, limiter: limiter})
+	rl.cache.Set(key1, limiter)
 
 	// Set rate for all limiters
 	rate := float64(10)
@@ -60,7 +64,7 @@ func TestIpRateLimiter_SetBurst(t *testing.T) {
 	// Set up test data
 	key1 := com.TestIpAddress
 	limiter := rate.NewLimiter(rate.Limit(10), 100)
-	rl.cache.Set(key1, &RateLimiter{config: conf, limiter: limiter})
+	rl.cache.Set(key1, limiter)
 
 	// Set rate for all limiters
 	burst := 10
@@ -196,3 +200,279 @@ func TestIpRateLimiter_IpWhitelistWithOther(t *testing.T) {
 		testWhitelistRequestFunc(t, i, router, com.TestEndpoint, com.TestUrlPath)
 	}
 }
+
+func TestIpRateLimiter_KeyFunc(t *testing.T) {
+	// Create a new rate limiter which limits by the api key header
+	conf := NewConfig().WithRate(2).WithBurst(5).WithKeyFunc(KeyByHeader("X-Api-Key"))
+	limiter := NewKeyedRateLimiter(conf)
+	defer limiter.Stop()
+
+	// Create a test context
+	router := gin.New()
+	router.Use(limiter.HandlerFunc())
+	router.GET(com.TestUrlPath, func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+
+	// Send multiple requests with different api keys from the same endpoint
+	for _, apiKey := range []string{"key1", "key2"} {
+		for i := 0; i < 10; i++ {
+			req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+			req.RemoteAddr = com.TestEndpoint2
+			req.Header.Set("X-Api-Key", apiKey)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if i < conf.burst {
+				assert.Equal(t, http.StatusOK, resp.Code)
+			} else {
+				assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+			}
+		}
+	}
+
+	// Requests without the api key are limited by the client IP address
+	for i := 0; i < 10; i++ {
+		testRequestFunc(t, i, router, conf, com.TestEndpoint2, com.TestUrlPath)
+	}
+}
+
+func TestIpRateLimiter_Reconfigure(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmGCRA} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			limiter := NewIpRateLimiter(NewConfig().WithRate(1).WithBurst(2).WithAlgorithm(algorithm))
+			defer limiter.Stop()
+			router := testHeadersRouter(limiter.HandlerFunc())
+
+			// Create the bucket of an existing key
+			assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.4.1:80"))
+
+			limiter.SetRate(5)
+			limiter.SetBurst(4)
+
+			// Both the existing key and a new key use the new rate and burst
+			assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.4.2:80"))
+			for _, ip := range []string{"10.0.4.1", "10.0.4.2"} {
+				l := limiter.GetLimiter(ip)
+				assert.Equal(t, rate.Limit(5), l.Limit(), ip)
+				assert.Equal(t, 4, l.Burst(), ip)
+			}
+			assert.Equal(t, float64(5), limiter.config.Load().rate)
+			assert.Equal(t, 4, limiter.config.Load().burst)
+
+			// Invalid values fall back to the defaults
+			limiter.SetBurst(0)
+			assert.Equal(t, DefaultLimitBurst, limiter.GetLimiter("10.0.4.1").Burst())
+		})
+	}
+}
+
+func TestIpRateLimiter_SetIpWhitelist(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithBurst(1))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.1.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.0.1.1:80"))
+
+	// The whitelisted address is no longer limited
+	limiter.SetIpWhitelist([]string{"10.0.1.1"})
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.1.1:80"))
+
+	// The whitelist is replaced, not extended
+	limiter.SetIpWhitelist([]string{"10.0.1.2"})
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.0.1.1:80"))
+}
+
+func TestIpRateLimiter_IpWhitelistCIDR(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithBurst(1))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// Networks are whitelisted as a whole, and IPv4-mapped addresses match their IPv4 form
+	limiter.SetIpWhitelist([]string{"10.30.0.0/16", "2001:db8:30::/48"})
+	for _, ep := range []string{"10.30.1.1:80", "10.30.255.2:80", "[::ffff:10.30.0.1]:80", "[2001:db8:30:1::1]:80"} {
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, ep), ep)
+		}
+	}
+
+	// Addresses outside the networks are limited
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.31.0.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.31.0.1:80"))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:31::1]:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:31::1]:80"))
+}
+
+func TestIpRateLimiter_IpWhitelistPerConfig(t *testing.T) {
+	// Whitelisting an address in one configuration does not whitelist it in another
+	whitelisted := NewIpRateLimiter(NewConfig().WithBurst(1).WithIpWhitelist([]string{"10.32.0.1"}))
+	defer whitelisted.Stop()
+	limited := NewIpRateLimiter(NewConfig().WithBurst(1))
+	defer limited.Stop()
+
+	router := testHeadersRouter(whitelisted.HandlerFunc())
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.0.1:80"))
+	}
+	router = testHeadersRouter(limited.HandlerFunc())
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.0.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.32.0.1:80"))
+}
+
+func TestIpRateLimiter_AddRemoveIp(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithBurst(1))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// Added networks are whitelisted for later requests
+	limiter.AddIp("10.32.1.0/24", "10.32.2.1")
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.1.1:80"))
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.2.1:80"))
+	}
+
+	// Removed networks are limited again
+	limiter.RemoveIp("10.32.1.0/24")
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.1.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.32.1.1:80"))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.2.1:80"))
+
+	// Replacing the list drops the old items
+	limiter.ReplaceIpList([]string{"10.32.3.1"})
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.2.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.32.2.1:80"))
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.32.3.1:80"))
+	}
+}
+
+func TestIpRateLimiter_IpListConcurrently(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithBurst(1))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// Send requests while the whitelist changes, run with -race to check the data races
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				testDecisionRequest(router, com.TestUrlPath, "10.33."+strconv.Itoa(i)+"."+strconv.Itoa(j)+":80")
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ip := "10.33." + strconv.Itoa(i) + "." + strconv.Itoa(j)
+				limiter.AddIp(ip)
+				limiter.RemoveIp(ip)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestIpRateLimiter_SetMatchFunc(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithBurst(1))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.2.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.0.2.1:80"))
+
+	// Requests not matching the new match function are not limited
+	limiter.SetMatchFunc(func(r *http.Request) bool { return false })
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.0.2.1:80"))
+
+	// A nil match function restores the default one
+	limiter.SetMatchFunc(nil)
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.0.2.1:80"))
+}
+
+func TestIpRateLimiter_ReconfigureConcurrently(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRate(1).WithBurst(1))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// Send requests from many addresses while the configuration changes, run with -race to check the data races
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				testDecisionRequest(router, com.TestUrlPath, "10.1."+strconv.Itoa(i)+"."+strconv.Itoa(j)+":80")
+			}
+		}(i)
+	}
+	for i := 1; i <= 50; i++ {
+		limiter.SetRate(float64(i))
+		limiter.SetBurst(i)
+		limiter.SetIpWhitelist([]string{"10.1.0." + strconv.Itoa(i)})
+		limiter.SetMatchFunc(com.DefaultLimitMatchFunc)
+	}
+	wg.Wait()
+
+	// Every bucket, whenever it was created, ends up with the last rate and burst
+	count := 0
+	limiter.cache.Range(func(key string, l Limiter) bool {
+		assert.Equal(t, rate.Limit(50), l.Limit(), key)
+		assert.Equal(t, 50, l.Burst(), key)
+		count++
+		return true
+	})
+	assert.NotZero(t, count)
+}
+
+func TestIpRateLimiter_CacheCapacity(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithCacheCapacity(64))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// Spraying many addresses does not grow the cache beyond the capacity
+	for i := 0; i < 2000; i++ {
+		testDecisionRequest(router, com.TestUrlPath, "10.2."+strconv.Itoa(i/250)+"."+strconv.Itoa(i%250)+":80")
+	}
+	assert.LessOrEqual(t, limiter.cache.Len(), limiter.cache.Capacity())
+
+	// The most recent address is still tracked
+	assert.NotNil(t, limiter.GetLimiter("10.2.7.249"))
+}
+
+func TestIpRateLimiter_CacheTTL(t *testing.T) {
+	conf := NewConfig().WithBurst(1).WithCacheTTL(20 * time.Millisecond).WithCacheScanInterval(5 * time.Millisecond)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.3.0.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.3.0.1:80"))
+
+	// The idle key expires and starts again from a full bucket
+	assert.Eventually(t, func() bool { return limiter.cache.Len() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.3.0.1:80"))
+}
+
+func TestIpRateLimiter_CacheExpireConcurrently(t *testing.T) {
+	conf := NewConfig().WithRate(1).WithBurst(5).WithCacheTTL(time.Millisecond).WithCacheScanInterval(time.Millisecond).WithCacheCapacity(4)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+
+	// Requests of many clients race with the expiration and eviction of their rate limiters
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			router := testHeadersRouter(limiter.HandlerFunc())
+			for j := 0; j < 200; j++ {
+				ip := "10.5.0." + strconv.Itoa((i+j)%8)
+				code := testDecisionRequest(router, com.TestUrlPath, ip+":80")
+				assert.Contains(t, []int{http.StatusOK, http.StatusTooManyRequests}, code)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
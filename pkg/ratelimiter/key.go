@@ -0,0 +1,139 @@
+package ratelimiter
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCompositeKeySeparator 是组合键各部分之间的分隔符
+// DefaultCompositeKeySeparator is the separator between the parts of a composite key
+var DefaultCompositeKeySeparator = "|"
+
+// MissingKeyPolicy 是键函数没有找到键时的处理方式
+// MissingKeyPolicy is how a request is handled when the key function finds no key
+type MissingKeyPolicy int8
+
+const (
+	// MissingKeyClientIP 表示使用客户端 IP 地址作为键，所以客户端不能通过省略请求头、查询参数或者 Cookie 绕过限流
+	// MissingKeyClientIP means the client IP address is used as the key, so clients cannot bypass the limit by leaving out the header, query parameter or cookie
+	MissingKeyClientIP MissingKeyPolicy = iota
+
+	// MissingKeySkip 表示不限流请求
+	// MissingKeySkip means the request is not limited
+	MissingKeySkip
+
+	// MissingKeyReject 表示拒绝请求
+	// MissingKeyReject means the request is rejected
+	MissingKeyReject
+)
+
+// DefaultMissingKeyPolicy 是默认的键函数没有找到键时的处理方式
+// DefaultMissingKeyPolicy is the default way a request is handled when the key function finds no key
+var DefaultMissingKeyPolicy = MissingKeyClientIP
+
+// clientIPKeyFunc 是没有找到键时使用的以客户端 IP 地址作为键的键函数
+// clientIPKeyFunc is the key function using the client IP address as the key when no key is found
+var clientIPKeyFunc = KeyByClientIP()
+
+// ClientIPContextKey 是配置了 IP 解析器时，解析出的客户端 IP 地址保存在 gin.Context 中的键
+// ClientIPContextKey is the key under which the resolved client IP address is saved in the gin.Context when an IP resolver is configured
+const ClientIPContextKey = "ratelimiter.client_ip"
+
+// KeyByClientIP 返回一个以客户端 IP 地址作为键的键函数，配置了 IP 解析器时使用解析出的地址
+// KeyByClientIP returns a key function that uses the client IP address as the key, the resolved address is used when an IP resolver is configured
+func KeyByClientIP() KeyFunc {
+	return func(ctx *gin.Context) (string, bool) {
+		// 优先使用解析器解析出的地址
+		// Prefer the address resolved by the resolver
+		if value, ok := ctx.Get(ClientIPContextKey); ok {
+			ip, _ := value.(string)
+			return ip, len(ip) > 0
+		}
+
+		// 获取客户端 IP 地址，如果为空则不进行限流
+		// Get the client IP address, if it is empty, do not limit
+		ip := ctx.ClientIP()
+		return ip, len(ip) > 0
+	}
+}
+
+// KeyByHeader 返回一个以指定请求头的值作为键的键函数，请求头不存在时没有键，按配置的 MissingKeyPolicy 处理
+// KeyByHeader returns a key function that uses the value of the specified request header as the key, there is no key if the header is missing, which is handled by the configured MissingKeyPolicy
+func KeyByHeader(name string) KeyFunc {
+	return func(ctx *gin.Context) (string, bool) {
+		// 获取请求头的值
+		// Get the value of the request header
+		value := ctx.GetHeader(name)
+		return value, len(value) > 0
+	}
+}
+
+// KeyByQuery 返回一个以指定查询参数的值作为键的键函数，查询参数不存在时没有键，按配置的 MissingKeyPolicy 处理
+// KeyByQuery returns a key function that uses the value of the specified query parameter as the key, there is no key if the parameter is missing, which is handled by the configured MissingKeyPolicy
+func KeyByQuery(name string) KeyFunc {
+	return func(ctx *gin.Context) (string, bool) {
+		// 获取查询参数的值
+		// Get the value of the query parameter
+		value := ctx.Query(name)
+		return value, len(value) > 0
+	}
+}
+
+// KeyByCookie 返回一个以指定 Cookie 的值作为键的键函数，Cookie 不存在时没有键，按配置的 MissingKeyPolicy 处理
+// KeyByCookie returns a key function that uses the value of the specified cookie as the key, there is no key if the cookie is missing, which is handled by the configured MissingKeyPolicy
+func KeyByCookie(name string) KeyFunc {
+	return func(ctx *gin.Context) (string, bool) {
+		// 获取 Cookie 的值
+		// Get the value of the cookie
+		value, err := ctx.Cookie(name)
+		if err != nil || len(value) == 0 {
+			return "", false
+		}
+		return value, true
+	}
+}
+
+// KeyByRoute 返回一个以请求方法和路由模板 (例如 "GET /users/:id") 作为键的键函数，未匹配到路由时不进行限流
+// KeyByRoute returns a key function that uses the request method and the route template (e.g. "GET /users/:id") as the key, the request is not limited if no route is matched
+func KeyByRoute() KeyFunc {
+	return func(ctx *gin.Context) (string, bool) {
+		// 获取匹配到的路由模板
+		// Get the matched route template
+		route := ctx.FullPath()
+		if len(route) == 0 {
+			return "", false
+		}
+		return ctx.Request.Method + " " + route, true
+	}
+}
+
+// KeyByComposite 返回一个组合多个键函数的键函数，各部分使用 DefaultCompositeKeySeparator 连接，任意一个键函数不匹配时没有键。
+// 各部分中的分隔符和反斜杠使用反斜杠转义，所以不同的部分不会拼接出相同的键
+// KeyByComposite returns a key function that combines multiple key functions, the parts are joined with DefaultCompositeKeySeparator, there is no key if any key function does not match.
+// Separators and backslashes within the parts are escaped with a backslash, so different parts never join into the same key
+func KeyByComposite(fns ...KeyFunc) KeyFunc {
+	separator := DefaultCompositeKeySeparator
+	escaper := strings.NewReplacer(`\`, `\\`, separator, `\`+separator)
+
+	return func(ctx *gin.Context) (string, bool) {
+		// 如果没有键函数，则不进行限流
+		// If there is no key function, do not limit
+		if len(fns) == 0 {
+			return "", false
+		}
+
+		// 依次调用每个键函数，拼接得到的键
+		// Call each key function in turn and join the keys
+		parts := make([]string, 0, len(fns))
+		for _, fn := range fns {
+			key, ok := fn(ctx)
+			if !ok {
+				return "", false
+			}
+			parts = append(parts, escaper.Replace(key))
+		}
+
+		return strings.Join(parts, separator), true
+	}
+}
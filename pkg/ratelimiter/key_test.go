@@ -0,0 +1,260 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeyFunc(fn KeyFunc, req *http.Request) (string, bool) {
+	var key string
+	var ok bool
+
+	// Create a test router that records the key of the request
+	router := gin.New()
+	router.GET("/users/:id", func(c *gin.Context) {
+		key, ok = fn(c)
+		c.String(http.StatusOK, "OK")
+	})
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	return key, ok
+}
+
+func TestKeyFunc_ClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.RemoteAddr = com.TestEndpoint
+
+	key, ok := testKeyFunc(KeyByClientIP(), req)
+	assert.True(t, ok)
+	assert.Equal(t, com.TestIpAddress, key)
+}
+
+func TestKeyFunc_Header(t *testing.T) {
+	fn := KeyByHeader("X-Api-Key")
+
+	// Test case 1: Header exists
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("X-Api-Key", "key1")
+	key, ok := testKeyFunc(fn, req)
+	assert.True(t, ok)
+	assert.Equal(t, "key1", key)
+
+	// Test case 2: Header does not exist
+	req = httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	_, ok = testKeyFunc(fn, req)
+	assert.False(t, ok)
+}
+
+func TestKeyFunc_Query(t *testing.T) {
+	fn := KeyByQuery("tenant")
+
+	// Test case 1: Query parameter exists
+	req := httptest.NewRequest(http.MethodGet, "/users/1?tenant=t1", nil)
+	key, ok := testKeyFunc(fn, req)
+	assert.True(t, ok)
+	assert.Equal(t, "t1", key)
+
+	// Test case 2: Query parameter does not exist
+	req = httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	_, ok = testKeyFunc(fn, req)
+	assert.False(t, ok)
+}
+
+func TestKeyFunc_Cookie(t *testing.T) {
+	fn := KeyByCookie("session")
+
+	// Test case 1: Cookie exists
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	key, ok := testKeyFunc(fn, req)
+	assert.True(t, ok)
+	assert.Equal(t, "s1", key)
+
+	// Test case 2: Cookie does not exist
+	req = httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	_, ok = testKeyFunc(fn, req)
+	assert.False(t, ok)
+}
+
+func TestKeyFunc_Route(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	key, ok := testKeyFunc(KeyByRoute(), req)
+	assert.True(t, ok)
+	assert.Equal(t, "GET /users/:id", key)
+}
+
+func TestKeyFunc_Composite(t *testing.T) {
+	fn := KeyByComposite(KeyByRoute(), KeyByClientIP())
+
+	// Test case 1: All key functions match
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.RemoteAddr = com.TestEndpoint
+	key, ok := testKeyFunc(fn, req)
+	assert.True(t, ok)
+	assert.Equal(t, "GET /users/:id|"+com.TestIpAddress, key)
+
+	// Test case 2: One of the key functions does not match
+	fn = KeyByComposite(KeyByRoute(), KeyByHeader("X-Api-Key"))
+	_, ok = testKeyFunc(fn, req)
+	assert.False(t, ok)
+
+	// Test case 3: Parts containing the separator do not collide
+	fn = KeyByComposite(KeyByHeader("X-A"), KeyByHeader("X-B"))
+	keyOf := func(a, b string) string {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set("X-A", a)
+		req.Header.Set("X-B", b)
+		key, ok := testKeyFunc(fn, req)
+		assert.True(t, ok)
+		return key
+	}
+	assert.NotEqual(t, keyOf("a|b", "c"), keyOf("a", "b|c"))
+	assert.NotEqual(t, keyOf(`a\`, "b"), keyOf("a", `\b`))
+	assert.Equal(t, `a\|b|c`, keyOf("a|b", "c"))
+}
+
+func TestIpRateLimiter_IpResolver(t *testing.T) {
+	resolver := NewIpResolver().WithTrustedProxies([]string{"10.20.0.0/16"})
+	conf := NewConfig().WithRate(0.001).WithBurst(1).WithIpResolver(resolver).WithIpWhitelist([]string{"203.0.113.9"})
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+	request := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// Clients behind the trusted proxy have their own buckets, forged addresses on the left are ignored
+	assert.Equal(t, http.StatusOK, request("10.20.0.1:80", "203.0.113.1"))
+	assert.Equal(t, http.StatusOK, request("10.20.0.1:80", "203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, request("10.20.0.2:80", "198.51.100.7, 203.0.113.1"))
+	assert.NotNil(t, limiter.GetLimiter("203.0.113.1"))
+
+	// A client forging the header cannot pick a new bucket or the whitelist
+	assert.Equal(t, http.StatusOK, request("203.0.113.3:80", "203.0.113.4"))
+	assert.Equal(t, http.StatusTooManyRequests, request("203.0.113.3:80", "203.0.113.9"))
+	assert.Nil(t, limiter.GetLimiter("203.0.113.4"))
+
+	// The whitelisted client behind the trusted proxy is not limited
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, request("10.20.0.1:80", "203.0.113.9"))
+	}
+}
+
+func TestKeyFunc_ClientIPResolved(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	router := gin.New()
+	var key string
+	router.GET("/users/:id", func(c *gin.Context) {
+		c.Set(ClientIPContextKey, "203.0.113.5")
+		key, _ = KeyByClientIP()(c)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "203.0.113.5", key)
+}
+
+func TestConfig_NormalizeKey(t *testing.T) {
+	// By default IPv6 addresses are aggregated to /64 and IPv4 addresses are kept
+	conf := isConfigValid(NewConfig())
+	cases := map[string]string{
+		"10.34.0.1":                "10.34.0.1",
+		"::ffff:10.34.0.1":         "10.34.0.1",
+		"2001:db8:34:1:aaaa::1":    "2001:db8:34:1::/64",
+		"2001:DB8:34:1::2":         "2001:db8:34:1::/64",
+		"fe80::1%eth0":             "fe80::/64",
+		"api-key":                  "api-key",
+		"deadbeef":                 "deadbeef",
+		"10.34.0.1|GET /users/:id": "10.34.0.1|GET /users/:id",
+		"":                         "",
+	}
+	for key, want := range cases {
+		assert.Equal(t, want, conf.normalizeKey(key), key)
+	}
+
+	// Configured prefix lengths
+	conf = isConfigValid(NewConfig().WithIpv4Prefix(24).WithIpv6Prefix(48))
+	assert.Equal(t, "10.34.0.0/24", conf.normalizeKey("10.34.0.77"))
+	assert.Equal(t, "10.34.0.0/24", conf.normalizeKey("::ffff:10.34.0.77"))
+	assert.Equal(t, "2001:db8:34::/48", conf.normalizeKey("2001:db8:34:ffff::1"))
+
+	// /128 keeps IPv6 addresses in the canonical form
+	conf = isConfigValid(NewConfig().WithIpv6Prefix(128))
+	assert.Equal(t, "2001:db8::1", conf.normalizeKey("2001:DB8:0::1"))
+
+	// Out of range prefix lengths fall back to the default values
+	conf = isConfigValid(NewConfig().WithIpv4Prefix(8).WithIpv6Prefix(32))
+	assert.Equal(t, DefaultIpv4Prefix, conf.ipv4Prefix)
+	assert.Equal(t, DefaultIpv6Prefix, conf.ipv6Prefix)
+
+	// Keys that are kept do not allocate memory
+	conf = isConfigValid(NewConfig())
+	assert.Zero(t, testing.AllocsPerRun(100, func() { conf.normalizeKey("10.34.0.1") }))
+	assert.Zero(t, testing.AllocsPerRun(100, func() { conf.normalizeKey("api-key") }))
+}
+
+func TestIpRateLimiter_IpPrefix(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRate(0.001).WithBurst(1).WithIpv4Prefix(24))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// Addresses rotating within one IPv6 /64 share a bucket, other networks have their own
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:34:1::1]:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:34:1::2]:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:34:1:ffff::9]:80"))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:34:2::1]:80"))
+
+	// IPv4 addresses within one /24 share a bucket, IPv4-mapped addresses included
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.34.0.1:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.34.0.2:80"))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "[::ffff:10.34.0.3]:80"))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.34.1.1:80"))
+
+	// The buckets are keyed by the networks
+	assert.NotNil(t, limiter.GetLimiter("2001:db8:34:1::/64"))
+	assert.NotNil(t, limiter.GetLimiter("2001:db8:34:2::/64"))
+	assert.NotNil(t, limiter.GetLimiter("10.34.0.0/24"))
+	assert.NotNil(t, limiter.GetLimiter("10.34.1.0/24"))
+	assert.Nil(t, limiter.GetLimiter("2001:db8:34:3::/64"))
+}
+
+func TestIpRateLimiter_IpPrefixKeys(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRate(0.001).WithBurst(2))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:35:1::1]:80"))
+
+	// Any address in the network finds the bucket of the network
+	assert.NotNil(t, limiter.GetLimiter("2001:db8:35:1::1"))
+	assert.NotNil(t, limiter.GetLimiter("2001:DB8:35:1:ffff::9"))
+	state, ok := limiter.GetKeyState("2001:db8:35:1::2")
+	assert.True(t, ok)
+	assert.Equal(t, "2001:db8:35:1::/64", state.Key)
+	assert.InDelta(t, 1, state.Tokens, 0.1)
+
+	// Resetting an address resets the bucket of its network
+	assert.True(t, limiter.ResetKey("2001:db8:35:1::3"))
+	state, _ = limiter.GetKeyState("2001:db8:35:1::/64")
+	assert.InDelta(t, 2, state.Tokens, 0.1)
+	limiter.RefreshLimits("2001:db8:35:1::4")
+
+	// Banning an address bans its network, and any address in it unbans the network
+	ban := limiter.Ban("2001:db8:35:1::5", time.Minute)
+	assert.Equal(t, "2001:db8:35:1::/64", ban.Key)
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:35:1::6]:80"))
+	assert.True(t, limiter.Unban("2001:db8:35:1::7"))
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "[2001:db8:35:1::6]:80"))
+
+	// Deleting an address deletes the bucket of its network
+	assert.True(t, limiter.DeleteKey("2001:db8:35:1::8"))
+	assert.Nil(t, limiter.GetLimiter("2001:db8:35:1::/64"))
+}
@@ -0,0 +1,150 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	itl "github.com/shengyanli1982/orbit-contrib/pkg/ratelimiter/internal"
+)
+
+// Limits 是一个键的速率和突发，例如一个套餐的配额
+// Limits is the rate and burst of a key, such as the quota of a plan
+type Limits struct {
+	// Rate 是每秒限制速率
+	// Rate is the limit rate per second
+	Rate float64
+
+	// Burst 是限制突发
+	// Burst is the limit burst
+	Burst int
+}
+
+// LimitResolver 是一个限额解析函数，返回键的速率和突发，例如根据键查询客户的套餐。
+// 小于等于 0 的速率或突发使用配置的值。在请求之外解析限额时，例如 SetRate、SetBurst、RefreshLimits、ResetKey 和 Restore，r 是一个没有请求头的 GET / 占位请求，不会为 nil。
+// 键的限流器在缓存的段锁内创建，所以解析应该很快，较慢的查询可以使用 CachedLimitResolver 包装
+// LimitResolver is a limit resolve function that returns the rate and burst of a key, such as looking up the plan of the customer by the key.
+// A rate or burst less than or equal to 0 falls back to the value of the configuration. When the limits are resolved outside a request, such as by SetRate, SetBurst, RefreshLimits, ResetKey and Restore, r is a placeholder GET / request without headers, it is never nil.
+// The limiter of a key is created within the segment lock of the cache, so resolving should be fast, slow lookups can be wrapped with CachedLimitResolver
+type LimitResolver func(key string, r *http.Request) (rate float64, burst int)
+
+// LimitsByKey 返回一个从指定的映射中查找键的限额的解析函数，映射中没有的键使用配置的速率和突发。映射在调用时被复制
+// LimitsByKey returns a resolve function that looks up the limits of a key in the specified map, keys not in the map use the rate and burst of the configuration. The map is copied when called
+func LimitsByKey(limits map[string]Limits) LimitResolver {
+	// 复制映射，避免调用者之后的修改产生并发读写
+	// Copy the map, so that later changes by the caller do not cause concurrent reads and writes
+	m := make(map[string]Limits, len(limits))
+	for key, l := range limits {
+		m[key] = l
+	}
+
+	return func(key string, r *http.Request) (float64, int) {
+		l := m[key]
+		return l.Rate, l.Burst
+	}
+}
+
+// newResolveRequest 是一个函数，返回在请求之外解析限额时传给限额解析函数的占位请求
+// newResolveRequest is a function that returns the placeholder request passed to the limit resolver when the limits are resolved outside a request
+func newResolveRequest() *http.Request {
+	return &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/"}, Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1, Header: make(http.Header)}
+}
+
+// limits 方法返回配置的速率和突发
+// The limits method returns the rate and burst of the configuration
+func (c *Config) limits() Limits {
+	return Limits{Rate: c.rate, Burst: c.burst}
+}
+
+// limitsOf 方法返回键的速率和突发，配置了限额解析函数时由它决定，否则使用配置的速率和突发
+// The limitsOf method returns the rate and burst of the key, they are decided by the limit resolver when it is configured, otherwise the rate and burst of the configuration are used
+func (c *Config) limitsOf(key string, r *http.Request) Limits {
+	limits := c.limits()
+	if c.limitResolver == nil {
+		return limits
+	}
+
+	// 只使用有效的解析结果
+	// Only use valid results of the resolver
+	rate, burst := c.limitResolver(key, r)
+	if rate > 0 {
+		limits.Rate = rate
+	}
+	if burst > 0 {
+		limits.Burst = burst
+	}
+	return limits
+}
+
+// cachedLimits 是缓存的解析结果和它的过期时间
+// cachedLimits is a cached result of the resolver and its expiration time
+type cachedLimits struct {
+	// limits 是解析的速率和突发
+	// limits is the resolved rate and burst
+	limits Limits
+
+	// expireAt 是结果过期的 Unix 毫秒数
+	// expireAt is the time the result expires in Unix milliseconds
+	expireAt int64
+}
+
+// CachedLimitResolver 是一个缓存解析结果的限额解析器，用于包装较慢的查询，例如从数据库读取客户的套餐
+// CachedLimitResolver is a limit resolver caching the results, used to wrap slow lookups, such as reading the plan of the customer from a database
+type CachedLimitResolver struct {
+	// resolver 是被包装的解析函数
+	// resolver is the wrapped resolve function
+	resolver LimitResolver
+
+	// ttl 是结果缓存的毫秒数
+	// ttl is the number of milliseconds a result is cached
+	ttl int64
+
+	// cache 是一个指向 itl.Cache 的指针，用于存储每个键的结果
+	// cache is a pointer to itl.Cache, used to store the result of each key
+	cache *itl.Cache[cachedLimits]
+}
+
+// NewCachedLimitResolver 是一个函数，返回一个将 resolver 的结果缓存 ttl 时间的解析器，ttl 小于等于 0 时使用 DefaultCacheTTL。
+// 不再使用时需要调用 Stop 方法
+// NewCachedLimitResolver is a function that returns a resolver caching the results of resolver for ttl, DefaultCacheTTL is used when ttl is less than or equal to 0.
+// The Stop method must be called when it is no longer used
+func NewCachedLimitResolver(resolver LimitResolver, ttl time.Duration) *CachedLimitResolver {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	return &CachedLimitResolver{
+		resolver: resolver,
+		ttl:      ttl.Milliseconds(),
+		cache:    itl.NewCacheWithOptions[cachedLimits](&itl.Options{ExpireTime: ttl, ScanInterval: ttl}),
+	}
+}
+
+// Resolve 方法返回键的速率和突发，缓存中没有结果或者结果已过期时调用被包装的解析函数。可以作为 LimitResolver 传给 WithLimitResolver
+// The Resolve method returns the rate and burst of the key, the wrapped resolve function is called when there is no result in the cache or the result has expired. It can be passed to WithLimitResolver as a LimitResolver
+func (c *CachedLimitResolver) Resolve(key string, r *http.Request) (float64, int) {
+	// 如果缓存中有未过期的结果，则直接返回
+	// If there is an unexpired result in the cache, return it directly
+	now := time.Now().UnixMilli()
+	if v, ok := c.cache.Get(key); ok && now < v.expireAt {
+		return v.limits.Rate, v.limits.Burst
+	}
+
+	// 在锁外调用被包装的解析函数，避免较慢的查询阻塞其他的键，并缓存结果
+	// Call the wrapped resolve function outside the lock, so that slow lookups do not block other keys, and cache the result
+	rate, burst := c.resolver(key, r)
+	c.cache.Set(key, cachedLimits{limits: Limits{Rate: rate, Burst: burst}, expireAt: now + c.ttl})
+	return rate, burst
+}
+
+// Invalidate 方法删除键的缓存结果，下一次解析时重新查询，例如在客户的套餐变化之后
+// The Invalidate method deletes the cached result of the key, so the next resolve looks it up again, such as after the plan of the customer changes
+func (c *CachedLimitResolver) Invalidate(key string) {
+	c.cache.Delete(key)
+}
+
+// Stop 方法用于停止解析器的缓存
+// The Stop method is used to stop the cache of the resolver
+func (c *CachedLimitResolver) Stop() {
+	c.cache.Stop()
+}
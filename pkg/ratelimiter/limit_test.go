@@ -0,0 +1,188 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func testLimitRequest(handler http.Handler, apiKey string) int {
+	req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+	req.Header.Set("X-Api-Key", apiKey)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp.Code
+}
+
+func TestLimitsByKey(t *testing.T) {
+	plans := map[string]Limits{"pro": {Rate: 10, Burst: 20}}
+	resolver := LimitsByKey(plans)
+
+	// Changing the map afterwards does not affect the resolver
+	plans["pro"] = Limits{Rate: 1, Burst: 1}
+
+	r, b := resolver("pro", nil)
+	assert.Equal(t, 10.0, r)
+	assert.Equal(t, 20, b)
+
+	// Unknown keys resolve to nothing
+	r, b = resolver("free", nil)
+	assert.Zero(t, r)
+	assert.Zero(t, b)
+}
+
+func TestConfig_LimitsOf(t *testing.T) {
+	conf := isConfigValid(NewConfig().WithRate(2).WithBurst(3))
+	assert.Equal(t, Limits{Rate: 2, Burst: 3}, conf.limitsOf("pro", nil))
+
+	// Invalid values of the resolver fall back to the configuration
+	conf.WithLimitResolver(LimitsByKey(map[string]Limits{"pro": {Rate: 10}, "team": {Burst: 5}}))
+	assert.Equal(t, Limits{Rate: 10, Burst: 3}, conf.limitsOf("pro", nil))
+	assert.Equal(t, Limits{Rate: 2, Burst: 5}, conf.limitsOf("team", nil))
+	assert.Equal(t, Limits{Rate: 2, Burst: 3}, conf.limitsOf("free", nil))
+	assert.Equal(t, Limits{Rate: 2, Burst: 3}, conf.limits())
+}
+
+func TestCachedLimitResolver(t *testing.T) {
+	calls := atomic.Int32{}
+	burst := atomic.Int32{}
+	burst.Store(5)
+	resolver := NewCachedLimitResolver(func(key string, r *http.Request) (float64, int) {
+		calls.Add(1)
+		return 1, int(burst.Load())
+	}, 50*time.Millisecond)
+	defer resolver.Stop()
+
+	// The result is cached
+	for i := 0; i < 3; i++ {
+		_, b := resolver.Resolve("pro", nil)
+		assert.Equal(t, 5, b)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	// An invalidated key is looked up again
+	burst.Store(10)
+	resolver.Invalidate("pro")
+	_, b := resolver.Resolve("pro", nil)
+	assert.Equal(t, 10, b)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// An expired result is looked up again
+	time.Sleep(60 * time.Millisecond)
+	resolver.Resolve("pro", nil)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestIpRateLimiter_LimitResolver(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmTokenBucket, AlgorithmGCRA} {
+		resolver := LimitsByKey(map[string]Limits{"pro": {Rate: 1, Burst: 3}})
+		conf := NewConfig().WithBurst(1).WithAlgorithm(algorithm).WithKeyFunc(KeyByHeader("X-Api-Key")).WithLimitResolver(resolver)
+		limiter := NewIpRateLimiter(conf)
+		router := testHeadersRouter(limiter.HandlerFunc())
+
+		// Each key is limited by its own plan
+		assert.Equal(t, http.StatusOK, testLimitRequest(router, "free"))
+		assert.Equal(t, http.StatusTooManyRequests, testLimitRequest(router, "free"))
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, testLimitRequest(router, "pro"), algorithm)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, testLimitRequest(router, "pro"))
+		assert.Equal(t, 3, limiter.GetLimiter("pro").Burst())
+		assert.Equal(t, 1, limiter.GetLimiter("free").Burst())
+
+		limiter.Stop()
+	}
+}
+
+func TestIpRateLimiter_LimitResolverStore(t *testing.T) {
+	store := NewMemoryStore()
+	defer store.Stop()
+	resolver := LimitsByKey(map[string]Limits{"pro": {Rate: 1, Burst: 3}})
+	conf := NewConfig().WithBurst(1).WithStore(store).WithKeyFunc(KeyByHeader("X-Api-Key")).WithLimitResolver(resolver)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	// The store uses the limits of each key too
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, testLimitRequest(router, "pro"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, testLimitRequest(router, "pro"))
+	assert.Equal(t, http.StatusOK, testLimitRequest(router, "free"))
+	assert.Equal(t, http.StatusTooManyRequests, testLimitRequest(router, "free"))
+}
+
+func TestIpRateLimiter_RefreshLimits(t *testing.T) {
+	mu := sync.Mutex{}
+	plans := map[string]Limits{"acme": {Rate: 1, Burst: 1}}
+	conf := NewConfig().WithKeyFunc(KeyByHeader("X-Api-Key")).WithLimitResolver(func(key string, r *http.Request) (float64, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return plans[key].Rate, plans[key].Burst
+	})
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testLimitRequest(router, "acme"))
+	assert.Equal(t, http.StatusTooManyRequests, testLimitRequest(router, "acme"))
+
+	// Upgrade the plan and refresh the existing bucket
+	mu.Lock()
+	plans["acme"] = Limits{Rate: 100, Burst: 10}
+	mu.Unlock()
+	limiter.RefreshLimits("acme")
+	limiter.RefreshLimits("unknown")
+	assert.Equal(t, rate.Limit(100), limiter.GetLimiter("acme").Limit())
+	assert.Equal(t, 10, limiter.GetLimiter("acme").Burst())
+	assert.Nil(t, limiter.GetLimiter("unknown"))
+
+	// Changing the default rate and burst does not override the plan
+	limiter.SetRate(5)
+	limiter.SetBurst(5)
+	assert.Equal(t, rate.Limit(100), limiter.GetLimiter("acme").Limit())
+	assert.Equal(t, 10, limiter.GetLimiter("acme").Burst())
+}
+
+func TestIpRateLimiter_ResolveOutsideRequest(t *testing.T) {
+	var limiter *IpRateLimiter
+	resolved := make(chan string, 16)
+	conf := NewConfig().WithKeyFunc(KeyByHeader("X-Api-Key")).WithLimitResolver(func(key string, r *http.Request) (float64, int) {
+		// Outside a request the resolver gets a placeholder request it can read from
+		if r.Header.Get("X-Api-Key") == "" && r.URL.Query().Get("plan") == "" {
+			resolved <- key
+
+			// Looking up the cache does not deadlock, because the segment lock is not held
+			limiter.GetLimiter(key)
+		}
+		return 0, 0
+	})
+	limiter = NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+	assert.Equal(t, http.StatusOK, testLimitRequest(router, "acme"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		limiter.SetRate(5)
+		limiter.SetBurst(5)
+		limiter.RefreshLimits("acme")
+		limiter.ResetKey("acme")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("resolving the limits outside a request deadlocked")
+	}
+	assert.Len(t, resolved, 4)
+	assert.Equal(t, rate.Limit(5), limiter.GetLimiter("acme").Limit())
+	assert.Equal(t, 5, limiter.GetLimiter("acme").Burst())
+}
@@ -0,0 +1,126 @@
+package ratelimiter
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Algorithm 是限流算法的类型
+// Algorithm is the type of the rate limiting algorithm
+type Algorithm int8
+
+const (
+	// AlgorithmTokenBucket 是令牌桶算法，基于 golang.org/x/time/rate 实现
+	// AlgorithmTokenBucket is the token bucket algorithm, implemented on top of golang.org/x/time/rate
+	AlgorithmTokenBucket Algorithm = iota
+
+	// AlgorithmSlidingWindow 是滑动窗口计数器算法
+	// AlgorithmSlidingWindow is the sliding window counter algorithm
+	AlgorithmSlidingWindow
+
+	// AlgorithmSlidingLog 是滑动日志算法
+	// AlgorithmSlidingLog is the sliding log algorithm
+	AlgorithmSlidingLog
+
+	// AlgorithmFixedWindow 是固定窗口算法
+	// AlgorithmFixedWindow is the fixed window algorithm
+	AlgorithmFixedWindow
+
+	// AlgorithmGCRA 是通用信元速率算法，每个键的状态只有一个原子的理论到达时间
+	// AlgorithmGCRA is the generic cell rate algorithm, the per-key state is only an atomic theoretical arrival time
+	AlgorithmGCRA
+)
+
+// DefaultAlgorithm 是默认的限流算法
+// DefaultAlgorithm is the default rate limiting algorithm
+var DefaultAlgorithm = AlgorithmTokenBucket
+
+// String 方法返回限流算法的名称
+// The String method returns the name of the rate limiting algorithm
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmTokenBucket:
+		return "token_bucket"
+	case AlgorithmSlidingWindow:
+		return "sliding_window"
+	case AlgorithmSlidingLog:
+		return "sliding_log"
+	case AlgorithmFixedWindow:
+		return "fixed_window"
+	case AlgorithmGCRA:
+		return "gcra"
+	default:
+		return "unknown"
+	}
+}
+
+// Limiter 是限流器接口，*rate.Limiter 以及本包中的各种限流器都实现了这个接口
+// Limiter is the rate limiter interface, *rate.Limiter and all limiters in this package implement it
+type Limiter interface {
+	// Limit 返回每秒的限制速率
+	// Limit returns the limit rate per second
+	Limit() rate.Limit
+
+	// Burst 返回限制突发
+	// Burst returns the limit burst
+	Burst() int
+
+	// SetLimit 设置每秒的限制速率
+	// SetLimit sets the limit rate per second
+	SetLimit(newLimit rate.Limit)
+
+	// SetBurst 设置限制突发
+	// SetBurst sets the limit burst
+	SetBurst(newBurst int)
+
+	// Allow 判断当前是否允许一个请求
+	// Allow reports whether one request may happen now
+	Allow() bool
+
+	// AllowN 判断在时间 t 是否允许 n 个请求
+	// AllowN reports whether n requests may happen at time t
+	AllowN(t time.Time, n int) bool
+
+	// TokensAt 返回在时间 t 可用的令牌数量
+	// TokensAt returns the number of tokens available at time t
+	TokensAt(t time.Time) float64
+}
+
+// NewLimiter 是一个函数，根据限流算法、速率和突发创建一个新的限流器
+// NewLimiter is a function that creates a new rate limiter based on the algorithm, rate and burst
+func NewLimiter(algorithm Algorithm, r rate.Limit, b int) Limiter {
+	switch algorithm {
+	case AlgorithmSlidingWindow:
+		return NewSlidingWindowLimiter(r, b)
+	case AlgorithmSlidingLog:
+		return NewSlidingLogLimiter(r, b)
+	case AlgorithmFixedWindow:
+		return NewFixedWindowLimiter(r, b)
+	case AlgorithmGCRA:
+		return NewGCRALimiter(r, b)
+	default:
+		return rate.NewLimiter(r, b)
+	}
+}
+
+// windowOf 是一个函数，计算窗口算法的窗口长度，在一个窗口内最多允许 b 个请求，使平均速率等于 r
+// windowOf is a function that calculates the window length of the window algorithms, at most b requests are allowed in one window, so that the average rate equals r
+func windowOf(r rate.Limit, b int) time.Duration {
+	// 如果速率为无限，则窗口长度为 0，表示不进行限制
+	// If the rate is infinite, the window length is 0, which means no limit
+	if r == rate.Inf {
+		return 0
+	}
+
+	// 如果速率小于等于 0，则窗口永远不会结束
+	// If the rate is less than or equal to 0, the window never ends
+	if r <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	// 计算窗口长度，并限制在 time.Duration 的范围内
+	// Calculate the window length and clamp it to the range of time.Duration
+	return durationOf(float64(b) / float64(r))
+}
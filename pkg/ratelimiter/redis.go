@@ -0,0 +1,190 @@
+package ratelimiter
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RedisClient 是一个 Redis 客户端接口，Do 方法执行一个 Redis 命令并返回结果
+// RedisClient is a Redis client interface, the Do method executes a Redis command and returns the result
+type RedisClient interface {
+	// Do 执行一个 Redis 命令，结果为 int64、string、[]any 或 nil，Redis 错误以 error 返回
+	// Do executes a Redis command, the result is int64, string, []any or nil, and Redis errors are returned as error
+	Do(ctx context.Context, args ...any) (any, error)
+}
+
+// RedisClientFunc 是一个函数类型，实现了 RedisClient 接口，便于适配其他 Redis 客户端，
+// 例如 go-redis：RedisClientFunc(func(ctx context.Context, args ...any) (any, error) { return c.Do(ctx, args...).Result() })
+// RedisClientFunc is a function type that implements the RedisClient interface, making it easy to adapt other Redis clients,
+// e.g. go-redis: RedisClientFunc(func(ctx context.Context, args ...any) (any, error) { return c.Do(ctx, args...).Result() })
+type RedisClientFunc func(ctx context.Context, args ...any) (any, error)
+
+// Do 方法调用函数本身
+// The Do method calls the function itself
+func (f RedisClientFunc) Do(ctx context.Context, args ...any) (any, error) {
+	return f(ctx, args...)
+}
+
+// DefaultRedisKeyPrefix 是 Redis 存储中键的默认前缀
+// DefaultRedisKeyPrefix is the default prefix of the keys in the Redis store
+var DefaultRedisKeyPrefix = "ratelimiter:"
+
+// ErrUnexpectedRedisReply 表示 Redis 返回了无法识别的结果
+// ErrUnexpectedRedisReply means Redis returned an unrecognized result
+var ErrUnexpectedRedisReply = errors.New("unexpected redis reply")
+
+// redisGCRAScript 是在 Redis 中以原子方式执行 GCRA 算法的 Lua 脚本，时间使用 Redis 服务器的微秒时间，
+// 所以各个进程的时钟偏差不会影响限流。
+// KEYS[1] 是键，ARGV 依次是发射间隔 (微秒)、突发、令牌数量和 TTL (毫秒)。
+// 返回 {是否允许, 剩余配额, 完全恢复的微秒数, 需要等待的微秒数}
+// redisGCRAScript is a Lua script that atomically executes the GCRA algorithm in Redis, the time is the microsecond time of the Redis server,
+// so the clock skew of the processes does not affect the limit.
+// KEYS[1] is the key, ARGV is the emission interval (microseconds), burst, number of tokens and TTL (milliseconds) in order.
+// It returns {allowed, remaining quota, microseconds until fully restored, microseconds to wait}
+const redisGCRAScript = `
+if redis.replicate_commands then
+	redis.replicate_commands()
+end
+
+local key = KEYS[1]
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local tolerance = interval * burst
+
+local tat = tonumber(redis.call("GET", key))
+if not tat or tat < now then
+	tat = now
+end
+
+local allowed = 0
+local retry_after = 0
+local new_tat = tat + n * interval
+local diff = now - (new_tat - tolerance)
+
+if n > burst then
+	retry_after = -1
+elseif diff < 0 then
+	retry_after = -diff
+else
+	allowed = 1
+	tat = new_tat
+	local expire = math.ceil((tat - now) / 1000)
+	if expire < ttl then
+		expire = ttl
+	end
+	redis.call("SET", key, tat, "PX", expire)
+end
+
+local remaining = math.floor((tolerance - (tat - now)) / interval)
+if remaining < 0 then
+	remaining = 0
+end
+
+return {allowed, remaining, tat - now, retry_after}
+`
+
+// redisGCRAScriptSHA 是 Lua 脚本的 SHA1 值，用于 EVALSHA 命令
+// redisGCRAScriptSHA is the SHA1 of the Lua script, used for the EVALSHA command
+var redisGCRAScriptSHA = func() string {
+	sum := sha1.Sum([]byte(redisGCRAScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// RedisStore 是一个基于 Redis 协议的存储，使用 Lua 脚本以原子方式执行 GCRA 算法，多个进程可以共享同一组限流配额
+// RedisStore is a store based on the Redis protocol, it atomically executes the GCRA algorithm with a Lua script, multiple processes can share the same rate limiting quota
+type RedisStore struct {
+	// client 是 Redis 客户端
+	// client is the Redis client
+	client RedisClient
+
+	// prefix 是键的前缀
+	// prefix is the prefix of the keys
+	prefix string
+}
+
+// NewRedisStore 是一个函数，返回一个使用指定 Redis 客户端的 Redis 存储
+// NewRedisStore is a function that returns a Redis store using the specified Redis client
+func NewRedisStore(client RedisClient) *RedisStore {
+	return &RedisStore{client: client, prefix: DefaultRedisKeyPrefix}
+}
+
+// WithPrefix 方法设置键的前缀，并返回 Redis 存储
+// The WithPrefix method sets the prefix of the keys and returns the Redis store
+func (s *RedisStore) WithPrefix(prefix string) *RedisStore {
+	s.prefix = prefix
+	return s
+}
+
+// Take 方法在 Redis 中以原子方式从键对应的桶中取出 n 个令牌
+// The Take method atomically takes n tokens from the bucket of the key in Redis
+func (s *RedisStore) Take(ctx context.Context, key string, limit rate.Limit, burst int, n int, ttl time.Duration) (*Decision, error) {
+	// 如果速率为无限，则不需要访问 Redis
+	// If the rate is infinite, there is no need to access Redis
+	if limit == rate.Inf {
+		return &Decision{Allowed: true, Limit: burst, Remaining: burst, Cost: n}, nil
+	}
+
+	// 计算发射间隔，单位为微秒，速率小于等于 0 时使用最大的间隔
+	// Calculate the emission interval in microseconds, the largest interval is used when the rate is less than or equal to 0
+	interval := int64(math.MaxInt32)
+	if limit > 0 {
+		interval = int64(math.Ceil(float64(time.Second/time.Microsecond) / float64(limit)))
+	}
+
+	// 先使用 EVALSHA 执行脚本，如果脚本不存在，则使用 EVAL 执行脚本
+	// First execute the script with EVALSHA, if the script does not exist, execute it with EVAL
+	args := []any{redisGCRAScriptSHA, 1, s.prefix + key, interval, burst, n, ttl.Milliseconds()}
+	reply, err := s.client.Do(ctx, append([]any{"EVALSHA"}, args...)...)
+	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		args[0] = redisGCRAScript
+		reply, err = s.client.Do(ctx, append([]any{"EVAL"}, args...)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析脚本的返回值
+	// Parse the result of the script
+	values, ok := reply.([]any)
+	if !ok || len(values) != 4 {
+		return nil, ErrUnexpectedRedisReply
+	}
+	numbers := make([]int64, len(values))
+	for i, value := range values {
+		if numbers[i], ok = value.(int64); !ok {
+			return nil, ErrUnexpectedRedisReply
+		}
+	}
+
+	d := &Decision{
+		Allowed:   numbers[0] == 1,
+		Limit:     burst,
+		Remaining: int(numbers[1]),
+		Reset:     time.Duration(numbers[2]) * time.Microsecond,
+		Cost:      n,
+	}
+
+	// 如果请求被拒绝，则设置需要等待的时间，n 超过 burst 时永远不会被允许
+	// If the request is rejected, set the time to wait, it will never be allowed when n exceeds burst
+	if !d.Allowed {
+		if numbers[3] < 0 {
+			d.RetryAfter = time.Duration(math.MaxInt64)
+		} else {
+			d.RetryAfter = time.Duration(numbers[3]) * time.Microsecond
+		}
+	}
+
+	return d, nil
+}
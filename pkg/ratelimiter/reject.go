@@ -0,0 +1,104 @@
+package ratelimiter
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RejectHandler 是一个拒绝处理函数，用于在请求被限流时写入响应，调用时请求处理已经被中止
+// RejectHandler is a reject handler function used to write the response when a request is rate limited, the request processing has already been aborted when it is called
+type RejectHandler func(ctx *gin.Context, d *Decision)
+
+// DefaultRejectMessage 是默认的拒绝消息
+// DefaultRejectMessage is the default reject message
+var DefaultRejectMessage = "too many http requests"
+
+// DefaultRejectHandler 是默认的拒绝处理函数，返回 429 状态码和纯文本的拒绝消息
+// DefaultRejectHandler is the default reject handler, it returns the 429 status code and the reject message in plain text
+var DefaultRejectHandler = func(ctx *gin.Context, d *Decision) {
+	ctx.String(http.StatusTooManyRequests, "[429] "+DefaultRejectMessage)
+}
+
+// JSONRejectBody 是 JSON 拒绝处理函数返回的响应体
+// JSONRejectBody is the response body returned by the JSON reject handler
+type JSONRejectBody struct {
+	// Code 是 HTTP 状态码
+	// Code is the HTTP status code
+	Code int `json:"code"`
+
+	// Message 是拒绝消息
+	// Message is the reject message
+	Message string `json:"message"`
+
+	// RetryAfter 是客户端需要等待的秒数
+	// RetryAfter is the number of seconds the client needs to wait
+	RetryAfter int64 `json:"retry_after"`
+}
+
+// JSONRejectHandler 是一个拒绝处理函数，返回 429 状态码和 JSON 格式的拒绝消息
+// JSONRejectHandler is a reject handler that returns the 429 status code and the reject message in JSON format
+var JSONRejectHandler = func(ctx *gin.Context, d *Decision) {
+	ctx.JSON(http.StatusTooManyRequests, &JSONRejectBody{
+		Code:       http.StatusTooManyRequests,
+		Message:    DefaultRejectMessage,
+		RetryAfter: ceilSeconds(d.RetryAfter),
+	})
+}
+
+// ProblemDetails 是 RFC 7807 定义的问题详情，RetryAfter 是扩展成员
+// ProblemDetails is the problem details defined by RFC 7807, RetryAfter is an extension member
+type ProblemDetails struct {
+	// Type 是标识问题类型的 URI
+	// Type is a URI that identifies the problem type
+	Type string `json:"type"`
+
+	// Title 是问题类型的简短描述
+	// Title is a short summary of the problem type
+	Title string `json:"title"`
+
+	// Status 是 HTTP 状态码
+	// Status is the HTTP status code
+	Status int `json:"status"`
+
+	// Detail 是针对这次问题的描述
+	// Detail is an explanation specific to this occurrence of the problem
+	Detail string `json:"detail,omitempty"`
+
+	// Instance 是标识这次问题的 URI
+	// Instance is a URI that identifies this occurrence of the problem
+	Instance string `json:"instance,omitempty"`
+
+	// RetryAfter 是客户端需要等待的秒数
+	// RetryAfter is the number of seconds the client needs to wait
+	RetryAfter int64 `json:"retry_after"`
+}
+
+// ProblemContentType 是 RFC 7807 问题详情的内容类型
+// ProblemContentType is the content type of the RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// NewProblemRejectHandler 是一个函数，返回一个按照 RFC 7807 返回 application/problem+json 响应的拒绝处理函数，
+// problemType 是问题类型的 URI，为空时使用 "about:blank"
+// NewProblemRejectHandler is a function that returns a reject handler which returns an application/problem+json response according to RFC 7807,
+// problemType is the URI of the problem type, "about:blank" is used if it is empty
+func NewProblemRejectHandler(problemType string) RejectHandler {
+	if len(problemType) == 0 {
+		problemType = "about:blank"
+	}
+
+	return func(ctx *gin.Context, d *Decision) {
+		// 先设置内容类型，ctx.JSON 不会覆盖已经存在的内容类型
+		// Set the content type first, ctx.JSON does not override an existing content type
+		ctx.Header("Content-Type", ProblemContentType)
+
+		ctx.JSON(http.StatusTooManyRequests, &ProblemDetails{
+			Type:       problemType,
+			Title:      http.StatusText(http.StatusTooManyRequests),
+			Status:     http.StatusTooManyRequests,
+			Detail:     DefaultRejectMessage,
+			Instance:   ctx.Request.URL.Path,
+			RetryAfter: ceilSeconds(d.RetryAfter),
+		})
+	}
+}
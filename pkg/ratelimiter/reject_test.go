@@ -0,0 +1,78 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRejectRequest(handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	router := testHeadersRouter(handler)
+
+	// The first request uses up the burst, the second one is rejected
+	var resp *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = com.TestEndpoint2
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+	}
+
+	return resp
+}
+
+func TestLimiter_DefaultRejectHandler(t *testing.T) {
+	resp := testRejectRequest(NewRateLimiter(NewConfig()).HandlerFunc())
+
+	// The default body does not leak the request details
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "[429] "+DefaultRejectMessage, resp.Body.String())
+}
+
+func TestLimiter_JSONRejectHandler(t *testing.T) {
+	resp := testRejectRequest(NewRateLimiter(NewConfig().WithRejectHandler(JSONRejectHandler)).HandlerFunc())
+
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Contains(t, resp.Header().Get("Content-Type"), "application/json")
+
+	body := JSONRejectBody{}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, http.StatusTooManyRequests, body.Code)
+	assert.Equal(t, DefaultRejectMessage, body.Message)
+	assert.Equal(t, int64(1), body.RetryAfter)
+}
+
+func TestIpRateLimiter_ProblemRejectHandler(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRejectHandler(NewProblemRejectHandler("")))
+	defer limiter.Stop()
+	resp := testRejectRequest(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, ProblemContentType, resp.Header().Get("Content-Type"))
+
+	body := ProblemDetails{}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "about:blank", body.Type)
+	assert.Equal(t, http.StatusText(http.StatusTooManyRequests), body.Title)
+	assert.Equal(t, http.StatusTooManyRequests, body.Status)
+	assert.Equal(t, com.TestUrlPath, body.Instance)
+}
+
+func TestIpRateLimiter_CustomRejectHandler(t *testing.T) {
+	conf := NewConfig().WithRejectHandler(func(ctx *gin.Context, d *Decision) {
+		ctx.Header("X-Error-Code", "RATE_LIMITED")
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "slow down", "remaining": d.Remaining})
+	})
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	resp := testRejectRequest(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "RATE_LIMITED", resp.Header().Get("X-Error-Code"))
+	assert.JSONEq(t, `{"error":"slow down","remaining":0}`, resp.Body.String())
+}
@@ -0,0 +1,388 @@
+package ratelimiter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRespMaxIdle 是 RespClient 默认的最大空闲连接数
+// DefaultRespMaxIdle is the default maximum number of idle connections of RespClient
+var DefaultRespMaxIdle = 16
+
+// DefaultRespTimeout 是 RespClient 默认的连接和读写超时时间
+// DefaultRespTimeout is the default connection and read/write timeout of RespClient
+var DefaultRespTimeout = 3 * time.Second
+
+const (
+	// maxRespBulkSize 是 RESP 批量字符串的最大长度，与 Redis 协议的上限 512MB 相同
+	// maxRespBulkSize is the maximum length of a RESP bulk string, the same as the limit of 512MB of the Redis protocol
+	maxRespBulkSize = 512 << 20
+
+	// maxRespArraySize 是 RESP 数组的最大元素数量，限流只会读取很小的数组
+	// maxRespArraySize is the maximum number of elements of a RESP array, rate limiting only reads very small arrays
+	maxRespArraySize = 1 << 20
+
+	// maxRespLineSize 是 RESP 结果中一行的最大长度，包括简单字符串、错误以及批量字符串和数组的头部
+	// maxRespLineSize is the maximum length of a line in a RESP reply, including simple strings, errors and the headers of bulk strings and arrays
+	maxRespLineSize = 64 << 10
+
+	// maxRespDepth 是 RESP 数组的最大嵌套深度，限流只会读取没有嵌套或者嵌套很浅的数组
+	// maxRespDepth is the maximum nesting depth of RESP arrays, rate limiting only reads arrays that are not nested or nested shallowly
+	maxRespDepth = 16
+)
+
+// ErrRespClientClosed 表示 RespClient 已经关闭
+// ErrRespClientClosed means the RespClient has been closed
+var ErrRespClientClosed = errors.New("resp client closed")
+
+// RedisError 是 Redis 服务器返回的错误
+// RedisError is an error returned by the Redis server
+type RedisError string
+
+// Error 方法返回错误信息
+// The Error method returns the error message
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// respConn 是一个带缓冲的 RESP 连接
+// respConn is a buffered RESP connection
+type respConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+	wr   *bufio.Writer
+}
+
+// RespClient 是一个轻量的 Redis 协议 (RESP) 客户端，带有连接池，实现了 RedisClient 接口
+// RespClient is a lightweight Redis protocol (RESP) client with a connection pool, it implements the RedisClient interface
+type RespClient struct {
+	// addr 是 Redis 服务器的地址
+	// addr is the address of the Redis server
+	addr string
+
+	// password 是 Redis 服务器的密码
+	// password is the password of the Redis server
+	password string
+
+	// db 是 Redis 数据库的编号
+	// db is the number of the Redis database
+	db int
+
+	// timeout 是连接和读写的超时时间
+	// timeout is the connection and read/write timeout
+	timeout time.Duration
+
+	// idle 是空闲连接池
+	// idle is the pool of idle connections
+	idle chan *respConn
+
+	// once 是一个 sync.Once 类型的变量，用于确保连接池只被关闭一次
+	// once is a variable of type sync.Once, used to ensure that the pool is closed only once
+	once sync.Once
+
+	// closed 在客户端关闭时被关闭
+	// closed is closed when the client is closed
+	closed chan struct{}
+}
+
+// NewRespClient 是一个函数，返回一个连接到指定地址的 RespClient
+// NewRespClient is a function that returns a RespClient connecting to the specified address
+func NewRespClient(addr string) *RespClient {
+	return &RespClient{
+		addr:    addr,
+		timeout: DefaultRespTimeout,
+		idle:    make(chan *respConn, DefaultRespMaxIdle),
+		closed:  make(chan struct{}),
+	}
+}
+
+// WithPassword 方法设置 Redis 服务器的密码，并返回客户端
+// The WithPassword method sets the password of the Redis server and returns the client
+func (c *RespClient) WithPassword(password string) *RespClient {
+	c.password = password
+	return c
+}
+
+// WithDB 方法设置 Redis 数据库的编号，并返回客户端
+// The WithDB method sets the number of the Redis database and returns the client
+func (c *RespClient) WithDB(db int) *RespClient {
+	c.db = db
+	return c
+}
+
+// WithTimeout 方法设置连接和读写的超时时间，并返回客户端
+// The WithTimeout method sets the connection and read/write timeout and returns the client
+func (c *RespClient) WithTimeout(timeout time.Duration) *RespClient {
+	c.timeout = timeout
+	return c
+}
+
+// WithMaxIdle 方法设置最大空闲连接数，并返回客户端，需要在使用客户端之前调用
+// The WithMaxIdle method sets the maximum number of idle connections and returns the client, it must be called before the client is used
+func (c *RespClient) WithMaxIdle(maxIdle int) *RespClient {
+	c.idle = make(chan *respConn, maxIdle)
+	return c
+}
+
+// Do 方法执行一个 Redis 命令并返回结果
+// The Do method executes a Redis command and returns the result
+func (c *RespClient) Do(ctx context.Context, args ...any) (any, error) {
+	// 获取一个连接
+	// Get a connection
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 执行命令，如果发生网络错误，则关闭连接，否则将连接放回连接池
+	// Execute the command, close the connection if a network error occurs, otherwise put the connection back to the pool
+	reply, err := c.do(ctx, conn, args...)
+	if err != nil {
+		var redisErr RedisError
+		if !errors.As(err, &redisErr) {
+			_ = conn.conn.Close()
+			return nil, err
+		}
+	}
+	c.put(conn)
+
+	return reply, err
+}
+
+// Close 方法关闭客户端和所有空闲连接
+// The Close method closes the client and all idle connections
+func (c *RespClient) Close() {
+	c.once.Do(func() {
+		close(c.closed)
+		for {
+			select {
+			case conn := <-c.idle:
+				_ = conn.conn.Close()
+			default:
+				return
+			}
+		}
+	})
+}
+
+// get 方法从连接池获取一个空闲连接，如果没有空闲连接，则创建一个新的连接
+// The get method gets an idle connection from the pool, or creates a new connection if there is none
+func (c *RespClient) get(ctx context.Context) (*respConn, error) {
+	select {
+	case <-c.closed:
+		return nil, ErrRespClientClosed
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	// 创建一个新的连接
+	// Create a new connection
+	dialer := net.Dialer{Timeout: c.timeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &respConn{conn: nc, rd: bufio.NewReader(nc), wr: bufio.NewWriter(nc)}
+
+	// 如果设置了密码或数据库，则先进行认证和选择数据库
+	// If a password or database is set, authenticate and select the database first
+	if len(c.password) > 0 {
+		if _, err = c.do(ctx, conn, "AUTH", c.password); err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+	}
+	if c.db > 0 {
+		if _, err = c.do(ctx, conn, "SELECT", c.db); err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// put 方法将连接放回连接池，如果连接池已满或客户端已关闭，则关闭连接
+// The put method puts the connection back to the pool, and closes the connection if the pool is full or the client is closed
+func (c *RespClient) put(conn *respConn) {
+	select {
+	case <-c.closed:
+		_ = conn.conn.Close()
+		return
+	default:
+	}
+
+	select {
+	case c.idle <- conn:
+	default:
+		_ = conn.conn.Close()
+	}
+}
+
+// do 方法在连接上发送一个命令并读取结果
+// The do method sends a command on the connection and reads the result
+func (c *RespClient) do(ctx context.Context, conn *respConn, args ...any) (any, error) {
+	// 设置读写的截止时间，取上下文截止时间和超时时间中较早的一个
+	// Set the read/write deadline, taking the earlier of the context deadline and the timeout
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if err := writeRespCommand(conn.wr, args); err != nil {
+		return nil, err
+	}
+	if err := conn.wr.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readRespReply(conn.rd)
+}
+
+// writeRespCommand 是一个函数，将命令以 RESP 数组的格式写入
+// writeRespCommand is a function that writes the command in the format of a RESP array
+func writeRespCommand(w *bufio.Writer, args []any) error {
+	_, _ = w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			s = fmt.Sprint(v)
+		}
+
+		_, _ = w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n")
+		_, _ = w.WriteString(s)
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readRespReply 是一个函数，读取一个 RESP 结果。长度超过上限的行、批量字符串和数组以及嵌套过深的数组返回 ErrUnexpectedRedisReply，不会按照网络中的长度分配内存
+// readRespReply is a function that reads a RESP reply. Lines, bulk strings and arrays whose size exceeds the limit and arrays nested too deeply return ErrUnexpectedRedisReply, memory is not allocated by the size from the network
+func readRespReply(r *bufio.Reader) (any, error) {
+	return readRespValue(r, 0)
+}
+
+// readRespLine 是一个函数，读取 RESP 结果中以 "\n" 结尾的一行，行的长度超过 maxRespLineSize 时返回 ErrUnexpectedRedisReply
+// readRespLine is a function that reads a line ending with "\n" in a RESP reply, it returns ErrUnexpectedRedisReply when the line is longer than maxRespLineSize
+func readRespLine(r *bufio.Reader) (string, error) {
+	// 按缓冲区的大小分段读取，在超过上限之前停止
+	// Read in chunks of the buffer size, and stop before exceeding the limit
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxRespLineSize {
+			return "", ErrUnexpectedRedisReply
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+// readRespValue 是一个函数，读取嵌套深度为 depth 的 RESP 结果，深度超过 maxRespDepth 时返回 ErrUnexpectedRedisReply
+// readRespValue is a function that reads a RESP reply at the nesting depth depth, it returns ErrUnexpectedRedisReply when the depth exceeds maxRespDepth
+func readRespValue(r *bufio.Reader, depth int) (any, error) {
+	if depth > maxRespDepth {
+		return nil, ErrUnexpectedRedisReply
+	}
+
+	line, err := readRespLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrUnexpectedRedisReply
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	// 简单字符串
+	// Simple string
+	case '+':
+		return line[1:], nil
+
+	// 错误
+	// Error
+	case '-':
+		return nil, RedisError(line[1:])
+
+	// 整数
+	// Integer
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	// 批量字符串
+	// Bulk string
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		if size > maxRespBulkSize {
+			return nil, ErrUnexpectedRedisReply
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+
+	// 数组
+	// Array
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		if size > maxRespArraySize {
+			return nil, ErrUnexpectedRedisReply
+		}
+		values := make([]any, size)
+		for i := range values {
+			if values[i], err = readRespValue(r, depth+1); err != nil {
+				var redisErr RedisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				values[i] = redisErr
+			}
+		}
+		return values, nil
+
+	default:
+		return nil, ErrUnexpectedRedisReply
+	}
+}
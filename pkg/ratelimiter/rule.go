@@ -0,0 +1,391 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrInvalidRuleName 是规则名称为空、包含不允许的字符或者在规则集中重复时 panic 的错误
+// ErrInvalidRuleName is the error of the panic when a rule name is empty, contains characters that are not allowed or is duplicated in the rule set
+var ErrInvalidRuleName = errors.New("invalid rule name")
+
+// Rule 是一条限流规则，包含路由匹配条件 (方法和路径模式) 以及这条规则自己的速率、突发、键函数和优先级
+// Rule is a rate limiting rule, containing the route condition (method and path pattern) and its own rate, burst, key function and priority
+type Rule struct {
+	// name 是规则的名称，在规则集中唯一
+	// name is the name of the rule, unique in the rule set
+	name string
+
+	// method 是匹配的 HTTP 方法，为空或 "*" 时匹配所有方法
+	// method is the HTTP method to match, all methods are matched when it is empty or "*"
+	method string
+
+	// pattern 是匹配的路径模式
+	// pattern is the path pattern to match
+	pattern string
+
+	// segments 是路径模式按 "/" 切分后的片段
+	// segments is the segments of the path pattern split by "/"
+	segments []string
+
+	// rate 是规则的每秒限制速率，为 0 时使用配置的速率
+	// rate is the limit rate per second of the rule, the rate of the configuration is used when it is 0
+	rate float64
+
+	// burst 是规则的限制突发，为 0 时使用配置的突发
+	// burst is the limit burst of the rule, the burst of the configuration is used when it is 0
+	burst int
+
+	// keyFunc 是规则的键函数，为 nil 时使用配置的键函数
+	// keyFunc is the key function of the rule, the key function of the configuration is used when it is nil
+	keyFunc KeyFunc
+
+	// priority 是规则的优先级，优先级高的规则先匹配
+	// priority is the priority of the rule, rules with higher priority are matched first
+	priority int
+
+	// shadow 表示规则是否处于影子模式，为 nil 时使用配置的影子模式
+	// shadow indicates whether the rule is in shadow mode, the shadow mode of the configuration is used when it is nil
+	shadow *bool
+}
+
+// NewRule 是一个函数，返回一条新的限流规则。
+// 路径模式按 "/" 分段匹配，":name" 匹配任意一个非空的段，"*name" 或 "*" 只能是最后一段，匹配剩余的所有段，其他段需要完全相等，
+// 例如 "/users/:id" 匹配 "/users/1"，"/static/*filepath" 匹配 "/static/js/app.js"
+// NewRule is a function that returns a new rate limiting rule.
+// The path pattern is matched segment by segment split by "/", ":name" matches any non-empty segment, "*name" or "*" can only be the last segment and matches all remaining segments, other segments must be equal,
+// e.g. "/users/:id" matches "/users/1", "/static/*filepath" matches "/static/js/app.js"
+func NewRule(name, method, pattern string) *Rule {
+	return &Rule{
+		name:     name,
+		method:   strings.ToUpper(method),
+		pattern:  pattern,
+		segments: splitPath(pattern),
+	}
+}
+
+// WithRate 方法设置规则的每秒限制速率，并返回规则
+// The WithRate method sets the limit rate per second of the rule and returns the rule
+func (r *Rule) WithRate(rate float64) *Rule {
+	r.rate = rate
+	return r
+}
+
+// WithBurst 方法设置规则的限制突发，并返回规则
+// The WithBurst method sets the limit burst of the rule and returns the rule
+func (r *Rule) WithBurst(burst int) *Rule {
+	r.burst = burst
+	return r
+}
+
+// WithKeyFunc 方法设置规则的键函数，并返回规则
+// The WithKeyFunc method sets the key function of the rule and returns the rule
+func (r *Rule) WithKeyFunc(fn KeyFunc) *Rule {
+	r.keyFunc = fn
+	return r
+}
+
+// WithPriority 方法设置规则的优先级，并返回规则
+// The WithPriority method sets the priority of the rule and returns the rule
+func (r *Rule) WithPriority(priority int) *Rule {
+	r.priority = priority
+	return r
+}
+
+// WithShadow 方法设置规则是否处于影子模式，并返回规则。设置后覆盖配置的影子模式，所以一条规则可以执行限流，同时另一条规则只观察
+// The WithShadow method sets whether the rule is in shadow mode and returns the rule. Once set, it overrides the shadow mode of the configuration, so one rule can enforce its limit while another only observes
+func (r *Rule) WithShadow(shadow bool) *Rule {
+	r.shadow = &shadow
+	return r
+}
+
+// GetName 方法返回规则的名称
+// The GetName method returns the name of the rule
+func (r *Rule) GetName() string {
+	return r.name
+}
+
+// Match 方法判断请求是否匹配规则的方法和路径模式
+// The Match method reports whether the request matches the method and path pattern of the rule
+func (r *Rule) Match(req *http.Request) bool {
+	// 如果方法不匹配，则不匹配
+	// If the method does not match, it does not match
+	if len(r.method) > 0 && r.method != "*" && r.method != req.Method {
+		return false
+	}
+
+	return matchSegments(r.segments, req.URL.Path)
+}
+
+// splitPath 是一个函数，将路径按 "/" 切分，并去掉空的段
+// splitPath is a function that splits the path by "/" and drops empty segments
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// matchSegments 是一个函数，逐段判断路径是否匹配路径模式的片段，匹配过程不分配内存
+// matchSegments is a function that reports whether the path matches the segments of the path pattern segment by segment, without allocating memory
+func matchSegments(segments []string, path string) bool {
+	path = strings.Trim(path, "/")
+
+	for _, segment := range segments {
+		// 通配符匹配剩余的所有段
+		// The wildcard matches all remaining segments
+		if segment[0] == '*' {
+			return true
+		}
+
+		// 路径已经没有更多的段
+		// There are no more segments in the path
+		if len(path) == 0 {
+			return false
+		}
+
+		// 取出路径的下一段
+		// Take the next segment of the path
+		part := path
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			part, path = path[:i], path[i+1:]
+		} else {
+			path = ""
+		}
+
+		// 参数匹配任意一个非空的段，其他段需要完全相等
+		// A parameter matches any non-empty segment, other segments must be equal
+		if segment[0] == ':' {
+			if len(part) == 0 {
+				return false
+			}
+			continue
+		}
+		if segment != part {
+			return false
+		}
+	}
+
+	return len(path) == 0
+}
+
+// RuleSet 是一个规则集，规则按照优先级从高到低排列，优先级相同的规则保持添加的顺序
+// RuleSet is a rule set, the rules are ordered by priority from high to low, rules with the same priority keep the order in which they were added
+type RuleSet struct {
+	// rules 是排好序的规则
+	// rules is the sorted rules
+	rules []*Rule
+}
+
+// NewRuleSet 是一个函数，返回一个包含指定规则的规则集
+// NewRuleSet is a function that returns a rule set containing the specified rules
+func NewRuleSet(rules ...*Rule) *RuleSet {
+	s := &RuleSet{}
+	for _, rule := range rules {
+		s.Add(rule)
+	}
+	return s
+}
+
+// Add 方法向规则集添加一条规则，并返回规则集。
+// 规则名称会作为快照文件名的后缀和存储键的前缀，所以必须非空、在规则集中唯一，并且只包含字母、数字、"_" 和 "-"，否则 panic
+// The Add method adds a rule to the rule set and returns the rule set.
+// The rule name is used as the suffix of the snapshot file name and the prefix of the store keys, so it must be non-empty, unique in the rule set and contain only letters, digits, "_" and "-", otherwise it panics
+func (s *RuleSet) Add(rule *Rule) *RuleSet {
+	// 检查规则名称的字符，并且不能与已有的规则重复
+	// Check the characters of the rule name, and it must not duplicate an existing rule
+	if !isRuleNameValid(rule.name) {
+		panic(fmt.Errorf("%w: %q", ErrInvalidRuleName, rule.name))
+	}
+	for _, r := range s.rules {
+		if r.name == rule.name {
+			panic(fmt.Errorf("%w: duplicate %q", ErrInvalidRuleName, rule.name))
+		}
+	}
+
+	s.rules = append(s.rules, rule)
+	sort.SliceStable(s.rules, func(i, j int) bool {
+		return s.rules[i].priority > s.rules[j].priority
+	})
+	return s
+}
+
+// isRuleNameValid 是一个函数，检查规则名称是否非空并且只包含字母、数字、"_" 和 "-"
+// isRuleNameValid is a function that checks whether the rule name is non-empty and contains only letters, digits, "_" and "-"
+func isRuleNameValid(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Rules 方法返回排好序的规则
+// The Rules method returns the sorted rules
+func (s *RuleSet) Rules() []*Rule {
+	return s.rules
+}
+
+// Match 方法返回第一条匹配请求的规则的下标，如果没有规则匹配，则返回 -1
+// The Match method returns the index of the first rule matching the request, or -1 if no rule matches
+func (s *RuleSet) Match(req *http.Request) int {
+	for i, rule := range s.rules {
+		if rule.Match(req) {
+			return i
+		}
+	}
+	return -1
+}
+
+// RuleRateLimiter 是一个按规则限流的限流器，一个中间件按照规则集选择第一条匹配的规则，每条规则使用独立的桶
+// RuleRateLimiter is a rate limiter that limits by rules, one middleware picks the first matching rule from the rule set, and each rule uses its own buckets
+type RuleRateLimiter struct {
+	// config 是规则集共用的配置
+	// config is the configuration shared by the rule set
+	config *Config
+
+	// rules 是创建时规则集中的规则，之后向规则集添加的规则不会生效
+	// rules is the rules in the rule set at creation time, rules added to the rule set afterwards do not take effect
+	rules *RuleSet
+
+	// limiters 是每条规则的限流器，与规则一一对应
+	// limiters is the rate limiter of each rule, corresponding to the rules in the rule set one by one
+	limiters []*IpRateLimiter
+
+	// handlers 是每条规则的限流器的处理函数
+	// handlers is the handler function of the rate limiter of each rule
+	handlers []gin.HandlerFunc
+
+	// once 是一个 sync.Once 类型的变量，用于确保限流器只被停止一次
+	// once is a variable of type sync.Once, used to ensure that the rate limiters are stopped only once
+	once sync.Once
+}
+
+// NewRuleRateLimiter 是一个函数，接收一个配置和一个规则集，返回一个新的按规则限流的限流器。
+// 每条规则的限流器使用配置的副本，其中速率、突发和键函数被规则中设置的值覆盖。规则名称和 RuleSet.Add 一样被检查
+// NewRuleRateLimiter is a function that takes a configuration and a rule set, and returns a new rate limiter that limits by rules.
+// The rate limiter of each rule uses a copy of the configuration, in which the rate, burst and key function are overridden by the values set in the rule. The rule names are checked as in RuleSet.Add
+func NewRuleRateLimiter(config *Config, rules *RuleSet) *RuleRateLimiter {
+	config = isConfigValid(config)
+	if rules == nil {
+		rules = NewRuleSet()
+	}
+
+	rl := &RuleRateLimiter{
+		config:   config,
+		rules:    NewRuleSet(rules.rules...),
+		limiters: make([]*IpRateLimiter, 0, len(rules.rules)),
+		handlers: make([]gin.HandlerFunc, 0, len(rules.rules)),
+		once:     sync.Once{},
+	}
+
+	// 为每条规则创建一个独立的限流器
+	// Create an independent rate limiter for each rule
+	for _, rule := range rl.rules.rules {
+		limiter := NewIpRateLimiter(ruleConfig(config, rule))
+		rl.limiters = append(rl.limiters, limiter)
+		rl.handlers = append(rl.handlers, limiter.HandlerFunc())
+	}
+
+	return rl
+}
+
+// ruleConfig 是一个函数，返回规则使用的配置副本
+// ruleConfig is a function that returns the copy of the configuration used by the rule
+func ruleConfig(config *Config, rule *Rule) *Config {
+	// IP 白名单不复制，所有规则共用规则集的配置的白名单
+	// The IP whitelist is not copied, all rules share the whitelist of the configuration of the rule set
+	c := *config
+	c.rule = rule.name
+
+	if rule.rate > 0 {
+		c.rate = rule.rate
+	}
+	if rule.burst > 0 {
+		c.burst = rule.burst
+	}
+	if rule.keyFunc != nil {
+		c.keyFunc = rule.keyFunc
+	}
+	if rule.shadow != nil {
+		c.shadow = *rule.shadow
+	}
+
+	// 每个规则的限流器使用各自的快照文件，在文件名后面加上规则的名称
+	// The limiter of each rule uses its own snapshot file, the name of the rule is appended to the file name
+	if len(c.snapshotFile) > 0 {
+		c.snapshotFile += "." + rule.name
+	}
+
+	// 多个规则共享同一个存储时，在存储中的键的前面加上规则的名称，避免不同规则的桶互相影响
+	// When multiple rules share the same store, prefix the keys in the store with the name of the rule, so that the buckets of different rules do not affect each other
+	if c.store != nil {
+		c.keyPrefix = rule.name + DefaultCompositeKeySeparator
+	}
+
+	return &c
+}
+
+// GetLimiter 方法返回指定名称的规则的限流器，如果规则不存在，则返回 nil
+// The GetLimiter method returns the rate limiter of the rule with the specified name, or nil if the rule does not exist
+func (rl *RuleRateLimiter) GetLimiter(name string) *IpRateLimiter {
+	for i, rule := range rl.rules.rules {
+		if rule.name == name {
+			return rl.limiters[i]
+		}
+	}
+	return nil
+}
+
+// AddIp 方法向所有规则共用的 IP 白名单添加 IP 地址和 CIDR 网段，无法解析的项被忽略
+// The AddIp method adds IP addresses and CIDR networks to the IP whitelist shared by all rules, items that cannot be parsed are ignored
+func (rl *RuleRateLimiter) AddIp(ips ...string) {
+	rl.config.ipWhitelist.Add(ips...)
+}
+
+// RemoveIp 方法从所有规则共用的 IP 白名单删除之前添加的 IP 地址和 CIDR 网段
+// The RemoveIp method removes IP addresses and CIDR networks added before from the IP whitelist shared by all rules
+func (rl *RuleRateLimiter) RemoveIp(ips ...string) {
+	rl.config.ipWhitelist.Remove(ips...)
+}
+
+// ReplaceIpList 方法使用指定的 IP 地址和 CIDR 网段替换所有规则共用的 IP 白名单
+// The ReplaceIpList method replaces the IP whitelist shared by all rules with the specified IP addresses and CIDR networks
+func (rl *RuleRateLimiter) ReplaceIpList(ips []string) {
+	rl.config.ipWhitelist.Replace(ips)
+}
+
+// Stop 方法用于停止所有规则的限流器
+// The Stop method is used to stop the rate limiters of all rules
+func (rl *RuleRateLimiter) Stop() {
+	rl.once.Do(func() {
+		for _, limiter := range rl.limiters {
+			limiter.Stop()
+		}
+	})
+}
+
+// HandlerFunc 返回一个 gin.HandlerFunc，用于处理请求
+// HandlerFunc returns a gin.HandlerFunc for processing requests
+func (rl *RuleRateLimiter) HandlerFunc() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// 选择第一条匹配的规则，交给这条规则的限流器处理
+		// Pick the first matching rule and hand it over to the rate limiter of this rule
+		if i := rl.rules.Match(ctx.Request); i >= 0 {
+			rl.handlers[i](ctx)
+			return
+		}
+
+		// 如果没有规则匹配，则不进行限流
+		// If no rule matches, do not limit
+		applyDecision(ctx, rl.config, &Decision{Allowed: true, Skipped: true})
+	}
+}
@@ -0,0 +1,173 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRule_Match(t *testing.T) {
+	cases := []struct {
+		method, pattern string
+		reqMethod, path string
+		match           bool
+	}{
+		{"GET", "/users/:id", http.MethodGet, "/users/1", true},
+		{"get", "/users/:id", http.MethodGet, "/users/1/", true},
+		{"GET", "/users/:id", http.MethodPost, "/users/1", false},
+		{"GET", "/users/:id", http.MethodGet, "/users", false},
+		{"GET", "/users/:id", http.MethodGet, "/users/1/orders", false},
+		{"", "/users/:id/orders", http.MethodDelete, "/users/1/orders", true},
+		{"*", "/static/*filepath", http.MethodGet, "/static/js/app.js", true},
+		{"*", "/static/*", http.MethodGet, "/static", true},
+		{"*", "/static/*", http.MethodGet, "/assets/app.js", false},
+		{"", "/", http.MethodGet, "/", true},
+		{"", "/", http.MethodGet, "/users", false},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.reqMethod, c.path, nil)
+		assert.Equal(t, c.match, NewRule("test", c.method, c.pattern).Match(req), "%s %s %s %s", c.method, c.pattern, c.reqMethod, c.path)
+	}
+}
+
+func TestRuleSet_Priority(t *testing.T) {
+	rules := NewRuleSet(
+		NewRule("api", "", "/api/*"),
+		NewRule("login", http.MethodPost, "/api/login").WithPriority(10),
+		NewRule("other", "", "/api/*"),
+	)
+
+	// Rules with higher priority come first, rules with the same priority keep their order
+	names := make([]string, 0, 3)
+	for _, rule := range rules.Rules() {
+		names = append(names, rule.GetName())
+	}
+	assert.Equal(t, []string{"login", "api", "other"}, names)
+
+	assert.Equal(t, 0, rules.Match(httptest.NewRequest(http.MethodPost, "/api/login", nil)))
+	assert.Equal(t, 1, rules.Match(httptest.NewRequest(http.MethodGet, "/api/login", nil)))
+	assert.Equal(t, -1, rules.Match(httptest.NewRequest(http.MethodGet, "/health", nil)))
+}
+
+func TestRuleRateLimiter(t *testing.T) {
+	rules := NewRuleSet(
+		NewRule("login", http.MethodPost, "/login").WithBurst(1),
+		NewRule("users", http.MethodGet, "/users/:id").WithBurst(3),
+	)
+	limiter := NewRuleRateLimiter(NewConfig().WithBurst(2), rules)
+	defer limiter.Stop()
+
+	router := gin.New()
+	router.Use(limiter.HandlerFunc())
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "OK") }
+	router.POST("/login", ok)
+	router.GET("/users/:id", ok)
+	router.GET("/health", ok)
+
+	request := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = com.TestEndpoint2
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// Each rule has its own burst
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/login"))
+	assert.Equal(t, http.StatusTooManyRequests, request(http.MethodPost, "/login"))
+
+	// Each rule has its own buckets, and all paths of a pattern share them
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/users/"+string(rune('1'+i))))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, request(http.MethodGet, "/users/1"))
+
+	// Requests matching no rule are not limited
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/health"))
+	}
+
+	// The limiter of each rule can be looked up by name
+	assert.Equal(t, 3, limiter.GetLimiter("users").GetLimiter(com.TestIpAddress2).Burst())
+	assert.Nil(t, limiter.GetLimiter("missing"))
+}
+
+func TestRuleRateLimiter_AddIp(t *testing.T) {
+	rules := NewRuleSet(
+		NewRule("login", http.MethodPost, "/login").WithBurst(1),
+		NewRule("users", http.MethodGet, "/users/:id").WithBurst(1),
+	)
+	limiter := NewRuleRateLimiter(NewConfig(), rules)
+	defer limiter.Stop()
+
+	router := gin.New()
+	router.Use(limiter.HandlerFunc())
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "OK") }
+	router.POST("/login", ok)
+	router.GET("/users/:id", ok)
+
+	request := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.32.4.1:80"
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// The whitelist is shared by all rules
+	limiter.AddIp("10.32.4.0/24")
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, request(http.MethodPost, "/login"))
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/users/1"))
+	}
+
+	limiter.ReplaceIpList(nil)
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/login"))
+	assert.Equal(t, http.StatusTooManyRequests, request(http.MethodPost, "/login"))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/users/1"))
+	assert.Equal(t, http.StatusTooManyRequests, request(http.MethodGet, "/users/1"))
+}
+
+func TestRuleRateLimiter_Store(t *testing.T) {
+	store := NewMemoryStore()
+	defer store.Stop()
+
+	// Rules sharing a store do not share buckets
+	rules := NewRuleSet(NewRule("a", "", "/a"), NewRule("b", "", "/b"))
+	limiter := NewRuleRateLimiter(NewConfig().WithStore(store), rules)
+	defer limiter.Stop()
+
+	router := gin.New()
+	router.Use(limiter.HandlerFunc())
+	router.GET("/:name", func(c *gin.Context) { c.String(http.StatusOK, "OK") })
+
+	for _, path := range []string{"/a", "/b"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = com.TestEndpoint2
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+}
+
+func TestRuleSet_InvalidName(t *testing.T) {
+	for _, name := range []string{"", "a/b", "../users", "a|b", "a.b", "a b"} {
+		assert.PanicsWithError(t, ErrInvalidRuleName.Error()+": "+strconv.Quote(name), func() {
+			NewRuleSet(NewRule(name, "", "/"))
+		}, name)
+	}
+
+	// Names must be unique
+	assert.Panics(t, func() {
+		NewRuleSet(NewRule("users", "", "/users"), NewRule("users", "", "/users/:id"))
+	})
+	assert.NotPanics(t, func() {
+		NewRuleSet(NewRule("users-v2_1", "", "/users"), NewRule("Users", "", "/users/:id"))
+	})
+}
@@ -0,0 +1,205 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotVersion 是快照格式的版本
+// SnapshotVersion is the version of the snapshot format
+const SnapshotVersion = 1
+
+// DefaultSnapshotInterval 是默认的定期快照间隔
+// DefaultSnapshotInterval is the default interval of periodic snapshots
+var DefaultSnapshotInterval = time.Minute
+
+// ErrInvalidSnapshot 是快照无法解析或者版本不受支持时返回的错误
+// ErrInvalidSnapshot is the error returned when a snapshot cannot be parsed or its version is not supported
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// SnapshotErrorCallback 是一个可选的回调接口，配置的回调实现这个接口时，在快照文件无法读取或者写入时被调用
+// SnapshotErrorCallback is an optional callback interface, when the callback of the configuration implements it, it is called when the snapshot file cannot be read or written
+type SnapshotErrorCallback interface {
+	// OnRestoreError 是一个方法，当创建限流器时无法从快照文件恢复状态时被调用，接收文件路径和错误作为参数
+	// OnRestoreError is a method that is called when the state cannot be restored from the snapshot file while creating the limiter, it takes the file path and the error as parameters
+	OnRestoreError(path string, err error)
+
+	// OnSnapshotError 是一个方法，当定期快照或者停止时的最后一次快照无法写入文件时被调用，接收文件路径和错误作为参数
+	// OnSnapshotError is a method that is called when a periodic snapshot or the last snapshot when stopping cannot be written to the file, it takes the file path and the error as parameters
+	OnSnapshotError(path string, err error)
+}
+
+// snapshot 是限流器状态的快照，使用 JSON 编码
+// snapshot is the snapshot of the limiter state, it is encoded as JSON
+type snapshot struct {
+	// Version 是快照格式的版本
+	// Version is the version of the snapshot format
+	Version int `json:"version"`
+
+	// Entries 是每个键的状态
+	// Entries is the state of each key
+	Entries []snapshotEntry `json:"entries"`
+}
+
+// snapshotEntry 是一个键的状态，只有令牌没有满的键才会被保存
+// snapshotEntry is the state of a key, only keys whose tokens are not full are saved
+type snapshotEntry struct {
+	// Key 是限流的键
+	// Key is the rate limiting key
+	Key string `json:"key"`
+
+	// Tokens 是保存时剩余的令牌数量
+	// Tokens is the number of tokens remaining when saved
+	Tokens float64 `json:"tokens"`
+
+	// UpdatedAt 是保存时间的 Unix 纳秒数
+	// UpdatedAt is the time of saving in Unix nanoseconds
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// Snapshot 方法将每个键的剩余令牌写入 w，令牌已满的键不会被写入。配置了存储时状态保存在存储中，快照为空
+// The Snapshot method writes the remaining tokens of each key to w, keys whose tokens are full are not written. When a store is configured, the state is kept in the store and the snapshot is empty
+func (rl *IpRateLimiter) Snapshot(w io.Writer) error {
+	// 在每个段的锁内读取每个键在同一时间的剩余令牌
+	// Read the remaining tokens of each key at the same time within the lock of each segment
+	now := time.Now()
+	s := snapshot{Version: SnapshotVersion, Entries: []snapshotEntry{}}
+	if rl.config.Load().store == nil {
+		rl.cache.Range(func(key string, limiter Limiter) bool {
+			if tokens := limiter.TokensAt(now); tokens < float64(limiter.Burst()) {
+				s.Entries = append(s.Entries, snapshotEntry{Key: key, Tokens: tokens, UpdatedAt: now.UnixNano()})
+			}
+			return true
+		})
+	}
+
+	return json.NewEncoder(w).Encode(&s)
+}
+
+// Restore 方法从 r 读取 Snapshot 方法写入的快照，并将每个键的令牌恢复到快照中的数量加上之后按当前速率补充的数量。
+// 恢复只会减少令牌，不会增加令牌，所以对正在使用的键调用也是安全的。取出的令牌数量四舍五入到整数
+// The Restore method reads the snapshot written by the Snapshot method from r, and restores the tokens of each key to the number in the snapshot plus the tokens refilled since then at the current rate.
+// Restoring only takes tokens away and never adds them, so it is safe to call for keys in use. The number of tokens taken is rounded to the nearest integer
+func (rl *IpRateLimiter) Restore(r io.Reader) error {
+	// 解析快照并检查版本
+	// Parse the snapshot and check its version
+	var s snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, s.Version)
+	}
+	if rl.config.Load().store != nil {
+		return nil
+	}
+
+	// 恢复每个键的令牌，恢复时没有真实的请求，创建限流器时把占位请求传给限额解析函数
+	// Restore the tokens of each key, there is no real request while restoring, so the placeholder request is passed to the limit resolver when creating the rate limiter
+	now := time.Now()
+	req := newResolveRequest()
+	for _, e := range s.Entries {
+		limiter, handle := rl.acquire(e.Key, req)
+		restoreTokens(limiter, now, e.Tokens+now.Sub(time.Unix(0, e.UpdatedAt)).Seconds()*float64(limiter.Limit()))
+		handle.Release()
+	}
+
+	return nil
+}
+
+// restoreTokens 是一个函数，在时间 now 从限流器中取出整数个令牌，使剩余的令牌最接近 tokens，限流器的令牌少于 tokens 时什么也不做。
+// 等待模式下保存的令牌可能为负数，这时令牌被清空，而不是因为取出的数量超过容量而保持已满
+// restoreTokens is a function that takes a whole number of tokens from the limiter at time now, so that the remaining tokens are closest to tokens, nothing is done when the limiter has fewer tokens than tokens.
+// The saved tokens can be negative in wait mode, the tokens are emptied then, instead of staying full because the number taken exceeds the burst
+func restoreTokens(limiter Limiter, now time.Time, tokens float64) {
+	if tokens < 0 {
+		tokens = 0
+	}
+	if n := int(math.Round(limiter.TokensAt(now) - tokens)); n > 0 {
+		limiter.AllowN(now, n)
+	}
+}
+
+// SnapshotFile 方法将快照写入 path 指定的文件。快照先写入同一目录下的临时文件，再原子地重命名为 path，所以文件总是完整的
+// The SnapshotFile method writes the snapshot to the file at path. The snapshot is written to a temporary file in the same directory first and then atomically renamed to path, so the file is always complete
+func (rl *IpRateLimiter) SnapshotFile(path string) error {
+	// 在同一目录下创建临时文件，保证重命名是原子的
+	// Create the temporary file in the same directory, so that the rename is atomic
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	// 写入快照并同步到磁盘，然后重命名
+	// Write the snapshot and sync it to disk, then rename it
+	if err = rl.Snapshot(f); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// RestoreFile 方法从 path 指定的文件恢复快照，文件不存在时什么也不做
+// The RestoreFile method restores the snapshot from the file at path, nothing is done when the file does not exist
+func (rl *IpRateLimiter) RestoreFile(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return rl.Restore(f)
+}
+
+// snapshotLoop 方法每隔 interval 将快照写入 path 指定的文件，直到 done 被关闭。定期快照的错误通知 SnapshotErrorCallback，下一次快照会重试
+// The snapshotLoop method writes the snapshot to the file at path every interval, until done is closed. Errors of periodic snapshots are notified to SnapshotErrorCallback, the next snapshot tries again
+func (rl *IpRateLimiter) snapshotLoop(path string, interval time.Duration, done <-chan struct{}) {
+	// 在协程结束时，减少等待组的计数
+	// When the goroutine ends, decrease the count of the wait group
+	defer rl.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := rl.SnapshotFile(path); err != nil {
+				notifySnapshotError(rl.config.Load(), path, err)
+			}
+		}
+	}
+}
+
+// notifyRestoreError 是一个函数，如果配置的回调实现了 SnapshotErrorCallback 接口，则通知无法从快照文件恢复状态
+// notifyRestoreError is a function that notifies that the state cannot be restored from the snapshot file if the callback of the configuration implements the SnapshotErrorCallback interface
+func notifyRestoreError(config *Config, path string, err error) {
+	if callback, ok := config.callback.(SnapshotErrorCallback); ok {
+		callback.OnRestoreError(path, err)
+	}
+}
+
+// notifySnapshotError 是一个函数，如果配置的回调实现了 SnapshotErrorCallback 接口，则通知快照无法写入文件
+// notifySnapshotError is a function that notifies that the snapshot cannot be written to the file if the callback of the configuration implements the SnapshotErrorCallback interface
+func notifySnapshotError(config *Config, path string, err error) {
+	if callback, ok := config.callback.(SnapshotErrorCallback); ok {
+		callback.OnSnapshotError(path, err)
+	}
+}
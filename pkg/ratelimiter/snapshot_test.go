@@ -0,0 +1,202 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIpRateLimiter_Snapshot(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmTokenBucket, AlgorithmGCRA} {
+		conf := NewConfig().WithRate(0.001).WithBurst(5).WithAlgorithm(algorithm)
+		limiter := NewIpRateLimiter(conf)
+		router := testHeadersRouter(limiter.HandlerFunc())
+
+		// Only keys whose tokens are not full are saved
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.7.0.1:80"))
+		}
+		limiter.GetLimiter("10.7.0.2")
+		buf := bytes.Buffer{}
+		assert.NoError(t, limiter.Snapshot(&buf))
+		limiter.Stop()
+
+		s := snapshot{}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &s))
+		assert.Equal(t, SnapshotVersion, s.Version)
+		assert.Len(t, s.Entries, 1)
+		assert.Equal(t, "10.7.0.1", s.Entries[0].Key)
+		assert.InDelta(t, 2, s.Entries[0].Tokens, 0.1)
+
+		// A new limiter continues from the saved state
+		restored := NewIpRateLimiter(NewConfig().WithRate(0.001).WithBurst(5).WithAlgorithm(algorithm))
+		assert.NoError(t, restored.Restore(&buf))
+		assert.InDelta(t, 2, restored.GetLimiter("10.7.0.1").TokensAt(time.Now()), 0.1, algorithm)
+		router = testHeadersRouter(restored.HandlerFunc())
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.7.0.1:80"))
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.7.0.1:80"))
+		assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.7.0.1:80"))
+		restored.Stop()
+	}
+}
+
+func TestIpRateLimiter_RestoreRefill(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRate(1).WithBurst(5))
+	defer limiter.Stop()
+
+	// Tokens are refilled at the current rate for the time since the snapshot
+	updatedAt := time.Now().Add(-2 * time.Second).UnixNano()
+	data := fmt.Sprintf(`{"version":1,"entries":[{"key":"a","tokens":0,"updated_at":%d},{"key":"b","tokens":1,"updated_at":%d}]}`, updatedAt, time.Now().Add(-time.Hour).UnixNano())
+	assert.NoError(t, limiter.Restore(strings.NewReader(data)))
+	assert.InDelta(t, 2, limiter.GetLimiter("a").TokensAt(time.Now()), 0.1)
+
+	// A key that is full again is not charged
+	assert.InDelta(t, 5, limiter.GetLimiter("b").TokensAt(time.Now()), 0.1)
+}
+
+func TestIpRateLimiter_RestoreKeepsFewerTokens(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRate(0.001).WithBurst(5))
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.7.1.1:80"))
+	}
+
+	// Restoring never gives tokens back to a key in use
+	data := fmt.Sprintf(`{"version":1,"entries":[{"key":"10.7.1.1","tokens":4,"updated_at":%d}]}`, time.Now().UnixNano())
+	assert.NoError(t, limiter.Restore(strings.NewReader(data)))
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.7.1.1:80"))
+}
+
+func TestIpRateLimiter_RestoreInvalid(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig())
+	defer limiter.Stop()
+
+	assert.ErrorIs(t, limiter.Restore(strings.NewReader("not json")), ErrInvalidSnapshot)
+	assert.ErrorIs(t, limiter.Restore(strings.NewReader(`{"version":2,"entries":[]}`)), ErrInvalidSnapshot)
+	assert.Equal(t, 0, limiter.cache.Len())
+}
+
+func TestIpRateLimiter_SnapshotFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ratelimiter.json")
+
+	// A missing file is not an error
+	conf := NewConfig().WithRate(0.001).WithBurst(5).WithSnapshotFile(path).WithSnapshotInterval(10 * time.Millisecond)
+	limiter := NewIpRateLimiter(conf)
+	router := testHeadersRouter(limiter.HandlerFunc())
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.7.2.1:80"))
+	}
+
+	// The snapshot is written periodically
+	assert.Eventually(t, func() bool {
+		data, err := os.ReadFile(path)
+		return err == nil && bytes.Contains(data, []byte("10.7.2.1"))
+	}, time.Second, 10*time.Millisecond)
+
+	// The last snapshot is written when stopping, and no temporary file is left behind
+	assert.Equal(t, http.StatusOK, testDecisionRequest(router, com.TestUrlPath, "10.7.2.1:80"))
+	limiter.Stop()
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// A new limiter restores the state from the file
+	limiter = NewIpRateLimiter(NewConfig().WithRate(0.001).WithBurst(5).WithSnapshotFile(path))
+	defer limiter.Stop()
+	router = testHeadersRouter(limiter.HandlerFunc())
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.7.2.1:80"))
+}
+
+func TestRuleRateLimiter_SnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimiter.json")
+	rules := NewRuleSet(NewRule("users", http.MethodGet, "/users/:id"))
+	limiter := NewRuleRateLimiter(NewConfig().WithSnapshotFile(path), rules)
+	limiter.Stop()
+
+	// Each rule writes its own file
+	_, err := os.Stat(path + ".users")
+	assert.NoError(t, err)
+}
+
+func TestIpRateLimiter_RestoreNegativeTokens(t *testing.T) {
+	limiter := NewIpRateLimiter(NewConfig().WithRate(0.001).WithBurst(5))
+	defer limiter.Stop()
+
+	// A key in debt from wait mode comes back empty, not full
+	data := fmt.Sprintf(`{"version":1,"entries":[{"key":"10.7.3.1","tokens":-3,"updated_at":%d}]}`, time.Now().UnixNano())
+	assert.NoError(t, limiter.Restore(strings.NewReader(data)))
+	assert.InDelta(t, 0, limiter.GetLimiter("10.7.3.1").TokensAt(time.Now()), 0.1)
+	router := testHeadersRouter(limiter.HandlerFunc())
+	assert.Equal(t, http.StatusTooManyRequests, testDecisionRequest(router, com.TestUrlPath, "10.7.3.1:80"))
+}
+
+type testSnapshotCallback struct {
+	testCallback
+	mu       sync.Mutex
+	restored []error
+	saved    []error
+}
+
+func (c *testSnapshotCallback) OnRestoreError(path string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.restored = append(c.restored, err)
+}
+
+func (c *testSnapshotCallback) OnSnapshotError(path string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.saved = append(c.saved, err)
+}
+
+func TestIpRateLimiter_SnapshotFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	// An invalid file is reported, and the limiter starts empty
+	path := filepath.Join(dir, "ratelimiter.json")
+	assert.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	callback := &testSnapshotCallback{}
+	limiter := NewIpRateLimiter(NewConfig().WithCallback(callback).WithSnapshotFile(path))
+	assert.Len(t, callback.restored, 1)
+	assert.ErrorIs(t, callback.restored[0], ErrInvalidSnapshot)
+	assert.Equal(t, 0, limiter.cache.Len())
+	limiter.Stop()
+
+	// A snapshot that cannot be written is reported when stopping
+	callback = &testSnapshotCallback{}
+	limiter = NewIpRateLimiter(NewConfig().WithCallback(callback).WithSnapshotFile(filepath.Join(dir, "missing", "ratelimiter.json")))
+	limiter.Stop()
+	assert.Empty(t, callback.restored)
+	assert.Len(t, callback.saved, 1)
+}
+
+func TestIpRateLimiter_SnapshotFileResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimiter.json")
+	data := fmt.Sprintf(`{"version":1,"entries":[{"key":"pro","tokens":0,"updated_at":%d}]}`, time.Now().UnixNano())
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+	// The resolver gets a request it can read while the file is restored
+	resolver := func(key string, r *http.Request) (float64, int) {
+		if r.Header.Get("X-Plan") == "pro" {
+			return 0.001, 10
+		}
+		return 0.001, 5
+	}
+	conf := NewConfig().WithKeyFunc(KeyByHeader("X-Api-Key")).WithLimitResolver(resolver).WithSnapshotFile(path)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	assert.Equal(t, 5, limiter.GetLimiter("pro").Burst())
+	assert.InDelta(t, 0, limiter.GetLimiter("pro").TokensAt(time.Now()), 0.1)
+}
@@ -0,0 +1,128 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	itl "github.com/shengyanli1982/orbit-contrib/pkg/ratelimiter/internal"
+	"golang.org/x/time/rate"
+)
+
+// DefaultStoreGlobalKey 是 RateLimiter 在存储中使用的键
+// DefaultStoreGlobalKey is the key used by RateLimiter in the store
+var DefaultStoreGlobalKey = "global"
+
+// StoreFailurePolicy 是存储返回错误时请求的处理方式
+// StoreFailurePolicy is how a request is handled when the store returns an error
+type StoreFailurePolicy int8
+
+const (
+	// StoreFailOpen 表示存储返回错误时放行请求，避免存储故障导致所有请求被拒绝
+	// StoreFailOpen indicates that the request is allowed when the store returns an error, so that a store failure does not reject all requests
+	StoreFailOpen StoreFailurePolicy = iota
+
+	// StoreFailClosed 表示存储返回错误时拒绝请求，避免存储故障导致限流失效
+	// StoreFailClosed indicates that the request is rejected when the store returns an error, so that a store failure does not disable rate limiting
+	StoreFailClosed
+)
+
+// DefaultStoreFailurePolicy 是默认的存储返回错误时请求的处理方式
+// DefaultStoreFailurePolicy is the default way a request is handled when the store returns an error
+var DefaultStoreFailurePolicy = StoreFailOpen
+
+// StoreErrorCallback 是一个可选的回调接口，配置的回调实现这个接口时，在存储返回错误时被调用
+// StoreErrorCallback is an optional callback interface, when the callback of the configuration implements it, it is called when the store returns an error
+type StoreErrorCallback interface {
+	// OnStoreError 是一个方法，当存储为键取出令牌返回错误时被调用，接收键和错误作为参数
+	// OnStoreError is a method that is called when the store returns an error while taking tokens for the key, it takes the key and the error as parameters
+	OnStoreError(key string, err error)
+}
+
+// Store 是一个限流存储接口，多个进程共享同一个存储时，限流在所有进程之间生效
+// Store is a rate limiting store interface, when multiple processes share the same store, the limit takes effect across all processes
+type Store interface {
+	// Take 以原子方式从键对应的桶中取出 n 个令牌，桶的速率为 limit，容量为 burst，
+	// 桶在 ttl 内没有被访问时可以被删除，返回限流决策
+	// Take atomically takes n tokens from the bucket of the key, the bucket has a rate of limit and a capacity of burst,
+	// the bucket can be deleted when it is not accessed within ttl, and it returns the rate limiting decision
+	Take(ctx context.Context, key string, limit rate.Limit, burst int, n int, ttl time.Duration) (*Decision, error)
+}
+
+// MemoryStore 是一个内存存储，每个键使用一个令牌桶，行为与 IpRateLimiter 的本地缓存相同
+// MemoryStore is an in-memory store, each key uses a token bucket, and it behaves the same as the local cache of IpRateLimiter
+type MemoryStore struct {
+	// cache 是一个指向 itl.Cache 的指针，用于存储令牌桶
+	// cache is a pointer to itl.Cache, used to store token buckets
+	cache *itl.Cache[*rate.Limiter]
+
+	// once 是一个 sync.Once 类型的变量，用于确保缓存只被停止一次
+	// once is a variable of type sync.Once, used to ensure that the cache is stopped only once
+	once sync.Once
+}
+
+// NewMemoryStore 是一个函数，返回一个新的内存存储
+// NewMemoryStore is a function that returns a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{cache: itl.NewCache[*rate.Limiter](), once: sync.Once{}}
+}
+
+// Take 方法从键对应的令牌桶中取出 n 个令牌，如果桶的速率或容量发生变化，则先更新桶。
+// 内存存储中的桶由缓存的过期机制删除，ttl 参数不会被使用
+// The Take method takes n tokens from the token bucket of the key, the bucket is updated first if its rate or capacity has changed.
+// Buckets in the in-memory store are deleted by the expiration of the cache, the ttl parameter is not used
+func (s *MemoryStore) Take(_ context.Context, key string, limit rate.Limit, burst int, n int, _ time.Duration) (*Decision, error) {
+	// 从缓存中获取或创建一个令牌桶
+	// Get or create a token bucket from the cache
+	limiter, _ := s.cache.GetOrCreate(key, func() *rate.Limiter {
+		return rate.NewLimiter(limit, burst)
+	})
+
+	// 如果速率或容量发生了变化，则更新令牌桶
+	// If the rate or capacity has changed, update the token bucket
+	if limiter.Limit() != limit {
+		limiter.SetLimit(limit)
+	}
+	if limiter.Burst() != burst {
+		limiter.SetBurst(burst)
+	}
+
+	// 取出令牌，并根据令牌桶的状态生成决策
+	// Take the tokens and generate a decision based on the state of the token bucket
+	now := time.Now()
+	allowed := limiter.AllowN(now, n)
+
+	return newDecision(limiter, now, n, allowed), nil
+}
+
+// Stop 方法用于停止内存存储，释放缓存的资源
+// The Stop method is used to stop the in-memory store and release the resources of the cache
+func (s *MemoryStore) Stop() {
+	s.once.Do(func() {
+		s.cache.Stop()
+	})
+}
+
+// takeFromStore 是一个函数，从配置的存储中为键取出 n 个令牌并返回决策。
+// 存储返回错误时，按配置的 StoreFailurePolicy 放行或者拒绝请求，错误保存在决策的 StoreError 中，并通知 StoreErrorCallback
+// takeFromStore is a function that takes n tokens for the key from the store in the configuration and returns the decision.
+// When the store returns an error, the request is allowed or rejected by the configured StoreFailurePolicy, the error is saved in StoreError of the decision, and StoreErrorCallback is notified
+func takeFromStore(ctx *gin.Context, config *Config, key string, limits Limits, n int) *Decision {
+	limit := rate.Limit(limits.Rate)
+	decision, err := config.store.Take(ctx.Request.Context(), config.keyPrefix+key, limit, limits.Burst, n, windowOf(limit, limits.Burst))
+	if err == nil {
+		return decision
+	}
+
+	// 通知回调存储返回了错误
+	// Notify the callback that the store returned an error
+	if callback, ok := config.callback.(StoreErrorCallback); ok {
+		callback.OnStoreError(key, err)
+	}
+
+	if config.storeFailure == StoreFailClosed {
+		return &Decision{Limit: limits.Burst, Cost: n, StoreError: err}
+	}
+	return &Decision{Allowed: true, Limit: limits.Burst, Remaining: limits.Burst, Cost: n, StoreError: err}
+}
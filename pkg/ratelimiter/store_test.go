@@ -0,0 +1,333 @@
+package ratelimiter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func testRedisStore(t *testing.T) (*miniredis.Miniredis, *RespClient, *RedisStore) {
+	server := miniredis.RunT(t)
+	server.SetTime(testWindowStart)
+	client := NewRespClient(server.Addr())
+	t.Cleanup(client.Close)
+	return server, client, NewRedisStore(client)
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := NewMemoryStore()
+	defer store.Stop()
+
+	ctx := context.Background()
+
+	// The burst is used up, then the request is rejected
+	for i := 0; i < 2; i++ {
+		d, err := store.Take(ctx, com.TestIpAddress, 1, 2, 1, time.Second)
+		assert.NoError(t, err)
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 2, d.Limit)
+		assert.Equal(t, 1-i, d.Remaining)
+	}
+	d, err := store.Take(ctx, com.TestIpAddress, 1, 2, 1, time.Second)
+	assert.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Greater(t, d.RetryAfter, time.Duration(0))
+
+	// Other keys are not affected
+	d, err = store.Take(ctx, com.TestIpAddress2, 1, 2, 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+
+	// A larger burst is applied to the existing bucket
+	d, err = store.Take(ctx, com.TestIpAddress, 1, 4, 1, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, d.Limit)
+}
+
+func TestRedisStore_Take(t *testing.T) {
+	server, _, store := testRedisStore(t)
+	ctx := context.Background()
+
+	// The burst is used up, then the request is rejected
+	for i := 0; i < 3; i++ {
+		d, err := store.Take(ctx, com.TestIpAddress, 10, 3, 1, time.Second)
+		assert.NoError(t, err)
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 3, d.Limit)
+		assert.Equal(t, 2-i, d.Remaining)
+		assert.Equal(t, time.Duration(i+1)*100*time.Millisecond, d.Reset)
+	}
+	d, err := store.Take(ctx, com.TestIpAddress, 10, 3, 1, time.Second)
+	assert.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 100*time.Millisecond, d.RetryAfter)
+
+	// The state is kept in Redis under the prefixed key
+	assert.True(t, server.Exists(DefaultRedisKeyPrefix+com.TestIpAddress))
+
+	// One token is restored after the emission interval
+	server.SetTime(testWindowStart.Add(100 * time.Millisecond))
+	d, err = store.Take(ctx, com.TestIpAddress, 10, 3, 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+
+	// Other keys are not affected
+	d, err = store.Take(ctx, com.TestIpAddress2, 10, 3, 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 2, d.Remaining)
+
+	// More tokens than the burst can never be taken
+	d, err = store.Take(ctx, com.TestIpAddress2, 10, 3, 4, time.Second)
+	assert.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Greater(t, d.RetryAfter, time.Hour)
+}
+
+func TestRedisStore_Prefix(t *testing.T) {
+	server, _, store := testRedisStore(t)
+	store.WithPrefix("test:")
+
+	_, err := store.Take(context.Background(), com.TestIpAddress, 1, 1, 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, server.Exists("test:"+com.TestIpAddress))
+	assert.False(t, server.Exists(DefaultRedisKeyPrefix+com.TestIpAddress))
+}
+
+func TestRedisStore_TTL(t *testing.T) {
+	server, _, store := testRedisStore(t)
+
+	_, err := store.Take(context.Background(), com.TestIpAddress, 1, 1, 1, 5*time.Second)
+	assert.NoError(t, err)
+
+	// The key expires after the ttl when it is not accessed
+	assert.Equal(t, 5*time.Second, server.TTL(DefaultRedisKeyPrefix+com.TestIpAddress))
+	server.FastForward(5 * time.Second)
+	assert.False(t, server.Exists(DefaultRedisKeyPrefix+com.TestIpAddress))
+}
+
+func TestRedisStore_ScriptFlushed(t *testing.T) {
+	server, client, store := testRedisStore(t)
+	ctx := context.Background()
+
+	_, err := store.Take(ctx, com.TestIpAddress, 1, 2, 1, time.Second)
+	assert.NoError(t, err)
+
+	// The script is loaded again with EVAL after it is flushed
+	_, err = client.Do(ctx, "SCRIPT", "FLUSH")
+	assert.NoError(t, err)
+	d, err := store.Take(ctx, com.TestIpAddress, 1, 2, 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.True(t, server.Exists(DefaultRedisKeyPrefix+com.TestIpAddress))
+}
+
+func TestRedisStore_Inf(t *testing.T) {
+	store := NewRedisStore(RedisClientFunc(func(ctx context.Context, args ...any) (any, error) {
+		t.Fatal("redis should not be called")
+		return nil, nil
+	}))
+
+	d, err := store.Take(context.Background(), com.TestIpAddress, rate.Inf, 1, 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+}
+
+func TestRedisStore_UnexpectedReply(t *testing.T) {
+	store := NewRedisStore(RedisClientFunc(func(ctx context.Context, args ...any) (any, error) {
+		return "OK", nil
+	}))
+
+	_, err := store.Take(context.Background(), com.TestIpAddress, 1, 1, 1, time.Second)
+	assert.ErrorIs(t, err, ErrUnexpectedRedisReply)
+}
+
+func TestReadRespReply_SizeLimit(t *testing.T) {
+	read := func(reply string) (any, error) {
+		return readRespReply(bufio.NewReader(strings.NewReader(reply)))
+	}
+
+	// Sizes within the limits are read
+	v, err := read("$2\r\nok\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", v)
+	v, err = read("*2\r\n:1\r\n$-1\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{int64(1), nil}, v)
+
+	// Sizes over the limits are rejected before anything is allocated
+	_, err = read("$" + strconv.Itoa(maxRespBulkSize+1) + "\r\n")
+	assert.ErrorIs(t, err, ErrUnexpectedRedisReply)
+	_, err = read("*" + strconv.Itoa(maxRespArraySize+1) + "\r\n")
+	assert.ErrorIs(t, err, ErrUnexpectedRedisReply)
+	_, err = read("*1\r\n$9223372036854775807\r\n")
+	assert.ErrorIs(t, err, ErrUnexpectedRedisReply)
+
+	// Lines within the limit are read, even when they are longer than the buffer
+	long := strings.Repeat("a", maxRespLineSize-3)
+	v, err = read("+" + long + "\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, long, v)
+
+	// Longer lines are rejected without reading them to the end
+	_, err = read("+" + strings.Repeat("a", maxRespLineSize) + "\r\n")
+	assert.ErrorIs(t, err, ErrUnexpectedRedisReply)
+	_, err = read("+" + strings.Repeat("a", maxRespLineSize))
+	assert.ErrorIs(t, err, ErrUnexpectedRedisReply)
+
+	// Arrays nested up to the maximum depth are read, deeper arrays are rejected
+	v, err = read(strings.Repeat("*1\r\n", maxRespDepth) + ":1\r\n")
+	assert.NoError(t, err)
+	assert.NotNil(t, v)
+	_, err = read(strings.Repeat("*1\r\n", maxRespDepth+1) + ":1\r\n")
+	assert.ErrorIs(t, err, ErrUnexpectedRedisReply)
+}
+
+func TestRespClient_Do(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	client := NewRespClient(server.Addr()).WithPassword("secret").WithDB(1)
+	defer client.Close()
+
+	ctx := context.Background()
+
+	// Simple string, bulk string, integer, array and nil replies
+	reply, err := client.Do(ctx, "SET", "foo", "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+	reply, err = client.Do(ctx, "GET", "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", reply)
+	reply, err = client.Do(ctx, "INCRBY", "counter", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), reply)
+	reply, err = client.Do(ctx, "MGET", "foo", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"bar", nil}, reply)
+	reply, err = client.Do(ctx, "GET", "missing")
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+
+	// The database is selected on every connection
+	server.Select(1)
+	assert.True(t, server.Exists("foo"))
+
+	// Redis errors are returned as RedisError and the connection stays usable
+	_, err = client.Do(ctx, "INCR", "foo")
+	var redisErr RedisError
+	assert.True(t, errors.As(err, &redisErr))
+	reply, err = client.Do(ctx, "GET", "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", reply)
+
+	// The client can not be used after it is closed
+	client.Close()
+	_, err = client.Do(ctx, "GET", "foo")
+	assert.ErrorIs(t, err, ErrRespClientClosed)
+}
+
+func TestIpRateLimiter_Store(t *testing.T) {
+	_, _, store := testRedisStore(t)
+
+	// Two limiters sharing the same store behave like two replicas of the same service
+	conf := NewConfig().WithRate(1).WithBurst(2).WithStore(store)
+	limiters := []*IpRateLimiter{NewIpRateLimiter(conf), NewIpRateLimiter(conf)}
+	routers := make([]*gin.Engine, len(limiters))
+	for i, limiter := range limiters {
+		defer limiter.Stop()
+		routers[i] = testHeadersRouter(limiter.HandlerFunc())
+	}
+
+	// The burst is shared across the replicas
+	codes := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = com.TestEndpoint2
+		resp := httptest.NewRecorder()
+		routers[i%2].ServeHTTP(resp, req)
+		codes = append(codes, resp.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes)
+
+	// Nothing is stored in the local cache
+	assert.Nil(t, limiters[0].GetLimiter(com.TestIpAddress2))
+}
+
+func TestRateLimiter_StoreFailOpen(t *testing.T) {
+	store := NewRedisStore(RedisClientFunc(func(ctx context.Context, args ...any) (any, error) {
+		return nil, errors.New("connection refused")
+	}))
+	router := testHeadersRouter(NewRateLimiter(NewConfig().WithStore(store)).HandlerFunc())
+
+	// Requests are allowed when the store is unavailable
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = com.TestEndpoint2
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+}
+
+type testStoreErrorCallback struct {
+	testDecisionCallback
+	keys   []string
+	errors []error
+}
+
+func (c *testStoreErrorCallback) OnStoreError(key string, err error) {
+	c.keys = append(c.keys, key)
+	c.errors = append(c.errors, err)
+}
+
+func TestIpRateLimiter_StoreFailure(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	store := NewRedisStore(RedisClientFunc(func(ctx context.Context, args ...any) (any, error) {
+		return nil, errRefused
+	}))
+
+	for _, policy := range []StoreFailurePolicy{StoreFailOpen, StoreFailClosed} {
+		callback := &testStoreErrorCallback{}
+		conf := NewConfig().WithStore(store).WithStoreFailure(policy).WithCallback(callback).
+			WithMaxWait(time.Second).WithBanThreshold(1)
+		limiter := NewIpRateLimiter(conf)
+		decisions := []*Decision{}
+		router := testDecisionRouter(limiter.HandlerFunc(), &decisions)
+
+		// The error is reported to the callback and saved in the decision, and the request is allowed or rejected by the policy
+		want := http.StatusOK
+		if policy == StoreFailClosed {
+			want = http.StatusTooManyRequests
+		}
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, want, testDecisionRequest(router, com.TestUrlPath, com.TestEndpoint2))
+		}
+		assert.Equal(t, []string{com.TestIpAddress2, com.TestIpAddress2}, callback.keys)
+		assert.ErrorIs(t, callback.errors[0], errRefused)
+		if policy == StoreFailClosed {
+			assert.Len(t, callback.limited, 2)
+			assert.ErrorIs(t, callback.limited[0].StoreError, errRefused)
+		} else {
+			assert.Len(t, decisions, 2)
+			assert.ErrorIs(t, decisions[0].StoreError, errRefused)
+		}
+
+		// Rejections caused by the store do not ban the key
+		assert.Empty(t, limiter.ListBans())
+		limiter.Stop()
+	}
+}
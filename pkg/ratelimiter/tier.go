@@ -0,0 +1,337 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrInvalidTierSpec 表示层级规格字符串的格式无效
+// ErrInvalidTierSpec means the format of the tier spec string is invalid
+var ErrInvalidTierSpec = errors.New("invalid tier spec")
+
+// Tier 是一个限流层级，在 Period 时间内最多允许 Count 个请求，即速率为 Count/Period，突发为 Count
+// Tier is a rate limiting tier that allows at most Count requests per Period, that is, a rate of Count/Period and a burst of Count
+type Tier struct {
+	// Count 是一个周期内允许的请求数量
+	// Count is the number of requests allowed per period
+	Count int
+
+	// Period 是周期的长度
+	// Period is the length of the period
+	Period time.Duration
+}
+
+// NewTier 是一个函数，返回一个在 period 时间内最多允许 count 个请求的层级
+// NewTier is a function that returns a tier allowing at most count requests per period
+func NewTier(count int, period time.Duration) Tier {
+	return Tier{Count: count, Period: period}
+}
+
+// Rate 方法返回层级的每秒速率
+// The Rate method returns the rate per second of the tier
+func (t Tier) Rate() rate.Limit {
+	return rate.Limit(float64(t.Count) / t.Period.Seconds())
+}
+
+// String 方法返回层级的规格字符串，例如 "10/s" 或 "100/10m"
+// The String method returns the spec string of the tier, such as "10/s" or "100/10m"
+func (t Tier) String() string {
+	for _, u := range tierUnits {
+		if t.Period%u.period == 0 {
+			if n := t.Period / u.period; n > 1 {
+				return strconv.Itoa(t.Count) + "/" + strconv.FormatInt(int64(n), 10) + u.name
+			}
+			return strconv.Itoa(t.Count) + "/" + u.name
+		}
+	}
+	return strconv.Itoa(t.Count) + "/" + t.Period.String()
+}
+
+// tierUnits 是层级规格中支持的时间单位，从大到小排列
+// tierUnits is the time units supported in the tier spec, ordered from large to small
+var tierUnits = []struct {
+	name   string
+	period time.Duration
+}{
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// ParseTiers 是一个函数，解析以 ";" 分隔的层级规格字符串，例如 "10/s;500/m"。
+// 每个层级的格式为 "数量/周期"，周期是可选的倍数加上单位 ms、s、m、h 或 d，例如 "100/10s"
+// ParseTiers is a function that parses a tier spec string separated by ";", such as "10/s;500/m".
+// The format of each tier is "count/period", the period is an optional multiple followed by the unit ms, s, m, h or d, such as "100/10s"
+func ParseTiers(spec string) ([]Tier, error) {
+	tiers := make([]Tier, 0, strings.Count(spec, ";")+1)
+
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		tier, err := parseTier(part)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("%w: %q has no tiers", ErrInvalidTierSpec, spec)
+	}
+
+	return tiers, nil
+}
+
+// MustParseTiers 是一个函数，与 ParseTiers 相同，但是在规格无效时 panic，适合用于常量规格
+// MustParseTiers is a function like ParseTiers, but it panics if the spec is invalid, suitable for constant specs
+func MustParseTiers(spec string) []Tier {
+	tiers, err := ParseTiers(spec)
+	if err != nil {
+		panic(err)
+	}
+	return tiers
+}
+
+// parseTier 是一个函数，解析单个层级的规格
+// parseTier is a function that parses the spec of a single tier
+func parseTier(spec string) (Tier, error) {
+	countText, periodText, found := strings.Cut(spec, "/")
+	if !found {
+		return Tier{}, fmt.Errorf("%w: %q is not count/period", ErrInvalidTierSpec, spec)
+	}
+
+	// 解析数量
+	// Parse the count
+	count, err := strconv.Atoi(strings.TrimSpace(countText))
+	if err != nil || count <= 0 {
+		return Tier{}, fmt.Errorf("%w: invalid count in %q", ErrInvalidTierSpec, spec)
+	}
+
+	// 将周期拆分为倍数和单位
+	// Split the period into the multiple and the unit
+	periodText = strings.TrimSpace(periodText)
+	i := 0
+	for i < len(periodText) && periodText[i] >= '0' && periodText[i] <= '9' {
+		i++
+	}
+	multiple := 1
+	if i > 0 {
+		if multiple, err = strconv.Atoi(periodText[:i]); err != nil || multiple <= 0 {
+			return Tier{}, fmt.Errorf("%w: invalid period in %q", ErrInvalidTierSpec, spec)
+		}
+	}
+
+	// 查找单位
+	// Find the unit
+	for _, u := range tierUnits {
+		if periodText[i:] == u.name {
+			if int64(multiple) > math.MaxInt64/int64(u.period) {
+				break
+			}
+			return NewTier(count, time.Duration(multiple)*u.period), nil
+		}
+	}
+
+	return Tier{}, fmt.Errorf("%w: invalid period in %q", ErrInvalidTierSpec, spec)
+}
+
+// validTiers 是一个函数，返回数量和周期都大于 0 的层级
+// validTiers is a function that returns the tiers whose count and period are both greater than 0
+func validTiers(tiers []Tier) []Tier {
+	valid := tiers[:0:0]
+	for _, tier := range tiers {
+		if tier.Count > 0 && tier.Period > 0 {
+			valid = append(valid, tier)
+		}
+	}
+	return valid
+}
+
+// newConfigLimiter 是一个函数，根据配置的限流算法、指定的速率和突发，以及指定的层级和共享层级创建限流器。
+// 如果没有任何层级，则返回普通的限流器；如果只有共享层级，则指定的速率和突发作为自身的层级，它的速率和突发之后仍然可以修改
+// newConfigLimiter is a function that creates a limiter from the algorithm of the configuration, the specified rate and burst, and the specified tiers and shared tiers.
+// If there are no tiers at all, a plain limiter is returned; if there are only shared tiers, the specified rate and burst are used as its own tier, whose rate and burst can still be changed later
+func newConfigLimiter(config *Config, limits Limits, tiers []Tier, shared *MultiLimiter) Limiter {
+	if len(tiers) == 0 {
+		if shared == nil {
+			return NewLimiter(config.algorithm, rate.Limit(limits.Rate), limits.Burst)
+		}
+		return &MultiLimiter{limiters: []Limiter{NewLimiter(config.algorithm, rate.Limit(limits.Rate), limits.Burst)}, shared: shared, adjustable: true}
+	}
+	return newMultiLimiter(config.algorithm, tiers, shared)
+}
+
+// MultiLimiter 是一个多层级限流器，只有所有层级都允许时才会从每个层级取出令牌，
+// 所以一个层级拒绝请求时，其他层级的令牌不会被消耗
+// MultiLimiter is a multi-tier rate limiter, it takes tokens from every tier only when all tiers allow,
+// so when one tier rejects a request, the tokens of the other tiers are not consumed
+type MultiLimiter struct {
+	// mu 是保证检查和取出令牌原子性的互斥锁
+	// mu is the mutex that makes checking and taking tokens atomic
+	mu sync.Mutex
+
+	// limiters 是每个层级的限流器
+	// limiters is the rate limiter of each tier
+	limiters []Limiter
+
+	// shared 是与其他多层级限流器共享的层级，例如所有键共享的全局层级，在自身的锁之后加锁
+	// shared is the tiers shared with other multi-tier limiters, such as the global tiers shared by all keys, it is locked after the own lock
+	shared *MultiLimiter
+
+	// adjustable 表示自身只有一个由速率和突发组成的层级，SetLimit 和 SetBurst 修改这个层级
+	// adjustable indicates that it only has one own tier made of the rate and burst, which SetLimit and SetBurst change
+	adjustable bool
+}
+
+// NewMultiLimiter 是一个函数，返回一个由指定层级组成的多层级限流器，每个层级使用指定的限流算法
+// NewMultiLimiter is a function that returns a multi-tier rate limiter composed of the specified tiers, each tier uses the specified algorithm
+func NewMultiLimiter(algorithm Algorithm, tiers ...Tier) *MultiLimiter {
+	return newMultiLimiter(algorithm, tiers, nil)
+}
+
+// newMultiLimiter 是一个函数，返回一个由指定层级和共享层级组成的多层级限流器
+// newMultiLimiter is a function that returns a multi-tier rate limiter composed of the specified tiers and the shared tiers
+func newMultiLimiter(algorithm Algorithm, tiers []Tier, shared *MultiLimiter) *MultiLimiter {
+	limiters := make([]Limiter, 0, len(tiers))
+	for _, tier := range tiers {
+		limiters = append(limiters, NewLimiter(algorithm, tier.Rate(), tier.Count))
+	}
+	return &MultiLimiter{limiters: limiters, shared: shared}
+}
+
+// each 方法依次对自身和共享的每个层级调用 fn，fn 返回 false 时停止
+// The each method calls fn on each own and shared tier in order, and stops when fn returns false
+func (l *MultiLimiter) each(fn func(limiter Limiter) bool) bool {
+	for _, limiter := range l.limiters {
+		if !fn(limiter) {
+			return false
+		}
+	}
+	if l.shared != nil {
+		return l.shared.each(fn)
+	}
+	return true
+}
+
+// Limit 方法返回所有层级中最小的速率
+// The Limit method returns the smallest rate of all tiers
+func (l *MultiLimiter) Limit() rate.Limit {
+	limit := rate.Inf
+	l.each(func(limiter Limiter) bool {
+		if r := limiter.Limit(); r < limit {
+			limit = r
+		}
+		return true
+	})
+	return limit
+}
+
+// Burst 方法返回所有层级中最小的突发
+// The Burst method returns the smallest burst of all tiers
+func (l *MultiLimiter) Burst() int {
+	burst := math.MaxInt
+	l.each(func(limiter Limiter) bool {
+		if b := limiter.Burst(); b < burst {
+			burst = b
+		}
+		return true
+	})
+	return burst
+}
+
+// SetLimit 方法设置由速率和突发组成的自身层级的速率，例如只配置了全局层级的键的限流器，共享的层级不受影响。
+// 由 NewMultiLimiter 或者 WithTiers 的层级组成的限流器的速率在创建时确定，不会被修改
+// The SetLimit method sets the rate of the own tier made of the rate and burst, such as the limiter of a key when only global tiers are configured, the shared tiers are not affected.
+// The rates of a limiter composed of the tiers of NewMultiLimiter or WithTiers are fixed at creation and are not changed
+func (l *MultiLimiter) SetLimit(newLimit rate.Limit) {
+	if !l.adjustable {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limiters[0].SetLimit(newLimit)
+}
+
+// SetBurst 方法设置由速率和突发组成的自身层级的突发，共享的层级不受影响。由 NewMultiLimiter 或者 WithTiers 的层级组成的限流器的突发在创建时确定，不会被修改
+// The SetBurst method sets the burst of the own tier made of the rate and burst, the shared tiers are not affected. The bursts of a limiter composed of the tiers of NewMultiLimiter or WithTiers are fixed at creation and are not changed
+func (l *MultiLimiter) SetBurst(newBurst int) {
+	if !l.adjustable {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limiters[0].SetBurst(newBurst)
+}
+
+// Allow 方法是 AllowN(time.Now(), 1) 的简写
+// The Allow method is shorthand for AllowN(time.Now(), 1)
+func (l *MultiLimiter) Allow() bool {
+	return l.AllowN(time.Now(), 1)
+}
+
+// AllowN 方法判断在时间 t 是否允许 n 个请求，先检查所有层级，只有全部允许时才从每个层级取出令牌
+// The AllowN method reports whether n requests may happen at time t, it checks all tiers first and takes tokens from every tier only when all of them allow
+func (l *MultiLimiter) AllowN(t time.Time, n int) bool {
+	// 先锁住自身，再锁住共享的层级
+	// Lock itself first, then lock the shared tiers
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.shared != nil {
+		l.shared.mu.Lock()
+		defer l.shared.mu.Unlock()
+	}
+
+	// 检查每个层级是否有足够的令牌
+	// Check whether each tier has enough tokens
+	enough := l.each(func(limiter Limiter) bool {
+		return limiter.TokensAt(t) >= float64(n)
+	})
+	if !enough {
+		return false
+	}
+
+	// 所有层级都允许，从每个层级取出令牌
+	// All tiers allow, take tokens from each tier
+	l.each(func(limiter Limiter) bool {
+		limiter.AllowN(t, n)
+		return true
+	})
+
+	return true
+}
+
+// TokensAt 方法返回在时间 t 所有层级中最少的可用令牌数量
+// The TokensAt method returns the fewest tokens available at time t among all tiers
+func (l *MultiLimiter) TokensAt(t time.Time) float64 {
+	tokens := math.Inf(1)
+	l.each(func(limiter Limiter) bool {
+		tokens = math.Min(tokens, limiter.TokensAt(t))
+		return true
+	})
+	return tokens
+}
+
+// DelayAt 方法返回从时间 t 开始，直到所有层级都有 n 个令牌可用需要等待的时间
+// The DelayAt method returns the time to wait from time t until n tokens are available in all tiers
+func (l *MultiLimiter) DelayAt(t time.Time, n int) time.Duration {
+	var delay time.Duration
+	l.each(func(limiter Limiter) bool {
+		if d := delayAt(limiter, t, n); d > delay {
+			delay = d
+		}
+		return true
+	})
+	return delay
+}
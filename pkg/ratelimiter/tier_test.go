@@ -0,0 +1,132 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers("10/s;500/m")
+	assert.NoError(t, err)
+	assert.Equal(t, []Tier{NewTier(10, time.Second), NewTier(500, time.Minute)}, tiers)
+
+	// Spaces, empty parts and multiples of the unit are accepted
+	tiers, err = ParseTiers(" 100 / 10s ; ; 5/h;1/2d;3/500ms ")
+	assert.NoError(t, err)
+	assert.Equal(t, []Tier{
+		NewTier(100, 10*time.Second),
+		NewTier(5, time.Hour),
+		NewTier(1, 48*time.Hour),
+		NewTier(3, 500*time.Millisecond),
+	}, tiers)
+
+	// The spec string round trips
+	for _, tier := range tiers {
+		parsed, err := ParseTiers(tier.String())
+		assert.NoError(t, err)
+		assert.Equal(t, []Tier{tier}, parsed)
+	}
+	assert.Equal(t, "500/m", NewTier(500, time.Minute).String())
+	assert.Equal(t, "100/10s", NewTier(100, 10*time.Second).String())
+
+	for _, spec := range []string{"", ";", "10", "x/s", "0/s", "-1/s", "10/", "10/0s", "10/x", "10/s/m", "10/99999999999d"} {
+		_, err := ParseTiers(spec)
+		assert.ErrorIs(t, err, ErrInvalidTierSpec, spec)
+	}
+
+	assert.Panics(t, func() { MustParseTiers("10") })
+}
+
+func TestMultiLimiter_AllowN(t *testing.T) {
+	limiter := NewMultiLimiter(AlgorithmTokenBucket, MustParseTiers("3/s;2/m")...)
+
+	// The most restrictive tier applies
+	assert.Equal(t, 2, limiter.Burst())
+	assert.True(t, limiter.AllowN(testWindowStart, 1))
+	assert.True(t, limiter.AllowN(testWindowStart, 1))
+	assert.False(t, limiter.AllowN(testWindowStart, 1))
+
+	// The rejected request does not consume tokens of the other tiers
+	assert.InDelta(t, 1, limiter.limiters[0].TokensAt(testWindowStart), 1e-9)
+	assert.InDelta(t, 0, limiter.TokensAt(testWindowStart), 1e-9)
+
+	// The request waits for the slowest tier
+	assert.Equal(t, 30*time.Second, limiter.DelayAt(testWindowStart, 1))
+}
+
+func TestIpRateLimiter_Tiers(t *testing.T) {
+	// 2 requests per second per key, and 3 requests per second globally
+	conf := NewConfig().
+		WithTiers(MustParseTiers("2/s")...).
+		WithGlobalTiers(MustParseTiers("3/s")...).
+		WithKeyFunc(KeyByHeader("X-Api-Key"))
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	request := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = com.TestEndpoint2
+		req.Header.Set("X-Api-Key", key)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// The tier of the key rejects the third request
+	assert.Equal(t, http.StatusOK, request("a"))
+	assert.Equal(t, http.StatusOK, request("a"))
+	assert.Equal(t, http.StatusTooManyRequests, request("a"))
+
+	// The global tier rejects the second request of another key
+	assert.Equal(t, http.StatusOK, request("b"))
+	assert.Equal(t, http.StatusTooManyRequests, request("b"))
+
+	// The rejected request did not consume the token of the key
+	assert.GreaterOrEqual(t, limiter.GetLimiter("b").(*MultiLimiter).limiters[0].TokensAt(time.Now()), 0.99)
+}
+
+func TestIpRateLimiter_GlobalTiersSetLimits(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmGCRA} {
+		// Only global tiers, so the rate and burst form the tier of each key
+		plans := map[string]Limits{}
+		mu := sync.Mutex{}
+		conf := NewConfig().WithRate(1).WithBurst(2).WithAlgorithm(algorithm).
+			WithGlobalTiers(MustParseTiers("1000/s")...).
+			WithKeyFunc(KeyByHeader("X-Api-Key")).
+			WithLimitResolver(func(key string, r *http.Request) (float64, int) {
+				mu.Lock()
+				defer mu.Unlock()
+				return plans[key].Rate, plans[key].Burst
+			})
+		limiter := NewIpRateLimiter(conf)
+		router := testHeadersRouter(limiter.HandlerFunc())
+		assert.Equal(t, http.StatusOK, testLimitRequest(router, "a"), algorithm)
+		assert.Equal(t, 2, limiter.GetLimiter("a").Burst(), algorithm)
+
+		// SetRate and SetBurst change the tier of the existing key
+		limiter.SetRate(5)
+		limiter.SetBurst(4)
+		assert.Equal(t, rate.Limit(5), limiter.GetLimiter("a").Limit(), algorithm)
+		assert.Equal(t, 4, limiter.GetLimiter("a").Burst(), algorithm)
+
+		// RefreshLimits applies the resolved limits to the tier of the key
+		mu.Lock()
+		plans["a"] = Limits{Rate: 20, Burst: 10}
+		mu.Unlock()
+		limiter.RefreshLimits("a")
+		assert.Equal(t, rate.Limit(20), limiter.GetLimiter("a").Limit(), algorithm)
+		assert.Equal(t, 10, limiter.GetLimiter("a").Burst(), algorithm)
+
+		// The global tier is not changed
+		assert.Equal(t, 1000, limiter.global.Burst(), algorithm)
+		limiter.Stop()
+	}
+}
@@ -0,0 +1,202 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// DefaultMaxWaiters 是等待模式下每个键默认的最大等待请求数量
+// DefaultMaxWaiters is the default maximum number of waiting requests per key in wait mode
+var DefaultMaxWaiters = 64
+
+// Reserver 是一个可选的接口，限流器实现这个接口时，等待模式会预留令牌，而不是在等待之后重新尝试
+// Reserver is an optional interface, when a limiter implements it, the wait mode reserves tokens instead of trying again after waiting
+type Reserver interface {
+	// ReserveN 在时间 t 预留 n 个令牌，返回令牌可用之前需要等待的时间和取消预留的函数，
+	// 如果需要等待的时间超过 maxWait，则不预留并返回 false
+	// ReserveN reserves n tokens at time t, and returns the time to wait before the tokens are available and a function to cancel the reservation,
+	// if the time to wait exceeds maxWait, nothing is reserved and false is returned
+	ReserveN(t time.Time, n int, maxWait time.Duration) (time.Duration, func(), bool)
+}
+
+// waitDecision 是一个函数，在等待模式下为被拒绝的请求排队等待，返回等待之后的决策。
+// 如果键的等待队列已满，则直接返回原来的决策
+// waitDecision is a function that queues a rejected request in wait mode, and returns the decision after waiting.
+// If the wait queue of the key is full, the original decision is returned directly
+func waitDecision(ctx *gin.Context, config *Config, queue *waitQueue, key string, limits Limits, limiter Limiter, now time.Time, n int, d *Decision) *Decision {
+	// 进入键的等待队列，离开时释放位置
+	// Enter the wait queue of the key, and release the place when leaving
+	if !queue.enter(key, config.maxWaiters) {
+		return d
+	}
+	defer queue.leave(key)
+
+	// 存储不支持预留，所以在等待之后重新从存储中取出令牌
+	// Stores do not support reservations, so the token is taken from the store again after waiting
+	if config.store != nil {
+		return waitPoll(ctx.Request.Context(), now, config.maxWait, func(time.Time) *Decision {
+			return takeFromStore(ctx, config, key, limits, n)
+		})
+	}
+
+	return waitLimiter(ctx.Request.Context(), limiter, now, n, config.maxWait)
+}
+
+// reserveN 是一个函数，在时间 t 为限流器预留 n 个令牌，如果限流器不支持预留，则 supported 为 false
+// reserveN is a function that reserves n tokens of the limiter at time t, supported is false if the limiter does not support reservations
+func reserveN(limiter Limiter, t time.Time, n int, maxWait time.Duration) (delay time.Duration, cancel func(), ok bool, supported bool) {
+	switch l := limiter.(type) {
+	// 令牌桶使用 rate.Reservation 预留令牌
+	// The token bucket uses rate.Reservation to reserve tokens
+	case *rate.Limiter:
+		r := l.ReserveN(t, n)
+		if !r.OK() {
+			return 0, nil, false, true
+		}
+		if delay = r.DelayFrom(t); delay > maxWait {
+			r.CancelAt(t)
+			return 0, nil, false, true
+		}
+		return delay, func() { r.CancelAt(time.Now()) }, true, true
+
+	case Reserver:
+		delay, cancel, ok = l.ReserveN(t, n, maxWait)
+		return delay, cancel, ok, true
+	}
+
+	return 0, nil, false, false
+}
+
+// waitLimiter 是一个函数，等待限流器允许 n 个请求，等待时间不超过 maxWait，上下文被取消时停止等待。
+// 支持预留的限流器会先预留令牌再等待，其他限流器在等待之后重新尝试
+// waitLimiter is a function that waits for the limiter to allow n requests, the wait does not exceed maxWait and stops when the context is canceled.
+// Limiters supporting reservations reserve the token before waiting, other limiters try again after waiting
+func waitLimiter(ctx context.Context, limiter Limiter, now time.Time, n int, maxWait time.Duration) *Decision {
+	delay, cancel, ok, supported := reserveN(limiter, now, n, maxWait)
+
+	// 如果限流器不支持预留，则在等待之后重新尝试
+	// If the limiter does not support reservations, try again after waiting
+	if !supported {
+		return waitPoll(ctx, now, maxWait, func(t time.Time) *Decision {
+			return newDecision(limiter, t, n, limiter.AllowN(t, n))
+		})
+	}
+
+	// 如果无法在最大等待时间内预留令牌，则拒绝请求
+	// If the token cannot be reserved within the maximum wait time, reject the request
+	if !ok {
+		return newDecision(limiter, now, n, false)
+	}
+
+	// 等待预留的令牌可用，如果上下文被取消，则取消预留并拒绝请求
+	// Wait for the reserved token to be available, if the context is canceled, cancel the reservation and reject the request
+	if !sleepContext(ctx, delay) {
+		cancel()
+		return newDecision(limiter, time.Now(), n, false)
+	}
+
+	return newDecision(limiter, time.Now(), n, true)
+}
+
+// waitPoll 是一个函数，反复调用 take 直到请求被允许，每次等待决策中的 RetryAfter，
+// 如果下一次尝试会超过最大等待时间、上下文被取消或者存储返回了错误，则返回被拒绝的决策
+// waitPoll is a function that calls take repeatedly until the request is allowed, waiting for the RetryAfter of the decision each time,
+// it returns the rejected decision if the next try would exceed the maximum wait time, the context is canceled or the store returned an error
+func waitPoll(ctx context.Context, now time.Time, maxWait time.Duration, take func(t time.Time) *Decision) *Decision {
+	deadline := now.Add(maxWait)
+
+	for {
+		d := take(now)
+		if d.Allowed || d.StoreError != nil || now.Add(d.RetryAfter).After(deadline) {
+			return d
+		}
+
+		// 至少等待 1 毫秒，避免在 RetryAfter 为 0 时空转
+		// Wait at least 1 millisecond to avoid spinning when RetryAfter is 0
+		delay := d.RetryAfter
+		if delay < time.Millisecond {
+			delay = time.Millisecond
+		}
+		if !sleepContext(ctx, delay) {
+			return d
+		}
+
+		now = time.Now()
+	}
+}
+
+// sleepContext 是一个函数，等待 d 的时间，如果上下文在此之前被取消，则返回 false
+// sleepContext is a function that waits for d, and returns false if the context is canceled before that
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// waitQueue 是一个等待队列，记录每个键正在等待的请求数量
+// waitQueue is a wait queue that records the number of waiting requests of each key
+type waitQueue struct {
+	// mu 是保护 waiters 的互斥锁
+	// mu is the mutex protecting waiters
+	mu sync.Mutex
+
+	// waiters 是每个键正在等待的请求数量
+	// waiters is the number of waiting requests of each key
+	waiters map[string]int
+}
+
+// newWaitQueue 是一个函数，返回一个新的等待队列
+// newWaitQueue is a function that returns a new wait queue
+func newWaitQueue() *waitQueue {
+	return &waitQueue{waiters: make(map[string]int)}
+}
+
+// enter 方法让一个请求进入键的等待队列，如果队列中的请求数量已经达到 max，则返回 false
+// The enter method lets a request enter the wait queue of the key, and returns false if the number of requests in the queue has reached max
+func (q *waitQueue) enter(key string, max int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.waiters[key] >= max {
+		return false
+	}
+	q.waiters[key]++
+
+	return true
+}
+
+// leave 方法让一个请求离开键的等待队列，队列为空时删除键
+// The leave method lets a request leave the wait queue of the key, and deletes the key when the queue is empty
+func (q *waitQueue) leave(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.waiters[key] <= 1 {
+		delete(q.waiters, key)
+		return
+	}
+	q.waiters[key]--
+}
+
+// count 方法返回键正在等待的请求数量
+// The count method returns the number of waiting requests of the key
+func (q *waitQueue) count(key string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.waiters[key]
+}
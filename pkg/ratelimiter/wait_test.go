@@ -0,0 +1,152 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func testWaitRequest(router *gin.Engine, ctx context.Context) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, com.TestUrlPath, nil).WithContext(ctx)
+	req.RemoteAddr = com.TestEndpoint2
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestRateLimiter_WaitMode(t *testing.T) {
+	// 10 tokens per second with a burst of 1, requests wait up to 500ms
+	conf := NewConfig().WithRate(10).WithBurst(1).WithMaxWait(500 * time.Millisecond)
+	router := testHeadersRouter(NewRateLimiter(conf).HandlerFunc())
+
+	// The requests are delayed instead of rejected
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp := testWaitRequest(router, context.Background())
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.Header().Get(HeaderRetryAfter))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestRateLimiter_WaitExceeded(t *testing.T) {
+	// 1 token per second with a burst of 1, requests wait up to 100ms
+	conf := NewConfig().WithRate(1).WithBurst(1).WithMaxWait(100 * time.Millisecond)
+	router := testHeadersRouter(NewRateLimiter(conf).HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testWaitRequest(router, context.Background()).Code)
+
+	// The wait would exceed the bound, so the request is rejected without waiting
+	start := time.Now()
+	resp := testWaitRequest(router, context.Background())
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get(HeaderRetryAfter))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestIpRateLimiter_WaitCanceled(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmTokenBucket, AlgorithmGCRA, AlgorithmFixedWindow} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			conf := NewConfig().WithRate(1).WithBurst(1).WithAlgorithm(algorithm).WithMaxWait(5 * time.Second)
+			limiter := NewIpRateLimiter(conf)
+			defer limiter.Stop()
+			router := testHeadersRouter(limiter.HandlerFunc())
+
+			assert.Equal(t, http.StatusOK, testWaitRequest(router, context.Background()).Code)
+
+			// The request is rejected once its context is canceled
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			assert.Equal(t, http.StatusTooManyRequests, testWaitRequest(router, ctx).Code)
+			assert.Less(t, time.Since(start), time.Second)
+
+			// The reserved token is returned
+			assert.Greater(t, limiter.GetLimiter(com.TestIpAddress2).TokensAt(time.Now()), float64(-0.5))
+		})
+	}
+}
+
+func TestIpRateLimiter_MaxWaiters(t *testing.T) {
+	conf := NewConfig().WithRate(1).WithBurst(1).WithMaxWait(5 * time.Second).WithMaxWaiters(1)
+	limiter := NewIpRateLimiter(conf)
+	defer limiter.Stop()
+	router := testHeadersRouter(limiter.HandlerFunc())
+
+	assert.Equal(t, http.StatusOK, testWaitRequest(router, context.Background()).Code)
+
+	// The first limited request waits in the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() {
+		done <- testWaitRequest(router, ctx).Code
+	}()
+	assert.Eventually(t, func() bool {
+		return limiter.queue.count(com.TestIpAddress2) == 1
+	}, time.Second, time.Millisecond)
+
+	// The queue of the key is full, so the next request is rejected immediately
+	start := time.Now()
+	assert.Equal(t, http.StatusTooManyRequests, testWaitRequest(router, context.Background()).Code)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// The waiting request leaves the queue when it is canceled
+	cancel()
+	assert.Equal(t, http.StatusTooManyRequests, <-done)
+	assert.Equal(t, 0, limiter.queue.count(com.TestIpAddress2))
+}
+
+func TestIpRateLimiter_WaitPoll(t *testing.T) {
+	store := NewMemoryStore()
+	defer store.Stop()
+
+	// Window limiters and stores cannot reserve tokens, so they try again after waiting
+	confs := map[string]*Config{
+		"window": NewConfig().WithAlgorithm(AlgorithmSlidingLog),
+		"store":  NewConfig().WithStore(store),
+	}
+	for name, conf := range confs {
+		t.Run(name, func(t *testing.T) {
+			limiter := NewIpRateLimiter(conf.WithRate(10).WithBurst(1).WithMaxWait(500 * time.Millisecond))
+			defer limiter.Stop()
+			router := testHeadersRouter(limiter.HandlerFunc())
+
+			for i := 0; i < 3; i++ {
+				assert.Equal(t, http.StatusOK, testWaitRequest(router, context.Background()).Code)
+			}
+		})
+	}
+}
+
+func TestGCRALimiter_ReserveN(t *testing.T) {
+	limiter := NewGCRALimiter(10, 2)
+
+	// The burst is reserved without waiting
+	for i := 0; i < 2; i++ {
+		delay, _, ok := limiter.ReserveN(testWindowStart, 1, 0)
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(0), delay)
+	}
+
+	// The next token is available after the emission interval
+	_, _, ok := limiter.ReserveN(testWindowStart, 1, 50*time.Millisecond)
+	assert.False(t, ok)
+	delay, cancel, ok := limiter.ReserveN(testWindowStart, 1, time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, delay)
+	assert.InDelta(t, -1, limiter.TokensAt(testWindowStart), 1e-9)
+
+	// Canceling returns the reserved token
+	cancel()
+	assert.InDelta(t, 0, limiter.TokensAt(testWindowStart), 1e-9)
+
+	// More tokens than the burst can never be reserved
+	_, _, ok = limiter.ReserveN(testWindowStart, 3, time.Hour)
+	assert.False(t, ok)
+}
@@ -0,0 +1,508 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// FixedWindowLimiter 是固定窗口限流器，在每个长度为 burst/rate 的对齐窗口内最多允许 burst 个请求
+// FixedWindowLimiter is a fixed window rate limiter, it allows at most burst requests in each aligned window of length burst/rate
+type FixedWindowLimiter struct {
+	// mu 是一个互斥锁，用于保护限流器的状态
+	// mu is a mutex used to protect the state of the limiter
+	mu sync.Mutex
+
+	// limit 是每秒限制速率
+	// limit is the limit rate per second
+	limit rate.Limit
+
+	// burst 是每个窗口内允许的请求数量
+	// burst is the number of requests allowed in each window
+	burst int
+
+	// window 是窗口长度
+	// window is the window length
+	window time.Duration
+
+	// start 是当前窗口的开始时间
+	// start is the start time of the current window
+	start time.Time
+
+	// count 是当前窗口内已经允许的请求数量
+	// count is the number of requests already allowed in the current window
+	count int
+}
+
+// NewFixedWindowLimiter 是一个函数，返回一个新的固定窗口限流器
+// NewFixedWindowLimiter is a function that returns a new fixed window rate limiter
+func NewFixedWindowLimiter(r rate.Limit, b int) *FixedWindowLimiter {
+	return &FixedWindowLimiter{limit: r, burst: b, window: windowOf(r, b)}
+}
+
+// Limit 方法返回每秒限制速率
+// The Limit method returns the limit rate per second
+func (l *FixedWindowLimiter) Limit() rate.Limit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Burst 方法返回每个窗口内允许的请求数量
+// The Burst method returns the number of requests allowed in each window
+func (l *FixedWindowLimiter) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.burst
+}
+
+// SetLimit 方法设置每秒限制速率，并重新计算窗口长度
+// The SetLimit method sets the limit rate per second and recalculates the window length
+func (l *FixedWindowLimiter) SetLimit(newLimit rate.Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = newLimit
+	l.window = windowOf(l.limit, l.burst)
+}
+
+// SetBurst 方法设置每个窗口内允许的请求数量，并重新计算窗口长度
+// The SetBurst method sets the number of requests allowed in each window and recalculates the window length
+func (l *FixedWindowLimiter) SetBurst(newBurst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.burst = newBurst
+	l.window = windowOf(l.limit, l.burst)
+}
+
+// Allow 方法是 AllowN(time.Now(), 1) 的简写
+// The Allow method is shorthand for AllowN(time.Now(), 1)
+func (l *FixedWindowLimiter) Allow() bool {
+	return l.AllowN(time.Now(), 1)
+}
+
+// AllowN 方法判断在时间 t 是否允许 n 个请求，如果允许则计入当前窗口
+// The AllowN method reports whether n requests may happen at time t, and counts them in the current window if allowed
+func (l *FixedWindowLimiter) AllowN(t time.Time, n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 如果速率为无限，则总是允许
+	// If the rate is infinite, always allow
+	if l.limit == rate.Inf {
+		return true
+	}
+
+	// 推进窗口，如果请求数量超过了剩余数量，则不允许
+	// Advance the window, if the number of requests exceeds the remaining number, do not allow
+	l.advance(t)
+	if l.count+n > l.burst {
+		return false
+	}
+
+	l.count += n
+	return true
+}
+
+// TokensAt 方法返回在时间 t 当前窗口内剩余的请求数量
+// The TokensAt method returns the number of requests remaining in the window at time t
+func (l *FixedWindowLimiter) TokensAt(t time.Time) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == rate.Inf {
+		return float64(l.burst)
+	}
+
+	// 如果时间 t 已经不在当前窗口内，则剩余数量为 burst
+	// If time t is no longer in the current window, the remaining number is burst
+	if !t.Before(l.start.Add(l.window)) {
+		return float64(l.burst)
+	}
+
+	return float64(l.burst - l.count)
+}
+
+// DelayAt 方法返回从时间 t 开始，直到 n 个请求可以被允许需要等待的时间
+// The DelayAt method returns the time to wait from time t until n requests can be allowed
+func (l *FixedWindowLimiter) DelayAt(t time.Time, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 如果速率为无限，或者时间 t 已经不在当前窗口内且 n 不超过 burst，则不需要等待
+	// If the rate is infinite, or time t is no longer in the current window and n does not exceed burst, there is no need to wait
+	end := l.start.Add(l.window)
+	if l.limit == rate.Inf || (n <= l.burst && (!t.Before(end) || l.count+n <= l.burst)) {
+		return 0
+	}
+
+	// 如果 n 超过了 burst，则永远不会被允许
+	// If n exceeds burst, it will never be allowed
+	if n > l.burst {
+		return time.Duration(math.MaxInt64)
+	}
+
+	// 否则需要等待到当前窗口结束
+	// Otherwise wait until the end of the current window
+	return end.Sub(t)
+}
+
+// advance 方法在时间 t 超过当前窗口时开始一个新的对齐窗口
+// The advance method starts a new aligned window when time t is past the current window
+func (l *FixedWindowLimiter) advance(t time.Time) {
+	if !t.Before(l.start.Add(l.window)) {
+		l.start = t.Truncate(l.window)
+		l.count = 0
+	}
+}
+
+// SlidingWindowLimiter 是滑动窗口计数器限流器，使用上一个窗口和当前窗口的加权计数来估计最近一个窗口内的请求数量
+// SlidingWindowLimiter is a sliding window counter rate limiter, it estimates the number of requests in the last window with the weighted counts of the previous and current windows
+type SlidingWindowLimiter struct {
+	// mu 是一个互斥锁，用于保护限流器的状态
+	// mu is a mutex used to protect the state of the limiter
+	mu sync.Mutex
+
+	// limit 是每秒限制速率
+	// limit is the limit rate per second
+	limit rate.Limit
+
+	// burst 是每个窗口内允许的请求数量
+	// burst is the number of requests allowed in each window
+	burst int
+
+	// window 是窗口长度
+	// window is the window length
+	window time.Duration
+
+	// start 是当前窗口的开始时间
+	// start is the start time of the current window
+	start time.Time
+
+	// prev 是上一个窗口内的请求数量
+	// prev is the number of requests in the previous window
+	prev int
+
+	// curr 是当前窗口内的请求数量
+	// curr is the number of requests in the current window
+	curr int
+}
+
+// NewSlidingWindowLimiter 是一个函数，返回一个新的滑动窗口计数器限流器
+// NewSlidingWindowLimiter is a function that returns a new sliding window counter rate limiter
+func NewSlidingWindowLimiter(r rate.Limit, b int) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{limit: r, burst: b, window: windowOf(r, b)}
+}
+
+// Limit 方法返回每秒限制速率
+// The Limit method returns the limit rate per second
+func (l *SlidingWindowLimiter) Limit() rate.Limit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Burst 方法返回每个窗口内允许的请求数量
+// The Burst method returns the number of requests allowed in each window
+func (l *SlidingWindowLimiter) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.burst
+}
+
+// SetLimit 方法设置每秒限制速率，并重新计算窗口长度
+// The SetLimit method sets the limit rate per second and recalculates the window length
+func (l *SlidingWindowLimiter) SetLimit(newLimit rate.Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = newLimit
+	l.window = windowOf(l.limit, l.burst)
+}
+
+// SetBurst 方法设置每个窗口内允许的请求数量，并重新计算窗口长度
+// The SetBurst method sets the number of requests allowed in each window and recalculates the window length
+func (l *SlidingWindowLimiter) SetBurst(newBurst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.burst = newBurst
+	l.window = windowOf(l.limit, l.burst)
+}
+
+// Allow 方法是 AllowN(time.Now(), 1) 的简写
+// The Allow method is shorthand for AllowN(time.Now(), 1)
+func (l *SlidingWindowLimiter) Allow() bool {
+	return l.AllowN(time.Now(), 1)
+}
+
+// AllowN 方法判断在时间 t 是否允许 n 个请求，如果允许则计入当前窗口
+// The AllowN method reports whether n requests may happen at time t, and counts them in the current window if allowed
+func (l *SlidingWindowLimiter) AllowN(t time.Time, n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 如果速率为无限，则总是允许
+	// If the rate is infinite, always allow
+	if l.limit == rate.Inf {
+		return true
+	}
+
+	// 推进窗口，如果估计的请求数量加上 n 超过了 burst，则不允许
+	// Advance the window, if the estimated number of requests plus n exceeds burst, do not allow
+	l.advance(t)
+	if l.estimate(t)+float64(n) > float64(l.burst) {
+		return false
+	}
+
+	l.curr += n
+	return true
+}
+
+// TokensAt 方法返回在时间 t 最近一个窗口内剩余的请求数量
+// The TokensAt method returns the number of requests remaining in the last window at time t
+func (l *SlidingWindowLimiter) TokensAt(t time.Time) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == rate.Inf {
+		return float64(l.burst)
+	}
+
+	// 在状态的副本上推进窗口，避免修改限流器的状态
+	// Advance the window on a copy of the state to avoid modifying the state of the limiter
+	s := SlidingWindowLimiter{limit: l.limit, burst: l.burst, window: l.window, start: l.start, prev: l.prev, curr: l.curr}
+	s.advance(t)
+
+	return float64(s.burst) - s.estimate(t)
+}
+
+// DelayAt 方法返回从时间 t 开始，直到 n 个请求可以被允许需要等待的时间
+// The DelayAt method returns the time to wait from time t until n requests can be allowed
+func (l *SlidingWindowLimiter) DelayAt(t time.Time, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == rate.Inf {
+		return 0
+	}
+
+	// 如果 n 超过了 burst，则永远不会被允许
+	// If n exceeds burst, it will never be allowed
+	if n > l.burst {
+		return time.Duration(math.MaxInt64)
+	}
+
+	// 在状态的副本上推进窗口，避免修改限流器的状态
+	// Advance the window on a copy of the state to avoid modifying the state of the limiter
+	s := SlidingWindowLimiter{limit: l.limit, burst: l.burst, window: l.window, start: l.start, prev: l.prev, curr: l.curr}
+	s.advance(t)
+	if s.estimate(t)+float64(n) <= float64(s.burst) {
+		return 0
+	}
+
+	// 如果当前窗口还能容纳 n 个请求，则等待上一个窗口的权重衰减到足够小；
+	// 否则等待到下一个窗口，此时当前窗口变为上一个窗口
+	// If the current window can still hold n requests, wait for the weight of the previous window to decay enough;
+	// otherwise wait until the next window, where the current window becomes the previous window
+	start, prev, free := s.start, s.prev, s.burst-n-s.curr
+	if free < 0 {
+		start, prev, free = s.start.Add(s.window), s.curr, s.burst-n
+	}
+
+	// 求解 prev * (1 - x / window) <= free，得到需要经过的窗口比例 x / window
+	// Solve prev * (1 - x / window) <= free for the proportion of the window x / window that needs to pass
+	ratio := 1 - float64(free)/float64(prev)
+	if ratio < 0 {
+		ratio = 0
+	}
+
+	// 计算需要等待的时间
+	// Calculate the time to wait
+	delay := start.Add(time.Duration(ratio * float64(s.window))).Sub(t)
+	if delay < 0 {
+		return 0
+	}
+
+	return delay
+}
+
+// advance 方法在时间 t 超过当前窗口时滚动窗口
+// The advance method rolls the windows when time t is past the current window
+func (l *SlidingWindowLimiter) advance(t time.Time) {
+	end := l.start.Add(l.window)
+	if t.Before(end) {
+		return
+	}
+
+	// 如果时间 t 仍在下一个窗口内，则当前窗口变为上一个窗口，否则两个窗口都已经过期
+	// If time t is still in the next window, the current window becomes the previous window, otherwise both windows have expired
+	if t.Before(end.Add(l.window)) {
+		l.prev = l.curr
+		l.start = end
+	} else {
+		l.prev = 0
+		l.start = t.Truncate(l.window)
+	}
+	l.curr = 0
+}
+
+// estimate 方法返回在时间 t 最近一个窗口内请求数量的估计值
+// The estimate method returns the estimated number of requests in the last window at time t
+func (l *SlidingWindowLimiter) estimate(t time.Time) float64 {
+	// 上一个窗口的权重是它与最近一个窗口重叠的比例
+	// The weight of the previous window is the proportion of it overlapping the last window
+	weight := 1 - float64(t.Sub(l.start))/float64(l.window)
+	if weight < 0 {
+		weight = 0
+	}
+
+	return float64(l.prev)*weight + float64(l.curr)
+}
+
+// SlidingLogLimiter 是滑动日志限流器，记录最近一个窗口内每个请求的时间，精确地保证任意窗口内最多 burst 个请求
+// SlidingLogLimiter is a sliding log rate limiter, it records the time of each request in the last window and exactly guarantees at most burst requests in any window
+type SlidingLogLimiter struct {
+	// mu 是一个互斥锁，用于保护限流器的状态
+	// mu is a mutex used to protect the state of the limiter
+	mu sync.Mutex
+
+	// limit 是每秒限制速率
+	// limit is the limit rate per second
+	limit rate.Limit
+
+	// burst 是每个窗口内允许的请求数量
+	// burst is the number of requests allowed in each window
+	burst int
+
+	// window 是窗口长度
+	// window is the window length
+	window time.Duration
+
+	// logs 是最近一个窗口内请求的时间，按时间顺序排列
+	// logs is the time of the requests in the last window, in chronological order
+	logs []time.Time
+}
+
+// NewSlidingLogLimiter 是一个函数，返回一个新的滑动日志限流器
+// NewSlidingLogLimiter is a function that returns a new sliding log rate limiter
+func NewSlidingLogLimiter(r rate.Limit, b int) *SlidingLogLimiter {
+	return &SlidingLogLimiter{limit: r, burst: b, window: windowOf(r, b)}
+}
+
+// Limit 方法返回每秒限制速率
+// The Limit method returns the limit rate per second
+func (l *SlidingLogLimiter) Limit() rate.Limit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Burst 方法返回每个窗口内允许的请求数量
+// The Burst method returns the number of requests allowed in each window
+func (l *SlidingLogLimiter) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.burst
+}
+
+// SetLimit 方法设置每秒限制速率，并重新计算窗口长度
+// The SetLimit method sets the limit rate per second and recalculates the window length
+func (l *SlidingLogLimiter) SetLimit(newLimit rate.Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = newLimit
+	l.window = windowOf(l.limit, l.burst)
+}
+
+// SetBurst 方法设置每个窗口内允许的请求数量，并重新计算窗口长度
+// The SetBurst method sets the number of requests allowed in each window and recalculates the window length
+func (l *SlidingLogLimiter) SetBurst(newBurst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.burst = newBurst
+	l.window = windowOf(l.limit, l.burst)
+}
+
+// Allow 方法是 AllowN(time.Now(), 1) 的简写
+// The Allow method is shorthand for AllowN(time.Now(), 1)
+func (l *SlidingLogLimiter) Allow() bool {
+	return l.AllowN(time.Now(), 1)
+}
+
+// AllowN 方法判断在时间 t 是否允许 n 个请求，如果允许则记录到日志中
+// The AllowN method reports whether n requests may happen at time t, and records them in the log if allowed
+func (l *SlidingLogLimiter) AllowN(t time.Time, n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 如果速率为无限，则总是允许
+	// If the rate is infinite, always allow
+	if l.limit == rate.Inf {
+		return true
+	}
+
+	// 删除已经滑出窗口的日志，如果日志数量加上 n 超过了 burst，则不允许
+	// Remove the logs that have slid out of the window, if the number of logs plus n exceeds burst, do not allow
+	l.logs = l.logs[l.expired(t):]
+	if len(l.logs)+n > l.burst {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+		l.logs = append(l.logs, t)
+	}
+
+	return true
+}
+
+// TokensAt 方法返回在时间 t 最近一个窗口内剩余的请求数量
+// The TokensAt method returns the number of requests remaining in the last window at time t
+func (l *SlidingLogLimiter) TokensAt(t time.Time) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == rate.Inf {
+		return float64(l.burst)
+	}
+
+	return float64(l.burst - len(l.logs) + l.expired(t))
+}
+
+// DelayAt 方法返回从时间 t 开始，直到 n 个请求可以被允许需要等待的时间
+// The DelayAt method returns the time to wait from time t until n requests can be allowed
+func (l *SlidingLogLimiter) DelayAt(t time.Time, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == rate.Inf {
+		return 0
+	}
+
+	// 如果 n 超过了 burst，则永远不会被允许
+	// If n exceeds burst, it will never be allowed
+	if n > l.burst {
+		return time.Duration(math.MaxInt64)
+	}
+
+	// 计算还需要滑出窗口的日志数量，如果不需要则不用等待
+	// Calculate the number of logs that still need to slide out of the window, no need to wait if none
+	expired := l.expired(t)
+	needed := len(l.logs) - expired + n - l.burst
+	if needed <= 0 {
+		return 0
+	}
+
+	// 等待到第 needed 条仍在窗口内的日志滑出窗口
+	// Wait until the needed-th log still in the window slides out of the window
+	return l.logs[expired+needed-1].Add(l.window).Sub(t)
+}
+
+// expired 方法返回在时间 t 已经滑出窗口的日志数量
+// The expired method returns the number of logs that have slid out of the window at time t
+func (l *SlidingLogLimiter) expired(t time.Time) int {
+	i := 0
+	for i < len(l.logs) && !t.Before(l.logs[i].Add(l.window)) {
+		i++
+	}
+	return i
+}
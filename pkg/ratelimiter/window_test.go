@@ -0,0 +1,124 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/shengyanli1982/orbit-contrib/internal/common"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+var testWindowStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFixedWindowLimiter_AllowN(t *testing.T) {
+	// 5 requests per second
+	limiter := NewFixedWindowLimiter(rate.Limit(5), 5)
+
+	// All requests in the first window are allowed until the burst is used up
+	for i := 0; i < 5; i++ {
+		assert.True(t, limiter.AllowN(testWindowStart.Add(time.Duration(i)*time.Millisecond), 1))
+	}
+	assert.False(t, limiter.AllowN(testWindowStart.Add(500*time.Millisecond), 1))
+	assert.Equal(t, float64(0), limiter.TokensAt(testWindowStart.Add(500*time.Millisecond)))
+
+	// The burst is restored at the start of the next window
+	assert.Equal(t, float64(5), limiter.TokensAt(testWindowStart.Add(time.Second)))
+	assert.True(t, limiter.AllowN(testWindowStart.Add(time.Second), 5))
+	assert.False(t, limiter.AllowN(testWindowStart.Add(time.Second), 1))
+}
+
+func TestSlidingWindowLimiter_AllowN(t *testing.T) {
+	// 10 requests per second
+	limiter := NewSlidingWindowLimiter(rate.Limit(10), 10)
+
+	// Use up the burst at the end of the first window
+	assert.True(t, limiter.AllowN(testWindowStart.Add(900*time.Millisecond), 10))
+	assert.False(t, limiter.AllowN(testWindowStart.Add(950*time.Millisecond), 1))
+
+	// Unlike the fixed window, the previous window still weighs 80% at the start of the next window
+	at := testWindowStart.Add(1200 * time.Millisecond)
+	assert.InDelta(t, float64(2), limiter.TokensAt(at), 1e-9)
+	assert.True(t, limiter.AllowN(at, 2))
+	assert.False(t, limiter.AllowN(at, 1))
+
+	// After two windows both counters have expired
+	assert.True(t, limiter.AllowN(testWindowStart.Add(3*time.Second), 10))
+}
+
+func TestSlidingLogLimiter_AllowN(t *testing.T) {
+	// 4 requests per second
+	limiter := NewSlidingLogLimiter(rate.Limit(4), 4)
+
+	// Requests at 0ms, 250ms, 500ms and 750ms use up the window
+	for i := 0; i < 4; i++ {
+		assert.True(t, limiter.AllowN(testWindowStart.Add(time.Duration(i)*250*time.Millisecond), 1))
+	}
+	assert.False(t, limiter.AllowN(testWindowStart.Add(900*time.Millisecond), 1))
+
+	// Every second exactly one request slides out of the window
+	at := testWindowStart.Add(1100 * time.Millisecond)
+	assert.Equal(t, float64(1), limiter.TokensAt(at))
+	assert.True(t, limiter.AllowN(at, 1))
+	assert.False(t, limiter.AllowN(at, 1))
+}
+
+func TestWindowLimiter_SetLimitAndBurst(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmSlidingWindow, AlgorithmSlidingLog, AlgorithmFixedWindow} {
+		limiter := NewLimiter(algorithm, rate.Limit(1), 1)
+
+		limiter.SetLimit(rate.Limit(10))
+		limiter.SetBurst(20)
+
+		assert.Equal(t, rate.Limit(10), limiter.Limit(), algorithm.String())
+		assert.Equal(t, 20, limiter.Burst(), algorithm.String())
+		assert.True(t, limiter.AllowN(testWindowStart, 20), algorithm.String())
+		assert.False(t, limiter.AllowN(testWindowStart, 1), algorithm.String())
+	}
+}
+
+func TestLimiter_Algorithm(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmSlidingLog, AlgorithmFixedWindow, AlgorithmGCRA} {
+		// Create a new rate limiter with the algorithm
+		conf := NewConfig().WithRate(2).WithBurst(5).WithAlgorithm(algorithm)
+		limiter := NewIpRateLimiter(conf)
+
+		// Create a test context
+		router := gin.New()
+		router.Use(limiter.HandlerFunc())
+		router.GET(com.TestUrlPath, func(c *gin.Context) {
+			c.String(http.StatusOK, "OK")
+		})
+
+		// Send multiple requests to test the rate limiter
+		for i := 0; i < 10; i++ {
+			testRequestFunc(t, i, router, conf, com.TestEndpoint2, com.TestUrlPath)
+		}
+
+		limiter.Stop()
+	}
+}
+
+func TestWindowLimiter_DelayAt(t *testing.T) {
+	// Fixed window: wait until the end of the window
+	fixed := NewFixedWindowLimiter(rate.Limit(5), 5)
+	assert.True(t, fixed.AllowN(testWindowStart, 5))
+	assert.Equal(t, 600*time.Millisecond, fixed.DelayAt(testWindowStart.Add(400*time.Millisecond), 1))
+	assert.Equal(t, time.Duration(0), fixed.DelayAt(testWindowStart.Add(time.Second), 5))
+
+	// Sliding window: wait until the weight of the previous window has decayed enough
+	sliding := NewSlidingWindowLimiter(rate.Limit(10), 10)
+	assert.True(t, sliding.AllowN(testWindowStart.Add(900*time.Millisecond), 10))
+	assert.InDelta(t, float64(200*time.Millisecond), float64(sliding.DelayAt(testWindowStart.Add(900*time.Millisecond), 1)), float64(time.Microsecond))
+	assert.InDelta(t, float64(800*time.Millisecond), float64(sliding.DelayAt(testWindowStart.Add(1200*time.Millisecond), 10)), float64(time.Microsecond))
+
+	// Sliding log: wait until enough logs have slid out of the window
+	log := NewSlidingLogLimiter(rate.Limit(4), 4)
+	for i := 0; i < 4; i++ {
+		assert.True(t, log.AllowN(testWindowStart.Add(time.Duration(i)*250*time.Millisecond), 1))
+	}
+	assert.Equal(t, 100*time.Millisecond, log.DelayAt(testWindowStart.Add(900*time.Millisecond), 1))
+	assert.Equal(t, 350*time.Millisecond, log.DelayAt(testWindowStart.Add(900*time.Millisecond), 2))
+}
@@ -3,6 +3,7 @@ package rewriter
 import (
 	"net/url"
 
+	"github.com/gin-gonic/gin"
 	com "github.com/shengyanli1982/orbit-contrib/internal/common"
 )
 
@@ -18,12 +19,26 @@ var DefaultPathRewriteFunc = func(header *url.URL) (bool, string) {
 	return false, ""
 }
 
+// IpResolver 是客户端 IP 地址的解析器，支持受信任的代理、X-Forwarded-For 请求头 (可以设置为 X-Real-IP、Forwarded 等请求头) 和 PROXY 协议
+// IpResolver is the resolver of the client IP address, supporting trusted proxies, the X-Forwarded-For header (X-Real-IP, Forwarded and other headers can be configured) and the PROXY protocol
+type IpResolver = com.IpResolver
+
+// NewIpResolver 创建一个没有受信任的代理的解析器
+// NewIpResolver creates a resolver without trusted proxies
+func NewIpResolver() *IpResolver {
+	return com.NewIpResolver()
+}
+
 // Config 是一个配置结构体
 // Config is a struct of config
 type Config struct {
 	// Ip 白名单
 	// Ip whitelist
-	ipWhitelist map[string]struct{}
+	ipWhitelist *com.IpList
+
+	// 客户端 IP 地址的解析器
+	// Resolver of the client IP address
+	ipResolver *IpResolver
 
 	// 匹配函数
 	// Match function
@@ -44,7 +59,7 @@ func NewConfig() *Config {
 	return &Config{
 		// 默认的IP白名单
 		// Default IP whitelist
-		ipWhitelist: com.DefaultIpWhitelist,
+		ipWhitelist: com.NewIpList(com.DefaultIpWhitelist...),
 
 		// 默认的限制匹配函数
 		// Default limit match function
@@ -92,22 +107,41 @@ func (c *Config) WithMatchFunc(fn com.HttpRequestHeaderMatchFunc) *Config {
 	return c
 }
 
-// WithIpWhitelist 设置白名单
-// WithIpWhitelist sets the whitelist
+// WithIpWhitelist 设置白名单，每一项是一个 IP 地址或者 CIDR 网段，无法解析的项被忽略
+// WithIpWhitelist sets the whitelist, each item is an IP address or a CIDR network, items that cannot be parsed are ignored
 func (c *Config) WithIpWhitelist(whitelist []string) *Config {
-	// 遍历白名单列表
-	// Iterate over the whitelist
-	for _, ip := range whitelist {
-		// 将 IP 添加到白名单
-		// Add the IP to the whitelist
-		c.ipWhitelist[ip] = com.Empty
-	}
+	// 将 IP 添加到配置自己的白名单
+	// Add the IPs to the configuration's own whitelist
+	c.ipWhitelist.Add(whitelist...)
+
+	// 返回配置实例
+	// Return the config instance
+	return c
+}
+
+// WithIpResolver 设置白名单使用的客户端 IP 地址的解析器，为 nil 时使用 gin.Context 的 ClientIP 方法
+// WithIpResolver sets the resolver of the client IP address used by the whitelist, the ClientIP method of gin.Context is used when it is nil
+func (c *Config) WithIpResolver(resolver *IpResolver) *Config {
+	// 设置解析器
+	// Set the resolver
+	c.ipResolver = resolver
 
 	// 返回配置实例
 	// Return the config instance
 	return c
 }
 
+// clientIP 返回请求的客户端 IP 地址
+// clientIP returns the client IP address of the request
+func (c *Config) clientIP(ctx *gin.Context) string {
+	// 没有解析器时使用 gin 的客户端 IP 地址
+	// Use the client IP address of gin when there is no resolver
+	if c.ipResolver == nil {
+		return ctx.ClientIP()
+	}
+	return c.ipResolver.ClientIP(ctx.Request)
+}
+
 // WithPathRewriteFunc 设置路径重写函数
 // WithPathRewriteFunc sets the path rewrite function
 func (c *Config) WithPathRewriteFunc(fn PathRewriteFunc) *Config {
@@ -141,7 +175,7 @@ func isConfigValid(config *Config) *Config {
 		// 如果 IP 白名单为空，设置为默认的 IP 白名单
 		// If the IP whitelist is null, set it to the default IP whitelist
 		if config.ipWhitelist == nil {
-			config.ipWhitelist = com.DefaultIpWhitelist
+			config.ipWhitelist = com.NewIpList(com.DefaultIpWhitelist...)
 		}
 
 		// 如果路径重写函数为空，设置为默认的路径重写函数
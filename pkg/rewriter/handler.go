@@ -28,6 +28,24 @@ func NewPathRewriter(config *Config) *PathRewriter {
 	}
 }
 
+// AddIp 向 IP 白名单添加 IP 地址和 CIDR 网段，无法解析的项被忽略，之后的请求立即生效
+// AddIp adds IP addresses and CIDR networks to the IP whitelist, items that cannot be parsed are ignored, and it takes effect immediately for later requests
+func (p *PathRewriter) AddIp(ips ...string) {
+	p.config.ipWhitelist.Add(ips...)
+}
+
+// RemoveIp 从 IP 白名单删除之前添加的 IP 地址和 CIDR 网段
+// RemoveIp removes IP addresses and CIDR networks added before from the IP whitelist
+func (p *PathRewriter) RemoveIp(ips ...string) {
+	p.config.ipWhitelist.Remove(ips...)
+}
+
+// ReplaceIpList 使用指定的 IP 地址和 CIDR 网段替换 IP 白名单
+// ReplaceIpList replaces the IP whitelist with the specified IP addresses and CIDR networks
+func (p *PathRewriter) ReplaceIpList(ips []string) {
+	p.config.ipWhitelist.Replace(ips)
+}
+
 // HandlerFunc 返回一个 gin.HandlerFunc，用于处理请求
 // HandlerFunc returns a gin.HandlerFunc for processing requests
 func (p *PathRewriter) HandlerFunc() gin.HandlerFunc {
@@ -39,11 +57,11 @@ func (p *PathRewriter) HandlerFunc() gin.HandlerFunc {
 		if p.config.matchFunc(ctx.Request) {
 			// 获取客户端 IP
 			// Get the client IP
-			clientIP := ctx.ClientIP()
+			clientIP := p.config.clientIP(ctx)
 
 			// 如果请求的 IP 不在白名单中，则进行重写策略
 			// If the IP of the request is not in the whitelist, then rewrite the request
-			if _, ok := p.config.ipWhitelist[clientIP]; !ok {
+			if !p.config.ipWhitelist.ContainsString(clientIP) {
 				// 如果请求的路径需要重写，则进行重写
 				// If the path of the request needs to be rewritten, rewrite it
 				if ok, newPath := p.config.rewriteFunc(ctx.Request.URL); ok {
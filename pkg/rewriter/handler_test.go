@@ -222,3 +222,80 @@ func TestPathRewriter_IpWhitelistWithOther(t *testing.T) {
 	assert.Equal(t, com.TestUrlPath2, req.URL.Path)
 	assert.Equal(t, newContext, w.Body.String())
 }
+
+func TestPathRewriter_IpResolver(t *testing.T) {
+	// Create a new Config, the whitelist is checked against the address resolved behind the trusted proxy
+	resolver := NewIpResolver().WithTrustedProxies([]string{"10.20.0.0/16"})
+	conf := NewConfig().WithPathRewriteFunc(func(u *url.URL) (bool, string) {
+		return true, com.TestUrlPath2
+	}).WithIpWhitelist([]string{"203.0.113.9"}).WithIpResolver(resolver)
+
+	// Create a new PathRewriter
+	rewriter := NewPathRewriter(conf)
+	defer rewriter.Stop()
+
+	// Create a new Gin router
+	router := gin.New()
+	router.Use(rewriter.HandlerFunc())
+	router.GET(com.TestUrlPath, func(c *gin.Context) {
+		c.String(http.StatusOK, com.TestResponseText)
+	})
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The whitelisted client behind the trusted proxy is not rewritten
+	assert.Equal(t, http.StatusOK, request("10.20.0.1:80").Code)
+
+	// A client forging the header is rewritten
+	assert.Equal(t, http.StatusTemporaryRedirect, request("203.0.113.10:80").Code)
+}
+
+func TestPathRewriter_AddRemoveIp(t *testing.T) {
+	// Create two PathRewriters, whitelisting an address in one configuration does not affect the other
+	rewrite := func(u *url.URL) (bool, string) {
+		return true, com.TestUrlPath2
+	}
+	rewriter := NewPathRewriter(NewConfig().WithPathRewriteFunc(rewrite).WithIpWhitelist([]string{"10.32.8.1"}))
+	defer rewriter.Stop()
+	other := NewPathRewriter(NewConfig().WithPathRewriteFunc(rewrite))
+	defer other.Stop()
+
+	newRouter := func(handler gin.HandlerFunc) *gin.Engine {
+		router := gin.New()
+		router.Use(handler)
+		router.GET(com.TestUrlPath, func(c *gin.Context) {
+			c.String(http.StatusOK, com.TestResponseText)
+		})
+		return router
+	}
+	router, otherRouter := newRouter(rewriter.HandlerFunc()), newRouter(other.HandlerFunc())
+
+	request := func(router *gin.Engine, remoteAddr string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, com.TestUrlPath, nil)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(router, "10.32.8.1:80"))
+	assert.Equal(t, http.StatusTemporaryRedirect, request(otherRouter, "10.32.8.1:80"))
+
+	// Added networks are not rewritten until they are removed
+	rewriter.AddIp("10.32.9.0/24")
+	assert.Equal(t, http.StatusOK, request(router, "10.32.9.1:80"))
+	rewriter.RemoveIp("10.32.9.0/24")
+	assert.Equal(t, http.StatusTemporaryRedirect, request(router, "10.32.9.1:80"))
+
+	// Replacing the list drops the old items
+	rewriter.ReplaceIpList([]string{"10.32.9.1"})
+	assert.Equal(t, http.StatusTemporaryRedirect, request(router, "10.32.8.1:80"))
+	assert.Equal(t, http.StatusOK, request(router, "10.32.9.1:80"))
+}